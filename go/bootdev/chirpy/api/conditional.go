@@ -0,0 +1,92 @@
+package api
+
+import (
+	"chirpy/internal/service"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// encodeTagged encodes v as respondJSON would and returns the body with its
+// strong ETag, a hash of those exact bytes. Each shape of a chirp, ?fields=
+// and ?include=, is its own representation with its own tag.
+func encodeTagged(v any) ([]byte, string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", err
+	}
+	body = append(body, '\n')
+	sum := sha256.Sum256(body)
+	return body, `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// respondTagged writes v like respondJSON, with its ETag and, unless it's
+// zero, Last-Modified. A GET whose If-None-Match or, without one,
+// If-Modified-Since shows the client already has it gets a 304 and no body.
+func respondTagged(w http.ResponseWriter, r *http.Request, status int, v any, lastModified time.Time) {
+	body, etag, err := encodeTagged(v)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) && notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		// If-None-Match compares weakly, W/"x" matches "x"
+		return etagListMatches(inm, etag, false)
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// Last-Modified only has second precision
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// etagListMatches reports whether etag is in header's comma separated list or
+// the list is "*". A strong comparison never matches a weak tag.
+func etagListMatches(header, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		weak := strings.HasPrefix(candidate, "W/")
+		if weak && strong {
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch turns the request's If-Match header into a service precondition: the
+// ETag of the current T's representation, as represent makes it, must be one
+// of those listed. Without the header the write is unconditional.
+func ifMatch[T, R any](r *http.Request, represent func(T) R) service.Precondition[T] {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	return func(current T) bool {
+		_, etag, err := encodeTagged(represent(current))
+		return err == nil && etagListMatches(header, etag, true)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	s := newTestServer(t, "dev")
+	alice := s.signup(t, "alice@example.com")
+	// send is do with extra headers
+	send := func(method, path string, headers map[string]string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+alice.Token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	created := s.do(t, http.MethodPost, "/api/chirps", alice.Token, map[string]string{"body": "hello"})
+	chirp := decode[ChirpResponse](t, created)
+	chirpPath := "/api/chirps/" + chirp.ID.String()
+	etag := created.Header().Get("ETag")
+	lastModified := created.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("created chirp ETag = %q, Last-Modified = %q, want both", etag, lastModified)
+	}
+	list := s.do(t, http.MethodGet, "/api/chirps", "", nil)
+	listETag := list.Header().Get("ETag")
+
+	reads := []struct {
+		name       string
+		path       string
+		headers    map[string]string
+		wantStatus int
+		wantETag   string
+	}{
+		{name: "Same ETag as when created", path: chirpPath, wantStatus: http.StatusOK, wantETag: etag},
+		{name: "If-None-Match", path: chirpPath, headers: map[string]string{"If-None-Match": etag}, wantStatus: http.StatusNotModified, wantETag: etag},
+		{name: "If-None-Match among others, weak", path: chirpPath, headers: map[string]string{"If-None-Match": `"other", W/` + etag}, wantStatus: http.StatusNotModified},
+		{name: "If-None-Match stale", path: chirpPath, headers: map[string]string{"If-None-Match": `"stale"`}, wantStatus: http.StatusOK, wantETag: etag},
+		{name: "If-Modified-Since", path: chirpPath, headers: map[string]string{"If-Modified-Since": lastModified}, wantStatus: http.StatusNotModified},
+		{name: "If-None-Match wins over If-Modified-Since", path: chirpPath, headers: map[string]string{"If-None-Match": `"stale"`, "If-Modified-Since": lastModified}, wantStatus: http.StatusOK},
+		{name: "Another shape is another representation", path: chirpPath + "?include=author", headers: map[string]string{"If-None-Match": etag}, wantStatus: http.StatusOK},
+		{name: "List", path: "/api/chirps", headers: map[string]string{"If-None-Match": listETag}, wantStatus: http.StatusNotModified, wantETag: listETag},
+	}
+	for _, tt := range reads {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := send(http.MethodGet, tt.path, tt.headers, nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 has a body: %s", rec.Body)
+			}
+			if tt.wantETag != "" && rec.Header().Get("ETag") != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", rec.Header().Get("ETag"), tt.wantETag)
+			}
+		})
+	}
+
+	s.do(t, http.MethodPost, "/api/chirps", alice.Token, map[string]string{"body": "another"})
+	if rec := send(http.MethodGet, "/api/chirps", map[string]string{"If-None-Match": listETag}, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/chirps after a new chirp = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	updated := send(http.MethodPut, "/api/users", nil, map[string]string{"email": "alice@example.com", "password": "correct horse"})
+	userETag := updated.Header().Get("ETag")
+	writes := []struct {
+		name       string
+		method     string
+		path       string
+		ifMatch    string
+		body       any
+		wantStatus int
+	}{
+		{name: "Stale delete", method: http.MethodDelete, path: chirpPath, ifMatch: `"stale"`, wantStatus: http.StatusPreconditionFailed},
+		{name: "Weak tags never match", method: http.MethodDelete, path: chirpPath, ifMatch: "W/" + etag, wantStatus: http.StatusPreconditionFailed},
+		{name: "Current delete", method: http.MethodDelete, path: chirpPath, ifMatch: etag, wantStatus: http.StatusNoContent},
+		{name: "Current update", method: http.MethodPut, path: "/api/users", ifMatch: userETag, body: map[string]string{"email": "alice@example.org", "password": "correct horse"}, wantStatus: http.StatusOK},
+		{name: "Stale update", method: http.MethodPut, path: "/api/users", ifMatch: userETag, body: map[string]string{"email": "alice@example.net", "password": "correct horse"}, wantStatus: http.StatusPreconditionFailed},
+		{name: "Any version", method: http.MethodPut, path: "/api/users", ifMatch: "*", body: map[string]string{"email": "alice@example.net", "password": "correct horse"}, wantStatus: http.StatusOK},
+	}
+	for _, tt := range writes {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := send(tt.method, tt.path, map[string]string{"If-Match": tt.ifMatch}, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusPreconditionFailed {
+				if p := decode[Problem](t, rec); p.Code != "precondition_failed" {
+					t.Errorf("problem code = %q, want precondition_failed", p.Code)
+				}
+			}
+		})
+	}
+}
@@ -21,11 +21,15 @@ mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request)
 import (
 	"chirpy/internal/auth"
 	"chirpy/internal/database"
-	"encoding/json"
+	"chirpy/internal/logging"
+	"chirpy/internal/service"
+	"chirpy/internal/validate"
+	"context"
+	"errors"
 	"fmt"
-	"log/slog"
 	"net/http"
-	"sort"
+	"net/url"
+	"slices"
 	"strings"
 	"text/template"
 	"time"
@@ -33,558 +37,326 @@ import (
 	"github.com/google/uuid"
 )
 
-// UpgradeUserToChirpyRed is an endpoint that allows users to upgrade their account to Chirpy Red.
-func (cfg *ApiConfig) UpgradeUserToChirpyRed(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
-		return
-	}
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if apiKey != cfg.PolkaKey || err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error: invalid or missing API key"})
-		return
-	}
-	type upgradeUserToChirpyRedRequest struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserID string `json:"user_id"`
-		} `json:"data"`
-	}
-	var req upgradeUserToChirpyRedRequest
-	d := json.NewDecoder(r.Body)
-	err = d.Decode(&req)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error decoding request body"})
-		return
-	}
-	if req.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-	if req.Data.UserID == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing user_id"})
-		return
-	}
-	userID, err := uuid.Parse(req.Data.UserID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid user_id"})
-		return
-	}
-	_, err = cfg.DbQueries.GetUserByID(r.Context(), userID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "user not found"})
-		return
-	}
-	_, err = cfg.DbQueries.UpgradeUserToChirpyRed(r.Context(), userID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to upgrade user"})
-		return
-	}
-	w.WriteHeader(http.StatusNoContent)
-}
-
 // LoginUser handles user login, authenticating the user and returning a JWT token.
 func (cfg *ApiConfig) LoginUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
+	req, ok := decodeJSON[loginRequest](w, r)
+	if !ok {
 		return
 	}
-	type loginRequest struct {
-		Email        string `json:"email"`
-		Password     string `json:"password"`
-		RefreshToken string `json:"refresh_token,omitempty"`
+	session, err := cfg.Auth.Login(r.Context(), req.Email, req.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		cfg.Metrics.LoginsFailed.Inc()
 	}
-	var req loginRequest
-	d := json.NewDecoder(r.Body)
-	err := d.Decode(&req)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error decoding request body"})
+		respondError(w, r, err)
 		return
 	}
-	// get user
-	user, err := cfg.DbQueries.GetUserByEmail(r.Context(), req.Email)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error fetching user"})
-		return
-	}
-	// check password
-	err = auth.CheckPasswordHash(user.HashedPassword, req.Password)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error checking password"})
-		return
-	}
-	// make refesh token
-	refreshToken, err := auth.MakeRefreshToken()
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error creating refresh token"})
-		return
-	}
-	// store refresh token in DB
-	expiresAt := time.Now().Add(60 * 24 * time.Hour) // 60 days
-	_, err = cfg.DbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: expiresAt,
-	})
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error storing refresh token"})
-		return
-	}
-	// make token
-	token, err := auth.MakeJWT(user.ID, cfg.JWTSecret, time.Hour)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error creating token"})
-		return
-	}
-	slog.Info("🧑 login_user hit", "email", user.Email, "created_at", user.CreatedAt, "updated_at", user.UpdatedAt)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(UserResponse{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		Token:        token,
-		RefreshToken: refreshToken,
-		IsChirpyRed:  user.IsChirpyRed,
-	})
-}
-
-func (cfg *ApiConfig) HandleUsers(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		cfg.createUser(w, r)
-	case http.MethodPut:
-		cfg.handleUsersUpdate(w, r)
-	default:
-		http.NotFound(w, r)
-	}
+	user := session.User
+	logging.SetUserID(r.Context(), user.ID.String())
+	logging.FromContext(r.Context()).Info("🧑 login_user hit", "email", user.Email, "created_at", user.CreatedAt, "updated_at", user.UpdatedAt)
+	resp := newUserResponse(user)
+	resp.Token = session.AccessToken
+	resp.RefreshToken = session.RefreshToken
+	respondJSON(w, http.StatusOK, resp)
 }
 
 // CreateUser handles the creation of a new user.
-func (cfg *ApiConfig) createUser(w http.ResponseWriter, r *http.Request) {
-	type createUserRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	var req createUserRequest
-	d := json.NewDecoder(r.Body)
-	err := d.Decode(&req)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error decoding request body"})
-		return
-	}
-	// hash password
-	hp, err := auth.HashPassword(req.Password)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error hashing password"})
+func (cfg *ApiConfig) CreateUser(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeJSON[createUserRequest](w, r)
+	if !ok {
 		return
 	}
-	// create user
-	user, err := cfg.DbQueries.CreateUser(r.Context(), database.CreateUserParams{Email: req.Email, HashedPassword: hp})
+	user, err := cfg.Users.Create(r.Context(), req.Email, req.Password)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error creating user"})
+		respondError(w, r, err)
 		return
 	}
-	slog.Info("🧑 create_user hit", "email", user.Email, "created_at", user.CreatedAt, "updated_at", user.UpdatedAt)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	cfg.Metrics.UsersCreated.Inc()
+	logging.FromContext(r.Context()).Info("🧑 create_user hit", "email", user.Email, "created_at", user.CreatedAt, "updated_at", user.UpdatedAt)
 	// encode the user but ⚠️ WITHOUT the password
-	json.NewEncoder(w).Encode(UserResponse{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
+	respondTagged(w, r, http.StatusCreated, newUserResponse(user), time.Time{})
 }
 
-func (cfg *ApiConfig) handleUsersUpdate(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing or malformed Authorization header"})
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid or missing JWT"})
+// UpdateUser changes the authenticated user's email and password. With an
+// If-Match header it only does so if the ETag of the user, as the last create
+// or update returned it, still matches, and answers 412 otherwise.
+func (cfg *ApiConfig) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
 		return
 	}
 
-	type updateUserRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	var req updateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error decoding request body"})
+	req, ok := decodeJSON[updateUserRequest](w, r)
+	if !ok {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(req.Password)
+	user, err := cfg.Users.Update(r.Context(), userID, req.Email, req.Password, ifMatch(r, newUserResponse))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error hashing password"})
+		respondError(w, r, err)
 		return
 	}
 
-	user, err := cfg.DbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          req.Email,
-		HashedPassword: hashedPassword,
-	})
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error updating user"})
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(UserResponse{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
-}
-
-func (cfg *ApiConfig) HandleChirps(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		cfg.createChirp(w, r)
-	case http.MethodGet:
-		cfg.getChirps(w, r)
-	default:
-		http.NotFound(w, r)
-	}
+	respondTagged(w, r, http.StatusOK, newUserResponse(user), time.Time{})
 }
 
-// HandleChirpWithOptions handles requests for a single chirp, allowing retrieval and deletion.
-func (cfg *ApiConfig) HandleChirpWithOptions(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		cfg.getChirp(w, r)
-	case http.MethodDelete:
-		cfg.deleteChirp(w, r)
-	default:
-		http.NotFound(w, r)
+// GetChirp retrieves a single chirp by its ID from the database, shaped by
+// ?fields= and ?include=.
+func (cfg *ApiConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidID, "Error parsing chirp ID")
+		return
 	}
-}
-
-// getChirp retrieves a single chirp by its ID from the database.
-func (cfg *ApiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.NotFound(w, r)
+	shape, fieldErrs := parseChirpShape(r.URL.Query())
+	if len(fieldErrs) > 0 {
+		respondError(w, r, &service.ValidationError{Msg: "invalid query parameters", Fields: fieldErrs})
 		return
 	}
-	chirpParam := strings.TrimPrefix(r.URL.Path, "/api/chirps/")
-	chirpID, err := uuid.Parse(chirpParam)
+	chirp, err := cfg.Chirps.Get(r.Context(), chirpID)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error parsing chirp ID"})
+		respondError(w, r, err)
 		return
 	}
-	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpID)
+	logging.FromContext(r.Context()).Info("🐦 get_chirp hit", "chirp", chirp.Body, "created_at", chirp.CreatedAt, "updated_at", chirp.UpdatedAt)
+	resp, err := cfg.chirpResponses(r.Context(), []database.Chirp{chirp}, shape)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error fetching chirps"})
+		respondError(w, r, err)
 		return
 	}
-	slog.Info("🐦 get_chirp hit", "chirp", chirp.Body, "created_at", chirp.CreatedAt, "updated_at", chirp.UpdatedAt)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(chirp)
+	respondTagged(w, r, http.StatusOK, resp[0], chirp.UpdatedAt)
 }
 
-// deleteChirp handles the deletion of a chirp by its ID.
-func (cfg *ApiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-	// Authenticate user via JWT
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing or malformed Authorization header"})
+// DeleteChirp handles the deletion of a chirp by its ID. With an If-Match
+// header it only deletes the chirp if the header matches the ETag of its
+// default representation, GetChirp's without ?fields= or ?include=.
+func (cfg *ApiConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
 		return
 	}
-	// Validate JWT
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid or missing JWT"})
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidID, "error parsing chirp ID")
 		return
 	}
-	// get chirp id from URL path
-	chirpParam := strings.TrimPrefix(r.URL.Path, "/api/chirps/")
-	chirpID, err := uuid.Parse(chirpParam)
+	// delete chirp, the service checks ownership in the same transaction
+	err = cfg.Chirps.Delete(r.Context(), userID, chirpID, ifMatch(r, newChirpResponse))
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error parsing chirp ID"})
+		respondError(w, r, err)
 		return
 	}
-	// get chirp to check ownership
-	chirp, err := cfg.DbQueries.GetChirp(r.Context(), chirpID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "can't find chirp"})
+	// Ok
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateChirp handles the creation of a new chirp, the response is shaped by
+// ?fields= and ?include= like GetChirp's.
+func (cfg *ApiConfig) CreateChirp(w http.ResponseWriter, r *http.Request) {
+	shape, fieldErrs := parseChirpShape(r.URL.Query())
+	if len(fieldErrs) > 0 {
+		respondError(w, r, &service.ValidationError{Msg: "invalid query parameters", Fields: fieldErrs})
 		return
 	}
-	// check if chirp belongs to user
-	if chirp.UserID != userID {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error: chirp does not belong to user"})
+	req, ok := decodeJSON[createChirpRequest](w, r)
+	if !ok {
 		return
 	}
-	err = cfg.DbQueries.DeleteChirp(r.Context(), chirpID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "delete chirp failed"})
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
 		return
 	}
-	// Ok
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// createChirp handles the creation of a new chirp.
-func (cfg *ApiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
-	type createChirpRequest struct {
-		Body string `json:"body"`
-	}
-	var req createChirpRequest
-	d := json.NewDecoder(r.Body)
-	err := d.Decode(&req)
+	// the service validates and sanitises the body
+	chirp, err := cfg.Chirps.Create(r.Context(), userID, req.Body)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error decoding request body"})
+		respondError(w, r, err)
 		return
 	}
-	// Authenticate user via JWT
-	token, err := auth.GetBearerToken(r.Header)
+	cfg.Metrics.ChirpsCreated.Inc()
+	logging.FromContext(r.Context()).Info("🐦 create_chirp hit", "chirp", chirp.Body, "created_at", chirp.CreatedAt, "updated_at", chirp.UpdatedAt)
+	resp, err := cfg.chirpResponses(r.Context(), []database.Chirp{chirp}, shape)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing or malformed Authorization header"})
+		respondError(w, r, err)
 		return
 	}
-	// Validate JWT
-	userID, err := auth.ValidateJWT(token, cfg.JWTSecret)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid or missing JWT"})
+	respondTagged(w, r, http.StatusCreated, resp[0], chirp.UpdatedAt)
+}
+
+// ListChirps lists chirps filtered by the query string: author_id, since and
+// until (RFC 3339), hashtag and search, sorted by sort=asc|desc and shaped by
+// fields and include.
+func (cfg *ApiConfig) ListChirps(w http.ResponseWriter, r *http.Request) {
+	query, fieldErrs := parseChirpQuery(r.URL.Query())
+	shape, shapeErrs := parseChirpShape(r.URL.Query())
+	fieldErrs = append(fieldErrs, shapeErrs...)
+	if len(fieldErrs) > 0 {
+		respondError(w, r, &service.ValidationError{Msg: "invalid query parameters", Fields: fieldErrs})
 		return
 	}
-	// validate chirp/steralzie chirp
-	cleanedBody, err := cfg.SteralizeChirp(req.Body)
+	// the service checks the filters make sense together
+	chirps, err := cfg.Chirps.List(r.Context(), query)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		respondError(w, r, err)
 		return
 	}
-	// create chirp
-	chirp, err := cfg.DbQueries.CreateChirp(r.Context(), database.CreateChirpParams{Body: cleanedBody, UserID: userID})
+	logging.FromContext(r.Context()).Info("🐦🐦🐦 get_all_chirps hit", "count", len(chirps))
+	resp, err := cfg.chirpResponses(r.Context(), chirps, shape)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error creating chirp"})
+		respondError(w, r, err)
 		return
 	}
-	slog.Info("🐦 create_chirp hit", "chirp", chirp.Body, "created_at", chirp.CreatedAt, "updated_at", chirp.UpdatedAt)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(chirp)
+	respondTagged(w, r, http.StatusOK, resp, time.Time{})
 }
 
-// getChirps retrieves all chirps from the database.
-func (cfg *ApiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
-	var chirps []database.Chirp
-	params := r.URL.Query()
-	authorID := params.Get("author_id")
-	// if authorID is provided, get chirps by author
-	if authorID != "" {
-		err := cfg.getChirpsByAuthor(w, r, authorID, &chirps)
+// parseChirpQuery turns the query string into a ChirpQuery, reporting every
+// parameter it can't parse.
+func parseChirpQuery(params url.Values) (service.ChirpQuery, []validate.FieldError) {
+	query := service.NewChirpQuery()
+	var fieldErrs []validate.FieldError
+	if v := params.Get("author_id"); v != "" {
+		id, err := uuid.Parse(v)
 		if err != nil {
-			return
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: "author_id", Rule: "uuid", Message: "must be a UUID"})
+		}
+		query = query.ByAuthor(id)
+	}
+	for _, name := range []string{"since", "until"} {
+		v := params.Get(name)
+		if v == "" {
+			continue
 		}
-	} else {
-		err := cfg.getAllTheChirps(w, r, &chirps)
+		t, err := time.Parse(time.RFC3339, v)
 		if err != nil {
-			return
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: name, Rule: "rfc3339", Message: "must be an RFC 3339 timestamp"})
+			continue
 		}
+		if name == "since" {
+			query = query.Since(t)
+		} else {
+			query = query.Until(t)
+		}
+	}
+	if v := params.Get("hashtag"); v != "" {
+		query = query.WithHashtag(v)
 	}
-	// sort chirps by created_at
-	sortOrder := params.Get("sort")
-	switch sortOrder {
+	if v := params.Get("search"); v != "" {
+		query = query.Matching(v)
+	}
+	switch params.Get("sort") {
 	case "", "asc":
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-		})
 	case "desc":
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[j].CreatedAt.Before(chirps[i].CreatedAt)
-		})
-	}
-	slog.Info("🐦🐦🐦 get_all_chirps hit", "count", len(chirps))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(chirps)
+		query = query.NewestFirst()
+	default:
+		fieldErrs = append(fieldErrs, validate.FieldError{Field: "sort", Rule: "oneof", Message: "must be asc or desc"})
+	}
+	return query, fieldErrs
 }
 
-// getAllTheChirps retrieves all chirps from the database.
-func (cfg *ApiConfig) getAllTheChirps(w http.ResponseWriter, r *http.Request, chirps *[]database.Chirp) error {
-	// get all chirps
-	c, err := cfg.DbQueries.GetAllChirps(r.Context())
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error fetching chirps"})
-		return err
-	}
-	*chirps = c
-	return nil
+// chirpShape is how the client asked for chirps to be shaped: fields keeps only
+// the named top level fields, includeAuthor embeds the author summary.
+type chirpShape struct {
+	fields        []string
+	includeAuthor bool
 }
 
-// getChirpsByAuthor retrieves all chirps by a specific author from the database.
-func (cfg *ApiConfig) getChirpsByAuthor(w http.ResponseWriter, r *http.Request, authorID string,
-	chirps *[]database.Chirp,
-) error {
-	id, err := uuid.Parse(authorID)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid user_id"})
+// chirpFields are the fields ?fields= can name.
+var chirpFields = jsonFieldNames(ChirpResponse{})
+
+// parseChirpShape reads ?fields=id,body and ?include=author, reporting names it
+// doesn't know.
+func parseChirpShape(params url.Values) (chirpShape, []validate.FieldError) {
+	var shape chirpShape
+	var fieldErrs []validate.FieldError
+	for _, field := range splitList(params.Get("fields")) {
+		if !slices.Contains(chirpFields, field) {
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: "fields", Rule: "oneof", Message: "unknown field " + field + ", must be one of " + strings.Join(chirpFields, ", ")})
+			continue
+		}
+		shape.fields = append(shape.fields, field)
 	}
-	c, err := cfg.DbQueries.GetAllChirpsByAuthor(r.Context(), id)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "Error fetching chirps for user"})
+	for _, include := range splitList(params.Get("include")) {
+		if include != "author" {
+			fieldErrs = append(fieldErrs, validate.FieldError{Field: "include", Rule: "oneof", Message: "can only include author"})
+			continue
+		}
+		shape.includeAuthor = true
 	}
-	*chirps = c
-	return nil
+	return shape, fieldErrs
 }
 
-// RefreshToken handles the refresh of a JWT token using a refresh token.
-func (cfg *ApiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
-		return
-	}
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing or malformed Authorization header"})
-		return
+// chirpResponses turns chirps into their responses shaped as asked, looking up
+// each distinct author once when they're included.
+func (cfg *ApiConfig) chirpResponses(ctx context.Context, chirps []database.Chirp, shape chirpShape) ([]any, error) {
+	authors := map[uuid.UUID]*AuthorSummary{}
+	resp := make([]any, 0, len(chirps))
+	for _, chirp := range chirps {
+		cr := newChirpResponse(chirp)
+		if shape.includeAuthor {
+			author, ok := authors[chirp.UserID]
+			if !ok {
+				user, err := cfg.Users.Get(ctx, chirp.UserID)
+				if err != nil && !errors.Is(err, service.ErrUserNotFound) {
+					return nil, err
+				}
+				// a chirp whose author was deleted since is left without one
+				if err == nil {
+					author = &AuthorSummary{ID: user.ID, IsChirpyRed: user.IsChirpyRed}
+				}
+				authors[chirp.UserID] = author
+			}
+			cr.Author = author
+		}
+		shaped, err := selectFields(cr, shape.fields)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, shaped)
 	}
+	return resp, nil
+}
 
-	rt, err := cfg.DbQueries.GetRefreshToken(r.Context(), token)
-	if err != nil || rt.ExpiresAt.Before(time.Now()) || (rt.RevokedAt.Valid && !rt.RevokedAt.Time.IsZero()) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid or expired refresh token"})
-		return
+func newChirpResponse(chirp database.Chirp) ChirpResponse {
+	return ChirpResponse{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Links: ChirpLinks{
+			Self:         "/api/v1/chirps/" + chirp.ID.String(),
+			AuthorChirps: "/api/v1/chirps?author_id=" + chirp.UserID.String(),
+		},
 	}
+}
 
-	user, err := cfg.DbQueries.GetUserByID(r.Context(), rt.UserID)
+// RefreshToken handles the refresh of a JWT token using a refresh token.
+func (cfg *ApiConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "user not found"})
+		respondProblem(w, r, http.StatusUnauthorized, CodeMissingToken, "missing or malformed Authorization header")
 		return
 	}
 
-	newAccessToken, err := auth.MakeJWT(user.ID, cfg.JWTSecret, time.Hour)
+	newAccessToken, err := cfg.Auth.Refresh(r.Context(), token)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to create access token"})
+		respondError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(struct {
-		Token string `json:"token"`
-	}{Token: newAccessToken})
+	respondJSON(w, http.StatusOK, TokenResponse{Token: newAccessToken})
 }
 
 // RevokeRefreshToken revokes a refresh token, making it invalid for future use.
 func (cfg *ApiConfig) RevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
-		return
-	}
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "missing or malformed Authorization header"})
+		respondProblem(w, r, http.StatusUnauthorized, CodeMissingToken, "missing or malformed Authorization header")
 		return
 	}
 
-	rt, err := cfg.DbQueries.GetRefreshToken(r.Context(), token)
-	if err != nil || (rt.RevokedAt.Valid && !rt.RevokedAt.Time.IsZero()) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid refresh token"})
-		return
-	}
-
-	err = cfg.DbQueries.RevokeRefreshToken(r.Context(), token)
+	err = cfg.Auth.Revoke(r.Context(), token)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to revoke refresh token"})
+		respondError(w, r, err)
 		return
 	}
 
@@ -593,21 +365,10 @@ func (cfg *ApiConfig) RevokeRefreshToken(w http.ResponseWriter, r *http.Request)
 
 // ResetHits resets the file server hits counter.
 func (cfg *ApiConfig) ResetHits(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
-		return
-	}
-	if cfg.Platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "forbidden"})
-		return
-	}
-	cfg.FileserverHits.Store(0)
-	err := cfg.DbQueries.DeleteAllUsers(r.Context())
+	cfg.Metrics.AppHits.Reset()
+	err := cfg.Users.DeleteAll(r.Context())
 	if err != nil {
-		slog.Error("DeleteAllUsers failed", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "error deleting users"})
+		respondError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -615,14 +376,22 @@ func (cfg *ApiConfig) ResetHits(w http.ResponseWriter, r *http.Request) {
 }
 
 // FileServerHitsHandler serves the file server hits page.
-func (cfg *ApiConfig) FileServerHitsHandler(w http.ResponseWriter, _ *http.Request) {
+func (cfg *ApiConfig) FileServerHitsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	v := cfg.FileserverHits.Load()
+	data := struct {
+		Hits   float64
+		Events map[string]int64
+	}{Hits: cfg.Metrics.AppHits.Value()}
+	if cfg.EventCounts != nil {
+		data.Events = cfg.EventCounts.Snapshot()
+	}
 	tmpl := `
 		<html>
 			<body>
 				<h1>Welcome, Chirpy Admin</h1>
-				<p>Chirpy has been visited {{.}} times!</p>
+				<p>Chirpy has been visited {{.Hits}} times!</p>
+				{{if .Events}}<h2>Events since startup</h2>
+				<ul>{{range $type, $count := .Events}}<li>{{$type}}: {{$count}}</li>{{end}}</ul>{{end}}
 			</body>
 		</html>
 		`
@@ -630,8 +399,8 @@ func (cfg *ApiConfig) FileServerHitsHandler(w http.ResponseWriter, _ *http.Reque
 	if err != nil {
 		panic(fmt.Sprintf("⚠️ Error parsing template: %v", err))
 	}
-	err = t.Execute(w, v)
+	err = t.Execute(w, data)
 	if err != nil {
-		slog.Error("Error executing template", "error", err)
+		logging.FromContext(r.Context()).Error("Error executing template", "error", err)
 	}
 }
@@ -0,0 +1,704 @@
+package api
+
+import (
+	"bytes"
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/database/memstore"
+	"chirpy/internal/logging"
+	"chirpy/internal/service"
+	"chirpy/internal/webhook"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const testPolkaKey = "test-polka-key"
+
+// testServer is the API wired to an in-memory store, routed like main.go.
+type testServer struct {
+	cfg  *ApiConfig
+	mux  http.Handler
+	logs *bytes.Buffer
+}
+
+func newTestServer(t *testing.T, platform string) *testServer {
+	t.Helper()
+	store := memstore.New()
+	// cheap Argon2id params, the tests hash a lot of passwords
+	hasher := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	cfg := &ApiConfig{
+		Metrics:  NewMetrics(),
+		Store:    store,
+		Platform: platform,
+		PolkaKey: testPolkaKey,
+		Chirps:   service.NewChirpService(store),
+		Users:    service.NewUserService(store, hasher, auth.NewPasswordPolicy(8, 64)),
+		Auth:     service.NewAuthService(store, hasher, service.AuthConfig{JWTSecret: "test-secret"}),
+		// no DNS in tests, internal.example.com is a public name for a private address
+		WebhookResolver: webhook.StaticResolver{
+			"example.com":          {netip.MustParseAddr("93.184.215.14")},
+			"internal.example.com": {netip.MustParseAddr("10.0.0.5")},
+		},
+	}
+	router := NewRouter()
+	cfg.RegisterRoutes(router)
+	cfg.Metrics.TrackActiveSessions(store)
+	router.Handle(http.MethodGet, "/metrics", cfg.Metrics.Registry)
+	var logs bytes.Buffer
+	logger, err := logging.New(&logs, logging.FormatJSON, true)
+	if err != nil {
+		t.Fatalf("logging.New() error = %v", err)
+	}
+	return &testServer{cfg: cfg, mux: logging.Middleware(logger, cfg.Metrics.Middleware(router)), logs: &logs}
+}
+
+// do sends a request with an optional JSON body and bearer token.
+func (s *testServer) do(t *testing.T, method, path, token string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if raw, ok := body.(string); ok {
+			buf.WriteString(raw)
+		} else if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// signup creates a user and logs them in.
+func (s *testServer) signup(t *testing.T, email string) UserResponse {
+	t.Helper()
+	creds := map[string]string{"email": email, "password": "correct horse"}
+	if rec := s.do(t, http.MethodPost, "/api/users", "", creds); rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/users = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	rec := s.do(t, http.MethodPost, "/api/login", "", creds)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /api/login = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	return decode[UserResponse](t, rec)
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+	}{
+		{name: "Valid user", body: map[string]string{"email": "a@example.com", "password": "correct horse"}, wantStatus: http.StatusCreated},
+		{name: "Password too short", body: map[string]string{"email": "a@example.com", "password": "short"}, wantStatus: http.StatusBadRequest},
+		{name: "Malformed JSON", body: "{", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "dev")
+			rec := s.do(t, http.MethodPost, "/api/users", "", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusCreated && strings.Contains(rec.Body.String(), "hashed_password") {
+				t.Errorf("response leaks the password hash: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t, "dev")
+	user := s.signup(t, "a@example.com")
+	if user.Token == "" || user.RefreshToken == "" || user.IsChirpyRed {
+		t.Errorf("login response = %+v, want tokens and no Chirpy Red", user)
+	}
+	tests := []struct {
+		name       string
+		email      string
+		password   string
+		wantStatus int
+	}{
+		{name: "Wrong password", email: "a@example.com", password: "wrong password", wantStatus: http.StatusUnauthorized},
+		{name: "Unknown email", email: "b@example.com", password: "correct horse", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": tt.email, "password": tt.password})
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	s := newTestServer(t, "dev")
+	user := s.signup(t, "a@example.com")
+	steps := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "Refresh with the access token", path: "/api/refresh", token: user.Token, wantStatus: http.StatusUnauthorized},
+		{name: "Refresh", path: "/api/refresh", token: user.RefreshToken, wantStatus: http.StatusOK},
+		{name: "Revoke", path: "/api/revoke", token: user.RefreshToken, wantStatus: http.StatusNoContent},
+		{name: "Refresh after revoke", path: "/api/refresh", token: user.RefreshToken, wantStatus: http.StatusUnauthorized},
+		{name: "Revoke twice", path: "/api/revoke", token: user.RefreshToken, wantStatus: http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		rec := s.do(t, http.MethodPost, step.path, step.token, nil)
+		if rec.Code != step.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", step.name, rec.Code, step.wantStatus, rec.Body)
+		}
+	}
+}
+
+func TestChirps(t *testing.T) {
+	s := newTestServer(t, "dev")
+	alice := s.signup(t, "alice@example.com")
+	bob := s.signup(t, "bob@example.com")
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "Unauthenticated", body: "hello", wantStatus: http.StatusUnauthorized},
+		{name: "Too long", token: alice.Token, body: strings.Repeat("a", 141), wantStatus: http.StatusBadRequest},
+		{name: "Profanity is replaced", token: alice.Token, body: "what a kerfuffle", wantStatus: http.StatusCreated, wantBody: "what a ****"},
+		{name: "Second author", token: bob.Token, body: "hi from bob", wantStatus: http.StatusCreated, wantBody: "hi from bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodPost, "/api/chirps", tt.token, map[string]string{"body": tt.body})
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" {
+				if got := decode[RespBody](t, rec).Body; got != tt.wantBody {
+					t.Errorf("body = %q, want %q", got, tt.wantBody)
+				}
+			}
+		})
+	}
+
+	t.Run("List by author", func(t *testing.T) {
+		rec := s.do(t, http.MethodGet, "/api/chirps?author_id="+bob.ID.String(), "", nil)
+		chirps := decode[[]RespBody](t, rec)
+		if rec.Code != http.StatusOK || len(chirps) != 1 || chirps[0].Body != "hi from bob" {
+			t.Errorf("GET /api/chirps?author_id = %d %+v, want bob's chirp", rec.Code, chirps)
+		}
+	})
+	t.Run("List descending", func(t *testing.T) {
+		rec := s.do(t, http.MethodGet, "/api/chirps?sort=desc", "", nil)
+		chirps := decode[[]RespBody](t, rec)
+		if len(chirps) != 2 || chirps[0].Body != "hi from bob" {
+			t.Errorf("GET /api/chirps?sort=desc = %+v, want newest first", chirps)
+		}
+	})
+
+	rec := s.do(t, http.MethodGet, "/api/chirps?author_id="+alice.ID.String(), "", nil)
+	chirpPath := "/api/chirps/" + decode[[]struct {
+		ID string `json:"id"`
+	}](t, rec)[0].ID
+	deletes := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "Delete someone else's chirp", token: bob.Token, wantStatus: http.StatusForbidden},
+		{name: "Delete own chirp", token: alice.Token, wantStatus: http.StatusNoContent},
+		{name: "Delete it again", token: alice.Token, wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range deletes {
+		rec := s.do(t, http.MethodDelete, chirpPath, tt.token, nil)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.wantStatus, rec.Body)
+		}
+	}
+	if rec := s.do(t, http.MethodGet, chirpPath, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted chirp = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestListChirpsQuery(t *testing.T) {
+	s := newTestServer(t, "dev")
+	alice := s.signup(t, "alice@example.com")
+	for _, body := range []string{"learning #go", "hello world"} {
+		if rec := s.do(t, http.MethodPost, "/api/chirps", alice.Token, map[string]string{"body": body}); rec.Code != http.StatusCreated {
+			t.Fatalf("POST /api/chirps = %d: %s", rec.Code, rec.Body)
+		}
+	}
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBodies string
+		wantFields string
+	}{
+		{name: "Hashtag", query: "?hashtag=%23go", wantStatus: http.StatusOK, wantBodies: "learning #go"},
+		{name: "Search and author", query: "?search=WORLD&author_id=" + alice.ID.String(), wantStatus: http.StatusOK, wantBodies: "hello world"},
+		{name: "Time range", query: "?since=2000-01-01T00:00:00Z&until=2100-01-01T00:00:00Z&sort=desc", wantStatus: http.StatusOK, wantBodies: "hello world,learning #go"},
+		{name: "Bad author ID is one 400", query: "?author_id=nope", wantStatus: http.StatusBadRequest, wantFields: "author_id"},
+		{name: "Every unparseable parameter is reported", query: "?since=yesterday&sort=sideways&hashtag=no+spaces", wantStatus: http.StatusBadRequest, wantFields: "since,sort"},
+		{name: "Filters are checked together", query: "?since=2100-01-01T00:00:00Z&until=2000-01-01T00:00:00Z", wantStatus: http.StatusBadRequest, wantFields: "until"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodGet, "/api/chirps"+tt.query, "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				// a handler that carries on after an error appends a second body
+				if err := json.Unmarshal(rec.Body.Bytes(), &Problem{}); err != nil {
+					t.Fatalf("body is not a single problem: %s", rec.Body)
+				}
+				var fields []string
+				for _, fe := range decode[Problem](t, rec).Errors {
+					fields = append(fields, fe.Field)
+				}
+				if got := strings.Join(fields, ","); got != tt.wantFields {
+					t.Errorf("field errors = %s, want %s", got, tt.wantFields)
+				}
+				return
+			}
+			var got []string
+			for _, c := range decode[[]RespBody](t, rec) {
+				got = append(got, c.Body)
+			}
+			if strings.Join(got, ",") != tt.wantBodies {
+				t.Errorf("chirps = %v, want %s", got, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestChirpResponseShape(t *testing.T) {
+	s := newTestServer(t, "dev")
+	alice := s.signup(t, "alice@example.com")
+	rec := s.do(t, http.MethodPost, "/api/chirps", alice.Token, map[string]string{"body": "hello"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/chirps = %d: %s", rec.Code, rec.Body)
+	}
+	chirp := decode[ChirpResponse](t, rec)
+	if chirp.Links.Self != "/api/v1/chirps/"+chirp.ID.String() || chirp.Author != nil {
+		t.Errorf("created chirp = %+v, want its links and no author", chirp)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantKeys   string
+		wantFields string
+	}{
+		{name: "Every field by default", path: "/api/chirps/" + chirp.ID.String(), wantStatus: http.StatusOK, wantKeys: "body,created_at,id,links,updated_at,user_id"},
+		{name: "Include author", path: "/api/chirps/" + chirp.ID.String() + "?include=author", wantStatus: http.StatusOK, wantKeys: "author,body,created_at,id,links,updated_at,user_id"},
+		{name: "Select fields", path: "/api/chirps/" + chirp.ID.String() + "?fields=id,%20body", wantStatus: http.StatusOK, wantKeys: "body,id"},
+		{name: "Select fields of a list", path: "/api/chirps?fields=id&include=author", wantStatus: http.StatusOK, wantKeys: "id"},
+		{name: "Select an included author", path: "/api/chirps?fields=author&include=author", wantStatus: http.StatusOK, wantKeys: "author"},
+		{name: "Unknown field and include", path: "/api/chirps?fields=id,password&include=replies", wantStatus: http.StatusBadRequest, wantFields: "fields,include"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodGet, tt.path, "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				var fields []string
+				for _, fe := range decode[Problem](t, rec).Errors {
+					fields = append(fields, fe.Field)
+				}
+				if got := strings.Join(fields, ","); got != tt.wantFields {
+					t.Errorf("field errors = %s, want %s", got, tt.wantFields)
+				}
+				return
+			}
+			var got map[string]json.RawMessage
+			if strings.HasPrefix(rec.Body.String(), "[") {
+				got = decode[[]map[string]json.RawMessage](t, rec)[0]
+			} else {
+				got = decode[map[string]json.RawMessage](t, rec)
+			}
+			keys := slices.Sorted(maps.Keys(got))
+			if strings.Join(keys, ",") != tt.wantKeys {
+				t.Errorf("keys = %v, want %s", keys, tt.wantKeys)
+			}
+			if author, ok := got["author"]; ok && !strings.Contains(string(author), alice.ID.String()) {
+				t.Errorf("author = %s, want alice", author)
+			}
+		})
+	}
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	s := newTestServer(t, "dev")
+	user := s.signup(t, "a@example.com")
+	body := `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`
+	send := func(signature string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(body))
+		req.Header.Set(polkaSignatureHeader, signature)
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	signed := webhook.SignatureHeader(testPolkaKey, time.Now(), []byte(body))
+
+	tests := []struct {
+		name       string
+		signature  string
+		wantStatus int
+	}{
+		{name: "Unsigned", signature: "", wantStatus: http.StatusUnauthorized},
+		{name: "Wrong key", signature: webhook.SignatureHeader("wrong", time.Now(), []byte(body)), wantStatus: http.StatusUnauthorized},
+		{name: "Signed", signature: signed, wantStatus: http.StatusNoContent},
+		{name: "Retried", signature: signed, wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := send(tt.signature); got != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.wantStatus)
+		}
+	}
+
+	rec := s.do(t, http.MethodGet, "/api/subscription", user.Token, nil)
+	if sub := decode[SubscriptionResponse](t, rec); rec.Code != http.StatusOK || !sub.Active {
+		t.Errorf("GET /api/subscription = %d %+v, want an active subscription", rec.Code, sub)
+	}
+	relogin := s.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "a@example.com", "password": "correct horse"})
+	if got := decode[UserResponse](t, relogin); !got.IsChirpyRed {
+		t.Errorf("login after upgrade IsChirpyRed = false, want true")
+	}
+}
+
+// TestPolkaWebhookAPIKey covers the rollout to signatures, when Polka may still
+// send its key in an "Authorization: ApiKey" header.
+func TestPolkaWebhookAPIKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		acceptAPIKey bool
+		header       string
+		wantStatus   int
+	}{
+		{name: "Accepted during the rollout", acceptAPIKey: true, header: "ApiKey " + testPolkaKey, wantStatus: http.StatusNoContent},
+		{name: "Wrong key", acceptAPIKey: true, header: "ApiKey wrong", wantStatus: http.StatusUnauthorized},
+		{name: "Bearer instead of ApiKey", acceptAPIKey: true, header: "Bearer " + testPolkaKey, wantStatus: http.StatusUnauthorized},
+		{name: "Refused after the rollout", acceptAPIKey: false, header: "ApiKey " + testPolkaKey, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "dev")
+			s.cfg.PolkaAcceptAPIKey = tt.acceptAPIKey
+			user := s.signup(t, "a@example.com")
+			body := `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + user.ID.String() + `"}}`
+			req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", strings.NewReader(body))
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	s := newTestServer(t, "dev")
+	alice := s.signup(t, "alice@example.com")
+	bob := s.signup(t, "bob@example.com")
+	tests := []struct {
+		name       string
+		body       any
+		wantStatus int
+	}{
+		{name: "Relative URL", body: map[string]any{"url": "/hook", "events": []string{"chirp.created"}}, wantStatus: http.StatusBadRequest},
+		{name: "No events", body: map[string]any{"url": "https://example.com/hook"}, wantStatus: http.StatusBadRequest},
+		{name: "Unknown event", body: map[string]any{"url": "https://example.com/hook", "events": []string{"chirp.liked"}}, wantStatus: http.StatusBadRequest},
+		{name: "Loopback", body: map[string]any{"url": "http://127.0.0.1/hook", "events": []string{"chirp.created"}}, wantStatus: http.StatusBadRequest},
+		{name: "Cloud metadata", body: map[string]any{"url": "http://169.254.169.254/latest/meta-data/", "events": []string{"chirp.created"}}, wantStatus: http.StatusBadRequest},
+		{name: "Name for a private address", body: map[string]any{"url": "https://internal.example.com/hook", "events": []string{"chirp.created"}}, wantStatus: http.StatusBadRequest},
+		{name: "Host that doesn't resolve", body: map[string]any{"url": "https://nowhere.example.com/hook", "events": []string{"chirp.created"}}, wantStatus: http.StatusBadRequest},
+		{name: "Valid", body: map[string]any{"url": "https://example.com/hook", "events": []string{"chirp.created"}}, wantStatus: http.StatusCreated},
+	}
+	var created WebhookResponse
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, http.MethodPost, "/api/webhooks", alice.Token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusCreated {
+				created = decode[WebhookResponse](t, rec)
+				if created.Secret == "" {
+					t.Errorf("created webhook has no secret")
+				}
+			}
+		})
+	}
+
+	rec := s.do(t, http.MethodGet, "/api/webhooks", alice.Token, nil)
+	if hooks := decode[[]WebhookResponse](t, rec); len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Errorf("GET /api/webhooks = %+v, want one webhook without its secret", hooks)
+	}
+	if rec := s.do(t, http.MethodDelete, "/api/webhooks/"+created.ID.String(), bob.Token, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("deleting someone else's webhook = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := s.do(t, http.MethodDelete, "/api/webhooks/"+created.ID.String(), alice.Token, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("deleting own webhook = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+}
+
+func TestResetHits(t *testing.T) {
+	tests := []struct {
+		name       string
+		platform   string
+		wantStatus int
+		wantUsers  bool
+	}{
+		{name: "Dev resets", platform: "dev", wantStatus: http.StatusOK, wantUsers: false},
+		{name: "Forbidden outside dev", platform: "prod", wantStatus: http.StatusForbidden, wantUsers: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.platform)
+			s.signup(t, "a@example.com")
+			rec := s.do(t, http.MethodPost, "/admin/reset", "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			login := s.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "a@example.com", "password": "correct horse"})
+			if gotUsers := login.Code == http.StatusOK; gotUsers != tt.wantUsers {
+				t.Errorf("user still exists = %v, want %v", gotUsers, tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	const adminKey = "0e5a4a1b7f6c43d2a9b8e1f0c7d6b5a4"
+	tests := []struct {
+		name       string
+		platform   string
+		adminKey   string
+		header     string
+		wantStatus int
+	}{
+		{name: "Admin key outside dev", platform: "prod", adminKey: adminKey, header: "ApiKey " + adminKey, wantStatus: http.StatusCreated},
+		{name: "Wrong key", platform: "prod", adminKey: adminKey, header: "ApiKey wrong", wantStatus: http.StatusUnauthorized},
+		{name: "No key on dev", platform: "dev", adminKey: adminKey, wantStatus: http.StatusUnauthorized},
+		{name: "No admin key configured", platform: "dev", header: "ApiKey " + adminKey, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.platform)
+			s.cfg.AdminAPIKey = tt.adminKey
+			body := `{"url":"https://example.com/hook","events":["chirp.created"]}`
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("POST /admin/webhooks = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusCreated {
+				return
+			}
+			created := decode[WebhookResponse](t, rec)
+			req = httptest.NewRequest(http.MethodGet, "/admin/webhooks/"+created.ID.String()+"/deliveries", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET deliveries = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := newTestServer(t, "dev")
+	user := s.signup(t, "a@example.com")
+	s.do(t, http.MethodPost, "/api/login", "", map[string]string{"email": "a@example.com", "password": "wrong password"})
+	s.do(t, http.MethodPost, "/api/chirps", user.Token, map[string]string{"body": "hello"})
+
+	rec := s.do(t, http.MethodGet, "/metrics", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for _, line := range []string{
+		"chirpy_users_created_total 1",
+		"chirpy_logins_failed_total 1",
+		"chirpy_chirps_created_total 1",
+		"chirpy_active_sessions 1",
+		`chirpy_http_requests_total{method="POST",route="/api/login",status="401"} 1`,
+		`chirpy_http_requests_total{method="POST",route="/api/chirps",status="201"} 1`,
+		`chirpy_http_request_duration_seconds_count{method="POST",route="/api/users",status="201"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("GET /metrics is missing %q:\n%s", line, rec.Body)
+		}
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	s := newTestServer(t, "dev")
+	user := s.signup(t, "a@example.com")
+	rec := s.do(t, http.MethodPost, "/api/chirps", user.Token, map[string]string{"body": "my secret chirp"})
+	if rec.Header().Get(logging.RequestIDHeader) == "" {
+		t.Errorf("response has no %s", logging.RequestIDHeader)
+	}
+	logs := s.logs.String()
+	for _, pii := range []string{"a@example.com", "my secret chirp"} {
+		if strings.Contains(logs, pii) {
+			t.Errorf("logs contain %q:\n%s", pii, logs)
+		}
+	}
+	if !strings.Contains(logs, `"route":"/api/chirps","status":201,`) || !strings.Contains(logs, `"user_id":"`+user.ID.String()+`"`) {
+		t.Errorf("logs have no request line for the chirp with its user:\n%s", logs)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	s := newTestServer(t, "prod")
+	owner := s.signup(t, "owner@example.com")
+	other := s.signup(t, "other@example.com")
+	chirp := decode[database.Chirp](t, s.do(t, http.MethodPost, "/api/chirps", owner.Token, map[string]string{"body": "hello"}))
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       any
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "Malformed JSON", method: http.MethodPost, path: "/api/users", body: "{", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidBody},
+		{name: "Validation", method: http.MethodPost, path: "/api/users", body: map[string]string{"email": "b@example.com", "password": "short"}, wantStatus: http.StatusBadRequest, wantCode: service.CodeValidationFailed},
+		{name: "Bad credentials", method: http.MethodPost, path: "/api/login", body: map[string]string{"email": "owner@example.com", "password": "wrong"}, wantStatus: http.StatusUnauthorized, wantCode: "invalid_credentials"},
+		{name: "No token", method: http.MethodPost, path: "/api/chirps", body: map[string]string{"body": "hi"}, wantStatus: http.StatusUnauthorized, wantCode: CodeMissingToken},
+		{name: "Bad token", method: http.MethodPost, path: "/api/chirps", token: "nope", body: map[string]string{"body": "hi"}, wantStatus: http.StatusUnauthorized, wantCode: "invalid_access_token"},
+		{name: "Bad chirp ID", method: http.MethodGet, path: "/api/chirps/nope", wantStatus: http.StatusBadRequest, wantCode: CodeInvalidID},
+		{name: "Missing chirp", method: http.MethodGet, path: "/api/chirps/" + uuid.NewString(), wantStatus: http.StatusNotFound, wantCode: "chirp_not_found"},
+		{name: "Someone else's chirp", method: http.MethodDelete, path: "/api/chirps/" + chirp.ID.String(), token: other.Token, wantStatus: http.StatusForbidden, wantCode: "not_chirp_owner"},
+		{name: "Admin outside dev", method: http.MethodPost, path: "/admin/reset", wantStatus: http.StatusForbidden, wantCode: CodeForbidden},
+		{name: "Wrong method", method: http.MethodDelete, path: "/api/users", wantStatus: http.StatusMethodNotAllowed, wantCode: CodeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(t, tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+			p := decode[Problem](t, rec)
+			if p.Code != tt.wantCode || p.Status != tt.wantStatus || p.Title != http.StatusText(tt.wantStatus) || p.Instance != tt.path {
+				t.Errorf("problem = %+v, want code %q, status %d and instance %q", p, tt.wantCode, tt.wantStatus, tt.path)
+			}
+			if p.RequestID == "" || p.RequestID != rec.Header().Get(logging.RequestIDHeader) {
+				t.Errorf("problem request_id = %q, want the X-Request-ID header %q", p.RequestID, rec.Header().Get(logging.RequestIDHeader))
+			}
+		})
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "Validation", err: &service.ValidationError{Msg: "chirp is too long"}, wantStatus: http.StatusBadRequest, wantCode: service.CodeValidationFailed, wantDetail: "chirp is too long"},
+		{name: "Wrapped service error", err: fmt.Errorf("deleting: %w", service.ErrNoSubscription), wantStatus: http.StatusNotFound, wantCode: "no_subscription", wantDetail: "no subscription"},
+		{name: "Unexpected error is hidden", err: errors.New("pq: connection refused"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantDetail: "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			respondError(rec, httptest.NewRequest(http.MethodGet, "/api/x", nil), tt.err)
+			p := decode[Problem](t, rec)
+			if rec.Code != tt.wantStatus || p.Code != tt.wantCode || p.Detail != tt.wantDetail {
+				t.Errorf("respondError() = %d %+v, want %d, code %q and detail %q", rec.Code, p, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+		wantFields  []string
+	}{
+		{name: "Valid", contentType: "application/json; charset=utf-8", body: `{"email":"a@example.com","password":"correct horse"}`, wantStatus: http.StatusCreated},
+		{name: "Not JSON", contentType: "application/x-www-form-urlencoded", body: "email=a@example.com", wantStatus: http.StatusUnsupportedMediaType, wantCode: CodeUnsupportedMedia},
+		{name: "No Content-Type", body: `{"email":"a@example.com","password":"correct horse"}`, wantStatus: http.StatusUnsupportedMediaType, wantCode: CodeUnsupportedMedia},
+		{name: "Unknown field", contentType: "application/json", body: `{"email":"a@example.com","password":"correct horse","admin":true}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidBody},
+		{name: "Trailing garbage", contentType: "application/json", body: `{"email":"a@example.com","password":"correct horse"} {}`, wantStatus: http.StatusBadRequest, wantCode: CodeInvalidBody},
+		{name: "Too large", contentType: "application/json", body: `{"email":"` + strings.Repeat("a", maxRequestBodyBytes) + `"}`, wantStatus: http.StatusRequestEntityTooLarge, wantCode: CodeBodyTooLarge},
+		{name: "Every failing field is listed", contentType: "application/json", body: `{"email":"not an email"}`, wantStatus: http.StatusBadRequest, wantCode: service.CodeValidationFailed, wantFields: []string{"email", "password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, "dev")
+			req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			p := decode[Problem](t, rec)
+			var fields []string
+			for _, fe := range p.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if p.Code != tt.wantCode || strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("problem = %+v, want code %q and field errors for %v", p, tt.wantCode, tt.wantFields)
+			}
+		})
+	}
+}
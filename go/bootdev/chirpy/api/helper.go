@@ -1,21 +1,215 @@
 package api
 
 import (
+	"chirpy/internal/auth"
+	"chirpy/internal/logging"
+	"chirpy/internal/service"
+	"chirpy/internal/validate"
+	"encoding/json"
 	"errors"
-	"regexp"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// problemContentType is the RFC 7807 media type every error response is served as.
+const problemContentType = "application/problem+json"
+
+// maxRequestBodyBytes caps every JSON request body decodeJSON reads.
+const maxRequestBodyBytes = 1 << 20
+
+// Codes for errors the handlers raise themselves, the service layer's come
+// from service.Error.Code.
+const (
+	CodeInvalidBody      = "invalid_body"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeInvalidID        = "invalid_id"
+	CodeMissingToken     = "missing_token"
+	CodeInvalidSignature = "invalid_signature"
+	CodeInvalidAdminKey  = "invalid_admin_key"
+	CodeForbidden        = "forbidden"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeWebhookNotFound  = "webhook_not_found"
+	CodeNotWebhookOwner  = "not_webhook_owner"
+	CodeEventNotFound    = "event_not_found"
+	CodeInternal         = "internal_error"
 )
 
-func (cfg *ApiConfig) SteralizeChirp(body string) (string, error) {
-	// check length
-	if len(body) > 140 {
-		return "", errors.New("chirp is too long")
+// statusByKind is the one place service errors become HTTP statuses.
+var statusByKind = map[service.Kind]int{
+	service.KindInvalid:            http.StatusBadRequest,
+	service.KindUnauthenticated:    http.StatusUnauthorized,
+	service.KindForbidden:          http.StatusForbidden,
+	service.KindNotFound:           http.StatusNotFound,
+	service.KindPreconditionFailed: http.StatusPreconditionFailed,
+}
+
+// respondJSON writes v as the JSON body of a status response.
+func respondJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// respondProblem writes an application/problem+json response for an error the
+// handler found itself.
+func respondProblem(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	writeProblem(w, newProblem(r, status, code, detail))
+}
+
+func newProblem(r *http.Request, status int, code, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: logging.RequestID(r.Context()),
 	}
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// decodeJSON reads the request body into a T and checks it against T's
+// validate tags. The body must be sent as application/json, fit in
+// maxRequestBodyBytes and hold exactly one JSON value with no fields T doesn't
+// have. On failure it writes the problem response and returns false.
+func decodeJSON[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	var v T
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondProblem(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMedia, "Content-Type must be application/json")
+		return v, false
+	}
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	d.DisallowUnknownFields()
+	err = d.Decode(&v)
+	// anything after the first value is garbage
+	if err == nil && d.Decode(&json.RawMessage{}) != io.EOF {
+		err = errors.New("body must hold a single JSON value")
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body is too large")
+		return v, false
+	}
+	if err != nil {
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Error decoding request body: "+strings.TrimPrefix(err.Error(), "json: "))
+		return v, false
+	}
+	fieldErrs := validate.Struct(&v)
+	if len(fieldErrs) > 0 {
+		respondError(w, r, &service.ValidationError{Msg: "request body failed validation", Fields: fieldErrs})
+		return v, false
+	}
+	return v, true
+}
+
+// respondError writes the problem response for an error from the service layer.
+// Anything that isn't a service.Error or service.ValidationError is unexpected,
+// it's logged and the client only gets a 500.
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *service.ValidationError
+	if errors.As(err, &verr) {
+		p := newProblem(r, http.StatusBadRequest, service.CodeValidationFailed, verr.Msg)
+		p.Errors = verr.Fields
+		writeProblem(w, p)
+		return
+	}
+	var serr *service.Error
+	if errors.As(err, &serr) {
+		status, ok := statusByKind[serr.Kind]
+		if ok {
+			respondProblem(w, r, status, serr.Code, serr.Msg)
+			return
+		}
+	}
+	logging.FromContext(r.Context()).Error("⚠️ request failed", "error", err)
+	respondProblem(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// authenticatedUserID validates the bearer JWT and returns the user ID. On failure
+// it writes the 401 response and returns false.
+func (cfg *ApiConfig) authenticatedUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondProblem(w, r, http.StatusUnauthorized, CodeMissingToken, "missing or malformed Authorization header")
+		return uuid.Nil, false
+	}
+	userID, err := cfg.Auth.Authenticate(token)
+	if err != nil {
+		respondError(w, r, err)
+		return uuid.Nil, false
+	}
+	logging.SetUserID(r.Context(), userID.String())
+	return userID, true
+}
+
+func newUserResponse(user service.User) UserResponse {
+	return UserResponse{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+// selectFields is v with only the named top level JSON fields, v itself when
+// fields is empty.
+func selectFields(v any, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return v, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(raw, &all)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// jsonFieldNames is the JSON name of every field of v's struct type.
+func jsonFieldNames(v any) []string {
+	t := reflect.TypeOf(v)
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-	// handle dirty words
-	dirtyWords := []string{"kerfuffle", "sharbert", "fornax"}
-	for _, word := range dirtyWords {
-		re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(word))
-		body = re.ReplaceAllString(body, "****")
+// splitList splits a comma separated query parameter, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
 	}
-	return body, nil
+	return items
 }
@@ -1,16 +1,63 @@
 package api
 
 import (
-	"log/slog"
+	"chirpy/internal/database"
+	"chirpy/internal/metrics"
+	"context"
 	"net/http"
+	"time"
 )
 
+// Metrics is everything chirpy exports on /metrics.
+type Metrics struct {
+	Registry        *metrics.Registry
+	Requests        *metrics.Counter
+	RequestDuration *metrics.Histogram
+	QueryDuration   *metrics.Histogram
+	AppHits         *metrics.Counter
+	ChirpsCreated   *metrics.Counter
+	UsersCreated    *metrics.Counter
+	LoginsFailed    *metrics.Counter
+}
+
+// NewMetrics registers chirpy's metrics on a fresh registry.
+func NewMetrics() *Metrics {
+	r := metrics.NewRegistry()
+	return &Metrics{
+		Registry:        r,
+		Requests:        r.NewCounter("chirpy_http_requests_total", "HTTP requests by method, route and status.", "method", "route", "status"),
+		RequestDuration: r.NewHistogram("chirpy_http_request_duration_seconds", "HTTP request latency by method, route and status.", metrics.DefBuckets, "method", "route", "status"),
+		QueryDuration:   r.NewHistogram("chirpy_db_query_duration_seconds", "Database query latency by sqlc query name.", metrics.DefBuckets, "query"),
+		AppHits:         r.NewCounter("chirpy_app_hits_total", "Requests for the /app/ file server."),
+		ChirpsCreated:   r.NewCounter("chirpy_chirps_created_total", "Chirps posted."),
+		UsersCreated:    r.NewCounter("chirpy_users_created_total", "Users signed up."),
+		LoginsFailed:    r.NewCounter("chirpy_logins_failed_total", "Logins rejected for a wrong email or password."),
+	}
+}
+
+// ObserveQuery is the database.QueryObserver to give the store.
+func (m *Metrics) ObserveQuery(query string, elapsed time.Duration) {
+	m.QueryDuration.Observe(elapsed.Seconds(), query)
+}
+
+// TrackActiveSessions exports the number of live refresh tokens, counted on
+// every scrape.
+func (m *Metrics) TrackActiveSessions(store database.Store) {
+	m.Registry.NewGaugeFunc("chirpy_active_sessions", "Refresh tokens neither revoked nor expired.", func(ctx context.Context) (float64, error) {
+		n, err := store.CountActiveRefreshTokens(ctx)
+		return float64(n), err
+	})
+}
+
+// Middleware counts and times every request.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return metrics.Instrument(next, m.Requests, m.RequestDuration)
+}
+
+// MiddlewareMetricsInc counts hits on the file server.
 func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
-	slog.Info("󰊕 middlewareMetricsInc called")
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileserverHits.Add(1)
-		hit := cfg.FileserverHits.Load()
-		slog.Info("󰊕 middlewareMetricsInc hit", "hit", hit)
+		cfg.Metrics.AppHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
@@ -2,7 +2,10 @@ package api
 
 import (
 	"chirpy/internal/database"
-	"sync/atomic"
+	"chirpy/internal/events"
+	"chirpy/internal/service"
+	"chirpy/internal/validate"
+	"chirpy/internal/webhook"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,18 +16,76 @@ type RespBody struct {
 	Body string `json:"body"`
 }
 
-// ErrorResponse is a simple struct to hold error messages.
-type ErrorResponse struct {
-	Error string `json:"error"`
+// Problem is an RFC 7807 error response. Code is stable and machine readable,
+// clients should switch on it rather than on Detail. Errors lists every field
+// that failed validation.
+type Problem struct {
+	Type      string                `json:"type"`
+	Title     string                `json:"title"`
+	Status    int                   `json:"status"`
+	Detail    string                `json:"detail,omitempty"`
+	Instance  string                `json:"instance,omitempty"`
+	Code      string                `json:"code"`
+	RequestID string                `json:"request_id,omitempty"`
+	Errors    []validate.FieldError `json:"errors,omitempty"`
 }
 
-// ApiConfig holds the configuration for the API, including the file server hits counter
+// ApiConfig holds the configuration for the API, including its metrics
 type ApiConfig struct {
-	FileserverHits atomic.Int32
-	DbQueries      *database.Queries
-	Platform       string
-	JWTSecret      string
-	PolkaKey       string
+	Metrics  *Metrics
+	Store    database.Store
+	Platform string
+	PolkaKey string
+	// PolkaAcceptAPIKey lets Polka webhooks authenticate with the Polka key in
+	// an "Authorization: ApiKey" header instead of a signature, for the rollout.
+	PolkaAcceptAPIKey bool
+	// AdminAPIKey authenticates the admin routes behind RequireAdmin, empty
+	// turns them off.
+	AdminAPIKey string
+	Chirps      service.ChirpService
+	Users       service.UserService
+	Auth        service.AuthService
+	EventCounts *events.Counter
+	// WebhookResolver resolves webhook hosts at registration, nil is
+	// net.DefaultResolver.
+	WebhookResolver webhook.Resolver
+}
+
+// loginRequest is the body of POST /api/login.
+type loginRequest struct {
+	// no email rule, accounts made before emails were checked can still log in
+	Email        string `json:"email" validate:"required"`
+	Password     string `json:"password" validate:"required"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// createUserRequest is the body of POST /api/users.
+type createUserRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+}
+
+// updateUserRequest is the body of PUT /api/users.
+type updateUserRequest struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+}
+
+// createChirpRequest is the body of POST /api/chirps, the service checks the
+// length since it knows the limit.
+type createChirpRequest struct {
+	Body string `json:"body" validate:"required"`
+}
+
+// createWebhookRequest is the body of POST /api/webhooks and /admin/webhooks.
+type createWebhookRequest struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Events []string `json:"events" validate:"required"`
+}
+
+// TokenResponse is a struct that represents a freshly issued access token.
+type TokenResponse struct {
+	Token string `json:"token"`
 }
 
 // UserResponse is a struct that represents a user response.
@@ -37,3 +98,62 @@ type UserResponse struct {
 	RefreshToken string    `json:"refresh_token,omitempty"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
 }
+
+// ChirpResponse is a struct that represents a chirp. Author is only set when
+// the request asks for it with ?include=author.
+type ChirpResponse struct {
+	ID        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Body      string         `json:"body"`
+	UserID    uuid.UUID      `json:"user_id"`
+	Author    *AuthorSummary `json:"author,omitempty"`
+	Links     ChirpLinks     `json:"links"`
+}
+
+// AuthorSummary is the public part of a chirp's author, chirps are public so
+// there's no email.
+type AuthorSummary struct {
+	ID          uuid.UUID `json:"id"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// ChirpLinks are the URLs of a chirp and of its author's chirps.
+type ChirpLinks struct {
+	Self         string `json:"self"`
+	AuthorChirps string `json:"author_chirps"`
+}
+
+// SubscriptionResponse is a struct that represents a user's subscription.
+type SubscriptionResponse struct {
+	Plan              string     `json:"plan"`
+	Status            string     `json:"status"`
+	Active            bool       `json:"active"`
+	CurrentPeriodEnd  time.Time  `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CanceledAt        *time.Time `json:"canceled_at,omitempty"`
+}
+
+// WebhookResponse is a struct that represents an outbound webhook registration.
+// Secret is only set in the response to the request that created it.
+type WebhookResponse struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResponse is a struct that represents one entry of a webhook's delivery log.
+type WebhookDeliveryResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode *int32     `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
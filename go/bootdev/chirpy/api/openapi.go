@@ -0,0 +1,371 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Operation documents one route for the OpenAPI spec. Request and Response are
+// values of the body types, nil when there's no body, their schemas come from
+// the types' json and validate tags. ContentType is the response's, JSON when
+// empty. Security names one of securitySchemes, empty for public routes.
+type Operation struct {
+	Summary     string
+	Tag         string
+	Security    string
+	Path        []Param
+	Query       []Param
+	Request     any
+	Status      int
+	Response    any
+	ContentType string
+}
+
+// Param documents a path or query parameter. Format is the JSON schema format
+// of its string value, e.g. "uuid".
+type Param struct {
+	Name        string
+	Description string
+	Format      string
+}
+
+// securitySchemes are the ways a route can be authenticated.
+var securitySchemes = map[string]securityScheme{
+	"accessToken":    {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "access token from POST /api/login"},
+	"refreshToken":   {Type: "http", Scheme: "bearer", Description: "refresh token from POST /api/login"},
+	"polkaSignature": {Type: "apiKey", In: "header", Name: polkaSignatureHeader, Description: "t=<unix>,v1=<hex HMAC-SHA256 of t.body> signed with the Polka key"},
+	"adminKey":       {Type: "apiKey", In: "header", Name: "Authorization", Description: "ApiKey <ADMIN_API_KEY>"},
+}
+
+type openAPISpec struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*schema        `json:"schemas"`
+	Responses       map[string]openAPIBody    `json:"responses"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type openAPIOperation struct {
+	Summary     string                 `json:"summary"`
+	Tags        []string               `json:"tags,omitempty"`
+	OperationID string                 `json:"operationId"`
+	Parameters  []openAPIParameter     `json:"parameters,omitempty"`
+	RequestBody *openAPIBody           `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIBody `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+// openAPIBody is a request body or a response, or a $ref to a shared response.
+type openAPIBody struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Required    bool                        `json:"required,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type securityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// schema is the JSON schema subset the API's types need.
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var pathParamRe = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// buildOpenAPI builds the OpenAPI 3.1 spec of every route in routes that docs
+// documents, keyed like the mux patterns, "METHOD /path". Routes without an
+// entry, the probes and static files, are left out.
+func buildOpenAPI(routes []Route, docs map[string]Operation) *openAPISpec {
+	g := &schemaGen{schemas: map[string]*schema{}, types: map[string]reflect.Type{}}
+	spec := &openAPISpec{
+		OpenAPI: "3.1.0",
+		Info:    openAPIInfo{Title: "Chirpy API", Version: "1.0.0"},
+		Paths:   map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{
+			Schemas: g.schemas,
+			Responses: map[string]openAPIBody{
+				// every error is a problem, so every operation's default response is one
+				"Problem": {Description: "RFC 7807 problem, switch on its code", Content: map[string]openAPIMediaType{
+					problemContentType: {Schema: g.schemaOf(reflect.TypeOf(Problem{}))},
+				}},
+			},
+			SecuritySchemes: securitySchemes,
+		},
+	}
+	for _, route := range routes {
+		doc, ok := docs[route.Method+" "+route.Path]
+		if !ok {
+			continue
+		}
+		if spec.Paths[route.Path] == nil {
+			spec.Paths[route.Path] = map[string]*openAPIOperation{}
+		}
+		spec.Paths[route.Path][strings.ToLower(route.Method)] = g.operation(route, doc)
+	}
+	return spec
+}
+
+func (g *schemaGen) operation(route Route, doc Operation) *openAPIOperation {
+	op := &openAPIOperation{
+		Summary:     doc.Summary,
+		OperationID: operationID(route.Method, route.Path),
+		Responses:   map[string]openAPIBody{"default": {Ref: "#/components/responses/Problem"}},
+	}
+	if doc.Tag != "" {
+		op.Tags = []string{doc.Tag}
+	}
+	for _, m := range pathParamRe.FindAllStringSubmatch(route.Path, -1) {
+		p := Param{Name: m[1]}
+		for _, documented := range doc.Path {
+			if documented.Name == p.Name {
+				p = documented
+			}
+		}
+		op.Parameters = append(op.Parameters, openAPIParameter{Name: p.Name, In: "path", Description: p.Description, Required: true, Schema: &schema{Type: "string", Format: p.Format}})
+	}
+	for _, p := range doc.Query {
+		op.Parameters = append(op.Parameters, openAPIParameter{Name: p.Name, In: "query", Description: p.Description, Schema: &schema{Type: "string", Format: p.Format}})
+	}
+	if doc.Request != nil {
+		op.RequestBody = &openAPIBody{Required: true, Content: map[string]openAPIMediaType{
+			"application/json": {Schema: g.schemaOf(reflect.TypeOf(doc.Request))},
+		}}
+	}
+	status := doc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := openAPIBody{Description: http.StatusText(status)}
+	if doc.Response != nil {
+		contentType := doc.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		resp.Content = map[string]openAPIMediaType{contentType: {Schema: g.schemaOf(reflect.TypeOf(doc.Response))}}
+	}
+	op.Responses[strconv.Itoa(status)] = resp
+	if doc.Security != "" {
+		if _, ok := securitySchemes[doc.Security]; !ok {
+			panic(fmt.Sprintf("openapi: %s %s: unknown security scheme %q", route.Method, route.Path, doc.Security))
+		}
+		op.Security = []map[string][]string{{doc.Security: {}}}
+	}
+	return op
+}
+
+// operationID is the method and the path's literal segments, camel cased, e.g.
+// "getApiChirpsByChirpID".
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range strings.Split(path, "/") {
+		if m := pathParamRe.FindStringSubmatch(seg); m != nil {
+			b.WriteString("By" + exported(m[1]))
+			continue
+		}
+		for _, word := range strings.FieldsFunc(seg, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(exported(word))
+		}
+	}
+	return b.String()
+}
+
+// schemaGen turns Go types into schemas, named structs become components
+// referenced by $ref.
+type schemaGen struct {
+	schemas map[string]*schema
+	types   map[string]reflect.Type
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+func (g *schemaGen) schemaOf(t reflect.Type) *schema {
+	switch t {
+	case timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &schema{Type: "string", Format: "uuid"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int32, reflect.Uint32:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return &schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := exported(t.Name())
+		if seen, ok := g.types[name]; ok {
+			if seen != t {
+				panic(fmt.Sprintf("openapi: %s and %s are both named %s", seen, t, name))
+			}
+		} else {
+			// claim the name first so recursive types find it
+			g.types[name] = t
+			g.schemas[name] = g.object(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + name}
+	}
+	panic(fmt.Sprintf("openapi: no schema for %s", t))
+}
+
+// object is a struct's schema. A field is required when its validate tag says
+// so, or, without a validate tag, when it isn't omitempty; validate rules map
+// to formats and lengths.
+func (g *schemaGen) object(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		prop := g.schemaOf(f.Type)
+		rules, hasRules := f.Tag.Lookup("validate")
+		required := !strings.Contains(opts, "omitempty")
+		if hasRules {
+			required = false
+			prop = withRules(prop, rules)
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if rule == "required" {
+				required = true
+			}
+		}
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// withRules copies s with the validate rules it can express.
+func withRules(s *schema, rules string) *schema {
+	c := *s
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		n, _ := strconv.Atoi(arg)
+		switch {
+		case name == "email":
+			c.Format = "email"
+		case name == "url":
+			c.Format = "uri"
+		case name == "min" && c.Type == "array":
+			c.MinItems = &n
+		case name == "max" && c.Type == "array":
+			c.MaxItems = &n
+		case name == "min":
+			c.MinLength = &n
+		case name == "max":
+			c.MaxLength = &n
+		}
+	}
+	return &c
+}
+
+func exported(name string) string {
+	r := []rune(name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// ServeOpenAPI serves the spec of rt's documented routes.
+func ServeOpenAPI(rt *Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, buildOpenAPI(rt.Routes(), apiDocs))
+	}
+}
+
+// APIDocs serves a Swagger UI page for /api/openapi.json.
+func (cfg *ApiConfig) APIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(apiDocsPage))
+}
+
+const apiDocsPage = `<!doctype html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>Chirpy API</title>
+	<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+	<script>
+		window.onload = () => {
+			window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+		};
+	</script>
+</body>
+</html>
+`
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	router := NewRouter()
+	(&ApiConfig{}).RegisterRoutes(router)
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if route.Alias || !strings.HasPrefix(route.Path, "/api/") && !strings.HasPrefix(route.Path, "/admin/") {
+			continue
+		}
+		doc, ok := apiDocs[key]
+		if !ok {
+			t.Errorf("%s isn't documented, add it to apiDocs", key)
+			continue
+		}
+		for _, p := range doc.Path {
+			if !strings.Contains(route.Path, "{"+p.Name+"}") {
+				t.Errorf("%s documents path parameter %q it doesn't have", key, p.Name)
+			}
+		}
+	}
+	for key := range apiDocs {
+		if !registered[key] {
+			t.Errorf("apiDocs documents %s, which isn't a route", key)
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	s := newTestServer(t, "dev")
+	rec := s.do(t, http.MethodGet, "/api/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var spec struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage        `json:"paths"`
+		Comps   struct{ Schemas map[string]json.RawMessage } `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decoding spec: %v", err)
+	}
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, want 3.1.0", spec.OpenAPI)
+	}
+	for _, path := range []string{"/metrics", "/api/chirps"} {
+		if _, ok := spec.Paths[path]; ok {
+			t.Errorf("spec documents %s, undocumented routes and aliases should be left out", path)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		op   string
+		want []string
+	}{
+		{name: "Path parameter", path: "/api/v1/chirps/{chirpID}", op: "get", want: []string{`"name":"chirpID","in":"path"`, `"format":"uuid"`, `"$ref":"#/components/schemas/ChirpResponse"`}},
+		{name: "Query parameters", path: "/api/v1/chirps", op: "get", want: []string{`"name":"hashtag","in":"query"`, `"type":"array"`}},
+		{name: "Request body and status", path: "/api/v1/users", op: "post", want: []string{`"$ref":"#/components/schemas/CreateUserRequest"`, `"201"`, `"default":{"$ref":"#/components/responses/Problem"}`}},
+		{name: "Security", path: "/api/v1/webhooks", op: "post", want: []string{`"security":[{"accessToken":[]}]`}},
+		{name: "Text response", path: "/admin/reset", op: "post", want: []string{`"text/plain"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, ok := spec.Paths[tt.path][tt.op]
+			if !ok {
+				t.Fatalf("spec has no %s %s", tt.op, tt.path)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(op), want) {
+					t.Errorf("%s %s = %s, want it to contain %s", tt.op, tt.path, op, want)
+				}
+			}
+		})
+	}
+
+	schemaTests := []struct {
+		name         string
+		wantRequired []string
+		wantContains string
+	}{
+		{name: "UserResponse", wantRequired: []string{"id", "created_at", "updated_at", "email", "is_chirpy_red"}, wantContains: `"format":"date-time"`},
+		{name: "CreateUserRequest", wantRequired: []string{"email", "password"}, wantContains: `"format":"email","maxLength":254`},
+		{name: "LoginRequest", wantRequired: []string{"email", "password"}},
+		{name: "Problem", wantRequired: []string{"type", "title", "status", "code"}, wantContains: `"$ref":"#/components/schemas/FieldError"`},
+	}
+	for _, tt := range schemaTests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, ok := spec.Comps.Schemas[tt.name]
+			if !ok {
+				t.Fatalf("spec has no %s schema", tt.name)
+			}
+			var got struct{ Required []string }
+			if err := json.Unmarshal(raw, &got); err != nil {
+				t.Fatalf("decoding %s: %v", tt.name, err)
+			}
+			if !slices.Equal(got.Required, tt.wantRequired) {
+				t.Errorf("%s required = %v, want %v", tt.name, got.Required, tt.wantRequired)
+			}
+			if !strings.Contains(string(raw), tt.wantContains) {
+				t.Errorf("%s = %s, want it to contain %s", tt.name, raw, tt.wantContains)
+			}
+		})
+	}
+}
+
+func TestAPIDocsPage(t *testing.T) {
+	s := newTestServer(t, "dev")
+	rec := s.do(t, http.MethodGet, "/app/docs", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `url: "/api/openapi.json"`) {
+		t.Errorf("docs page doesn't load the spec: %s", rec.Body)
+	}
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/events"
+	"chirpy/internal/logging"
+	"chirpy/internal/service"
+	"chirpy/internal/webhook"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// polkaSignatureHeader carries "t=<unix>,v1=<hex hmac>" signed with PolkaKey.
+	polkaSignatureHeader    = "X-Polka-Signature"
+	polkaSignatureTolerance = 5 * time.Minute
+	maxWebhookBodyBytes     = 1 << 20
+)
+
+// Polka event types we act on, anything else is recorded and acknowledged.
+// They share their names with the domain events they cause.
+const (
+	polkaEventUserUpgraded        = events.UserUpgraded
+	polkaEventUserDowngraded      = events.UserDowngraded
+	polkaEventSubscriptionRenewed = events.SubscriptionRenewed
+)
+
+var errPolkaInvalidUserID = &service.ValidationError{Msg: "invalid user_id"}
+
+// polkaEvent is the payload Polka sends, ID is unique per event and is used to
+// deduplicate retries.
+type polkaEvent struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserID           string     `json:"user_id"`
+		CurrentPeriodEnd *time.Time `json:"current_period_end,omitempty"`
+	} `json:"data"`
+}
+
+// UpgradeUserToChirpyRed receives Polka webhooks. Requests must be signed with
+// the Polka key, see authenticatePolka, every event is stored with its raw payload, and an event ID
+// that was already processed is acknowledged without being applied again.
+func (cfg *ApiConfig) UpgradeUserToChirpyRed(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Error reading request body")
+		return
+	}
+	err = cfg.authenticatePolka(r, body)
+	if err != nil {
+		respondProblem(w, r, http.StatusUnauthorized, CodeInvalidSignature, err.Error())
+		return
+	}
+	var event polkaEvent
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidBody, "Error decoding request body")
+		return
+	}
+	if event.ID == "" {
+		respondError(w, r, &service.ValidationError{Msg: "missing event id"})
+		return
+	}
+	// record the event, a conflict means we've seen this ID before
+	_, err = cfg.Store.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		ID:        event.ID,
+		EventType: event.Event,
+		Payload:   string(body),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		stored, getErr := cfg.Store.GetWebhookEvent(r.Context(), event.ID)
+		if getErr == nil && stored.ProcessedAt.Valid {
+			logging.FromContext(r.Context()).Info("💸 polka event already processed", "event_id", event.ID, "event", event.Event)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		err = getErr
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	cfg.applyPolkaEvent(w, r, event, false)
+}
+
+// authenticatePolka checks the webhook's signature. While PolkaAcceptAPIKey is
+// set, an unsigned request may instead carry the Polka key itself in an
+// "Authorization: ApiKey" header, as Polka sent it before signing.
+func (cfg *ApiConfig) authenticatePolka(r *http.Request, body []byte) error {
+	signature := r.Header.Get(polkaSignatureHeader)
+	if signature != "" || !cfg.PolkaAcceptAPIKey {
+		return webhook.VerifySignature(signature, body, cfg.PolkaKey, polkaSignatureTolerance, time.Now())
+	}
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return webhook.ErrMissingSignature
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.PolkaKey)) != 1 {
+		return errors.New("invalid API key")
+	}
+	logging.FromContext(r.Context()).Warn("💸 polka webhook used the legacy ApiKey scheme")
+	return nil
+}
+
+// ReplayPolkaEvent re-applies a stored Polka event from its raw payload, skipping
+// signature checks since the payload was verified when it was first received.
+func (cfg *ApiConfig) ReplayPolkaEvent(w http.ResponseWriter, r *http.Request) {
+	stored, err := cfg.Store.GetWebhookEvent(r.Context(), r.PathValue("eventID"))
+	if err != nil {
+		respondProblem(w, r, http.StatusNotFound, CodeEventNotFound, "event not found")
+		return
+	}
+	var event polkaEvent
+	err = json.Unmarshal([]byte(stored.Payload), &event)
+	if err != nil {
+		respondError(w, r, fmt.Errorf("stored payload is not valid JSON: %w", err))
+		return
+	}
+	cfg.applyPolkaEvent(w, r, event, true)
+}
+
+// applyPolkaEvent applies the event, marks it processed and writes the response.
+// A concurrent delivery of the same event that got there first is acknowledged
+// like any other duplicate; replay re-applies a processed event.
+func (cfg *ApiConfig) applyPolkaEvent(w http.ResponseWriter, r *http.Request, event polkaEvent, replay bool) {
+	err := cfg.processPolkaEvent(r, event, replay)
+	if errors.Is(err, service.ErrWebhookEventProcessed) {
+		logging.FromContext(r.Context()).Info("💸 polka event already processed", "event_id", event.ID, "event", event.Event)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processPolkaEvent applies a single event to the subscription of the user it
+// refers to. The subscription change and marking the event processed commit together.
+func (cfg *ApiConfig) processPolkaEvent(r *http.Request, event polkaEvent, replay bool) error {
+	switch event.Event {
+	case polkaEventUserUpgraded, polkaEventUserDowngraded, polkaEventSubscriptionRenewed:
+	default:
+		logging.FromContext(r.Context()).Info("💸 ignoring polka event", "event_id", event.ID, "event", event.Event)
+		return cfg.Store.MarkWebhookEventProcessed(r.Context(), event.ID)
+	}
+	userID, err := uuid.Parse(event.Data.UserID)
+	if err != nil {
+		return errPolkaInvalidUserID
+	}
+	err = cfg.Users.ApplySubscriptionChange(r.Context(), service.SubscriptionChange{
+		WebhookEventID: event.ID,
+		Reapply:        replay,
+		Type:           event.Event,
+		UserID:         userID,
+		PeriodEnd:      event.Data.CurrentPeriodEnd,
+	})
+	if err != nil {
+		return err
+	}
+	logging.FromContext(r.Context()).Info("💸 polka event processed", "event_id", event.ID, "event", event.Event, "user_id", userID)
+	return nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Middleware wraps a handler, see Router.Handle.
+type Middleware func(http.Handler) http.Handler
+
+// Route is one entry of the route table. An empty Method matches every method.
+// Version is the API version a route under /api/<version> belongs to, Alias
+// marks the unversioned path that picks one of them by the Accept header.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.Handler
+	Version string
+	Alias   bool
+}
+
+// Router is the route table: method and path patterns on an http.ServeMux,
+// each with its own middleware. A request for a known path with the wrong
+// method gets a 405 problem with an Allow header listing the methods that path
+// does have.
+type Router struct {
+	mux            *http.ServeMux
+	routes         []Route
+	methods        []string
+	aliases        map[string]*alias
+	defaultVersion string
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return &Router{mux: http.NewServeMux(), aliases: map[string]*alias{}}
+}
+
+// Handle routes method and path, a ServeMux path pattern such as
+// "/api/chirps/{chirpID}", to h wrapped in mw, the first middleware outermost.
+func (rt *Router) Handle(method, path string, h http.Handler, mw ...Middleware) {
+	rt.handle(Route{Method: method, Path: path}, h, mw)
+}
+
+// handle adds route, serving it with h wrapped in mw, and returns the wrapped handler.
+func (rt *Router) handle(route Route, h http.Handler, mw []Middleware) http.Handler {
+	for _, m := range slices.Backward(mw) {
+		h = m(h)
+	}
+	route.Handler = h
+	rt.routes = append(rt.routes, route)
+	if route.Method == "" {
+		rt.mux.Handle(route.Path, h)
+		return h
+	}
+	rt.mux.Handle(route.Method+" "+route.Path, h)
+	if !slices.Contains(rt.methods, route.Method) {
+		rt.methods = append(rt.methods, route.Method)
+	}
+	return h
+}
+
+// HandleFunc is Handle for a handler function.
+func (rt *Router) HandleFunc(method, path string, h http.HandlerFunc, mw ...Middleware) {
+	rt.Handle(method, path, h, mw...)
+}
+
+// Routes returns the route table in the order it was registered.
+func (rt *Router) Routes() []Route {
+	return slices.Clone(rt.routes)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := rt.mux.Handler(r); pattern == "" {
+		allow := rt.allow(r)
+		if len(allow) > 0 {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			respondProblem(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path)
+			return
+		}
+	}
+	rt.mux.ServeHTTP(w, r)
+}
+
+// allow is every method some route would serve r's path with, HEAD included
+// wherever there's a GET since the mux serves HEAD with the GET handler.
+func (rt *Router) allow(r *http.Request) []string {
+	var allow []string
+	probe := r.Clone(r.Context())
+	for _, method := range append(slices.Clone(rt.methods), http.MethodHead) {
+		probe.Method = method
+		if _, pattern := rt.mux.Handler(probe); pattern != "" && !slices.Contains(allow, method) {
+			allow = append(allow, method)
+		}
+	}
+	slices.Sort(allow)
+	return allow
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.PathValue("id")))
+	}
+	rt := NewRouter()
+	rt.HandleFunc(http.MethodGet, "/things/{id}", ok, tag("outer"), tag("inner"))
+	rt.HandleFunc(http.MethodDelete, "/things/{id}", ok)
+	rt.HandleFunc(http.MethodPost, "/things", ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantAllow  string
+		wantOrder  string
+	}{
+		{name: "Path value", method: http.MethodGet, path: "/things/42", wantStatus: http.StatusOK, wantBody: "GET 42", wantOrder: "outer,inner"},
+		{name: "Middleware is per route", method: http.MethodDelete, path: "/things/42", wantStatus: http.StatusOK, wantBody: "DELETE 42"},
+		{name: "Wrong method", method: http.MethodPut, path: "/things/42", wantStatus: http.StatusMethodNotAllowed, wantAllow: "DELETE, GET, HEAD"},
+		{name: "Wrong method without GET", method: http.MethodGet, path: "/things", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST"},
+		{name: "Unknown path", method: http.MethodGet, path: "/nope", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order = nil
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+			if got := strings.Join(order, ","); got != tt.wantOrder {
+				t.Errorf("middleware ran %q, want %q", got, tt.wantOrder)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed {
+				if p := decode[Problem](t, rec); p.Code != CodeMethodNotAllowed {
+					t.Errorf("problem code = %q, want %q", p.Code, CodeMethodNotAllowed)
+				}
+			}
+		})
+	}
+
+	routes := rt.Routes()
+	if len(routes) != 3 || routes[0].Method != http.MethodGet || routes[0].Path != "/things/{id}" {
+		t.Errorf("Routes() = %+v, want the three routes in registration order", routes)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"crypto/subtle"
+	"net/http"
+)
+
+// RegisterRoutes adds the API and admin routes to rt.
+func (cfg *ApiConfig) RegisterRoutes(rt *Router) {
+	// -- Api Routes, versioned under /api/v1 with the unversioned paths kept as aliases
+	v1 := rt.Version(APIVersion{Name: "v1"})
+	v1.HandleFunc(http.MethodPost, "/login", cfg.LoginUser)
+	v1.HandleFunc(http.MethodPost, "/refresh", cfg.RefreshToken)
+	v1.HandleFunc(http.MethodPost, "/revoke", cfg.RevokeRefreshToken)
+	v1.HandleFunc(http.MethodGet, "/chirps", cfg.ListChirps)
+	v1.HandleFunc(http.MethodPost, "/chirps", cfg.CreateChirp)
+	v1.HandleFunc(http.MethodGet, "/chirps/{chirpID}", cfg.GetChirp)
+	v1.HandleFunc(http.MethodDelete, "/chirps/{chirpID}", cfg.DeleteChirp)
+	v1.HandleFunc(http.MethodPost, "/users", cfg.CreateUser)
+	v1.HandleFunc(http.MethodPut, "/users", cfg.UpdateUser)
+	v1.HandleFunc(http.MethodPost, "/polka/webhooks", cfg.UpgradeUserToChirpyRed)
+	v1.HandleFunc(http.MethodGet, "/subscription", cfg.GetSubscription)
+	v1.HandleFunc(http.MethodPost, "/subscription/cancel", cfg.CancelSubscription)
+	v1.HandleFunc(http.MethodPost, "/webhooks", cfg.CreateWebhook)
+	v1.HandleFunc(http.MethodGet, "/webhooks", cfg.ListWebhooks)
+	v1.HandleFunc(http.MethodDelete, "/webhooks/{webhookID}", cfg.DeleteWebhook)
+	v1.HandleFunc(http.MethodGet, "/webhooks/{webhookID}/deliveries", cfg.ListWebhookDeliveries)
+	rt.HandleFunc(http.MethodGet, "/api/openapi.json", ServeOpenAPI(rt))
+	// -- Admin Routes
+	rt.HandleFunc(http.MethodGet, "/admin/metrics", cfg.FileServerHitsHandler)
+	rt.HandleFunc(http.MethodPost, "/admin/reset", cfg.ResetHits, cfg.RequireDev)
+	rt.HandleFunc(http.MethodPost, "/admin/polka/events/{eventID}/replay", cfg.ReplayPolkaEvent, cfg.RequireDev)
+	rt.HandleFunc(http.MethodPost, "/admin/webhooks", cfg.CreateAdminWebhook, cfg.RequireAdmin)
+	rt.HandleFunc(http.MethodGet, "/admin/webhooks/{webhookID}/deliveries", cfg.ListAdminWebhookDeliveries, cfg.RequireAdmin)
+	// -- App Routes
+	rt.HandleFunc(http.MethodGet, "/app/docs", cfg.APIDocs, cfg.MiddlewareMetricsInc)
+}
+
+var (
+	chirpIDParam   = Param{Name: "chirpID", Format: "uuid"}
+	webhookIDParam = Param{Name: "webhookID", Format: "uuid"}
+	// chirpShapeParams shape every chirp response
+	chirpShapeParams = []Param{
+		{Name: "fields", Description: "comma separated fields to return, all of them by default"},
+		{Name: "include", Description: "author to embed the author summary"},
+	}
+)
+
+// apiDocs documents every /api and /admin route for the OpenAPI spec, keyed
+// like the route's pattern, the unversioned aliases are left out.
+// TestRoutesAreDocumented fails for a route missing here.
+var apiDocs = map[string]Operation{
+	"POST /api/v1/login":   {Summary: "Log in, returning an access token and a refresh token", Tag: "auth", Request: loginRequest{}, Response: UserResponse{}},
+	"POST /api/v1/refresh": {Summary: "Issue a new access token", Tag: "auth", Security: "refreshToken", Response: TokenResponse{}},
+	"POST /api/v1/revoke":  {Summary: "Revoke a refresh token", Tag: "auth", Security: "refreshToken", Status: http.StatusNoContent},
+	"GET /api/v1/chirps": {Summary: "List chirps", Tag: "chirps", Response: []ChirpResponse{}, Query: append([]Param{
+		{Name: "author_id", Description: "only this user's chirps", Format: "uuid"},
+		{Name: "since", Description: "created at or after", Format: "date-time"},
+		{Name: "until", Description: "created before", Format: "date-time"},
+		{Name: "hashtag", Description: "containing #hashtag, with or without the #"},
+		{Name: "search", Description: "containing this text, case insensitive"},
+		{Name: "sort", Description: "asc (default) or desc by creation time"},
+	}, chirpShapeParams...)},
+	"POST /api/v1/chirps":                         {Summary: "Post a chirp", Tag: "chirps", Security: "accessToken", Query: chirpShapeParams, Request: createChirpRequest{}, Status: http.StatusCreated, Response: ChirpResponse{}},
+	"GET /api/v1/chirps/{chirpID}":                {Summary: "Get a chirp", Tag: "chirps", Path: []Param{chirpIDParam}, Query: chirpShapeParams, Response: ChirpResponse{}},
+	"DELETE /api/v1/chirps/{chirpID}":             {Summary: "Delete one of your chirps", Tag: "chirps", Security: "accessToken", Path: []Param{chirpIDParam}, Status: http.StatusNoContent},
+	"POST /api/v1/users":                          {Summary: "Sign up", Tag: "users", Request: createUserRequest{}, Status: http.StatusCreated, Response: UserResponse{}},
+	"PUT /api/v1/users":                           {Summary: "Change your email and password", Tag: "users", Security: "accessToken", Request: updateUserRequest{}, Response: UserResponse{}},
+	"POST /api/v1/polka/webhooks":                 {Summary: "Receive a Polka billing event", Tag: "polka", Security: "polkaSignature", Request: polkaEvent{}, Status: http.StatusNoContent},
+	"GET /api/v1/subscription":                    {Summary: "Get your Chirpy Red subscription", Tag: "subscription", Security: "accessToken", Response: SubscriptionResponse{}},
+	"POST /api/v1/subscription/cancel":            {Summary: "Cancel your subscription at the end of the period", Tag: "subscription", Security: "accessToken", Response: SubscriptionResponse{}},
+	"POST /api/v1/webhooks":                       {Summary: "Register a webhook for your events", Tag: "webhooks", Security: "accessToken", Request: createWebhookRequest{}, Status: http.StatusCreated, Response: WebhookResponse{}},
+	"GET /api/v1/webhooks":                        {Summary: "List your webhooks", Tag: "webhooks", Security: "accessToken", Response: []WebhookResponse{}},
+	"DELETE /api/v1/webhooks/{webhookID}":         {Summary: "Delete one of your webhooks", Tag: "webhooks", Security: "accessToken", Path: []Param{webhookIDParam}, Status: http.StatusNoContent},
+	"GET /api/v1/webhooks/{webhookID}/deliveries": {Summary: "List a webhook's recent deliveries", Tag: "webhooks", Security: "accessToken", Path: []Param{webhookIDParam}, Response: []WebhookDeliveryResponse{}},
+	"GET /api/openapi.json":                       {Summary: "This document", Tag: "meta", Response: map[string]any{}},
+	"GET /admin/metrics":                          {Summary: "Visit counts page", Tag: "admin", Response: "", ContentType: "text/html"},
+	"POST /admin/reset":                           {Summary: "Delete every user and reset the visit count, dev only", Tag: "admin", Response: "", ContentType: "text/plain"},
+	"POST /admin/polka/events/{eventID}/replay":   {Summary: "Re-apply a stored Polka event, dev only", Tag: "admin", Path: []Param{{Name: "eventID", Description: "the Polka event id"}}, Status: http.StatusNoContent},
+	"POST /admin/webhooks":                        {Summary: "Register a webhook for every user's events", Tag: "admin", Security: "adminKey", Request: createWebhookRequest{}, Status: http.StatusCreated, Response: WebhookResponse{}},
+	"GET /admin/webhooks/{webhookID}/deliveries":  {Summary: "List any webhook's recent deliveries", Tag: "admin", Security: "adminKey", Path: []Param{webhookIDParam}, Response: []WebhookDeliveryResponse{}},
+}
+
+// RequireDev answers 403 unless the platform is "dev", for admin routes that
+// change or expose every user's data.
+func (cfg *ApiConfig) RequireDev(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Platform != "dev" {
+			respondProblem(w, r, http.StatusForbidden, CodeForbidden, "only available on the dev platform")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin answers 401 unless the request carries the admin API key as
+// "Authorization: ApiKey <key>", on every platform, and 403 when no key is
+// configured.
+func (cfg *ApiConfig) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminAPIKey == "" {
+			respondProblem(w, r, http.StatusForbidden, CodeForbidden, "admin routes are off, set ADMIN_API_KEY to use them")
+			return
+		}
+		key, err := auth.GetAPIKey(r.Header)
+		if err != nil {
+			respondProblem(w, r, http.StatusUnauthorized, CodeMissingToken, err.Error())
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) != 1 {
+			respondProblem(w, r, http.StatusUnauthorized, CodeInvalidAdminKey, "invalid admin API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
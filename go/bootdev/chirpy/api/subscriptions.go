@@ -0,0 +1,51 @@
+package api
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/subscription"
+	"net/http"
+	"time"
+)
+
+// GetSubscription returns the authenticated user's subscription.
+func (cfg *ApiConfig) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	sub, err := cfg.Users.Subscription(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, newSubscriptionResponse(sub))
+}
+
+// CancelSubscription cancels the authenticated user's subscription at the end of
+// the current period, the perks stay until then.
+func (cfg *ApiConfig) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	sub, err := cfg.Users.CancelSubscription(r.Context(), userID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, newSubscriptionResponse(sub))
+}
+
+func newSubscriptionResponse(sub database.Subscription) SubscriptionResponse {
+	resp := SubscriptionResponse{
+		Plan:              sub.Plan,
+		Status:            sub.Status,
+		Active:            subscription.IsActive(sub, time.Now()),
+		CurrentPeriodEnd:  sub.CurrentPeriodEnd,
+		CancelAtPeriodEnd: sub.CancelAtPeriodEnd,
+	}
+	if sub.CanceledAt.Valid {
+		resp.CanceledAt = &sub.CanceledAt.Time
+	}
+	return resp
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is one version of the API, its routes live under /api/<Name>.
+// Once a newer version replaces it, Deprecated says since when, Sunset when it
+// goes away and Successor which version to move to; its responses carry them
+// as Deprecation, Sunset and Link headers.
+type APIVersion struct {
+	Name       string
+	Deprecated time.Time
+	Sunset     time.Time
+	Successor  string
+}
+
+// versionMediaType is the Accept media type prefix that picks a version on an
+// unversioned path, application/vnd.chirpy.v2+json asks for v2.
+const versionMediaType = "application/vnd.chirpy."
+
+// CodeUnsupportedVersion is the problem code for an Accept header asking for a
+// version that doesn't exist or doesn't have the route.
+const CodeUnsupportedVersion = "unsupported_version"
+
+// VersionRouter registers the routes of one API version, see Router.Version.
+type VersionRouter struct {
+	rt      *Router
+	version APIVersion
+}
+
+// alias is an unversioned path and the handler each version serves it with.
+type alias struct {
+	handlers map[string]http.Handler
+}
+
+// Version returns the router for v's routes. The first version is the
+// default: the unversioned /api/... paths serve it unless the Accept header
+// asks for another.
+func (rt *Router) Version(v APIVersion) *VersionRouter {
+	if rt.defaultVersion == "" {
+		rt.defaultVersion = v.Name
+	}
+	return &VersionRouter{rt: rt, version: v}
+}
+
+// Handle routes method and /api/<version><path> to h wrapped in mw, and adds
+// the version to the unversioned alias /api<path>.
+func (vr *VersionRouter) Handle(method, path string, h http.Handler, mw ...Middleware) {
+	if !vr.version.Deprecated.IsZero() {
+		mw = append([]Middleware{deprecated(vr.version)}, mw...)
+	}
+	h = vr.rt.handle(Route{Method: method, Path: "/api/" + vr.version.Name + path, Version: vr.version.Name}, h, mw)
+
+	key := method + " /api" + path
+	a, ok := vr.rt.aliases[key]
+	if !ok {
+		a = &alias{handlers: map[string]http.Handler{}}
+		vr.rt.aliases[key] = a
+		vr.rt.handle(Route{Method: method, Path: "/api" + path, Alias: true}, vr.rt.serveAlias(a), nil)
+	}
+	a.handlers[vr.version.Name] = h
+}
+
+// HandleFunc is Handle for a handler function.
+func (vr *VersionRouter) HandleFunc(method, path string, h http.HandlerFunc, mw ...Middleware) {
+	vr.Handle(method, path, h, mw...)
+}
+
+// serveAlias serves an unversioned path with the version the Accept header
+// asks for, the default version if it doesn't.
+func (rt *Router) serveAlias(a *alias) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		version := requestedVersion(r.Header.Get("Accept"))
+		if version == "" {
+			version = rt.defaultVersion
+		}
+		h, ok := a.handlers[version]
+		if !ok {
+			respondProblem(w, r, http.StatusNotAcceptable, CodeUnsupportedVersion, "API version "+version+" doesn't serve "+r.Method+" "+r.URL.Path)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestedVersion is the version named by the first application/vnd.chirpy.*
+// media type in accept, "" if there's none.
+func requestedVersion(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(mediaType, versionMediaType); ok {
+			version, _, _ := strings.Cut(rest, "+")
+			return version
+		}
+	}
+	return ""
+}
+
+// deprecated adds the RFC 9745 Deprecation, RFC 8594 Sunset and successor Link
+// headers of a superseded version.
+func deprecated(v APIVersion) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(v.Deprecated.Unix(), 10))
+			if !v.Sunset.IsZero() {
+				w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if v.Successor != "" {
+				w.Header().Add("Link", `</api/`+v.Successor+`>; rel="successor-version"`)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVersionRouter(t *testing.T) {
+	deprecatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	serve := func(version string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(version + " " + r.PathValue("id")))
+		}
+	}
+	rt := NewRouter()
+	v1 := rt.Version(APIVersion{Name: "v1", Deprecated: deprecatedAt, Sunset: sunset, Successor: "v2"})
+	v1.HandleFunc(http.MethodGet, "/things/{id}", serve("v1"))
+	v2 := rt.Version(APIVersion{Name: "v2"})
+	v2.HandleFunc(http.MethodGet, "/things/{id}", serve("v2"))
+	v2.HandleFunc(http.MethodGet, "/widgets", serve("v2"))
+
+	tests := []struct {
+		name           string
+		path           string
+		accept         string
+		wantStatus     int
+		wantBody       string
+		wantDeprecated bool
+	}{
+		{name: "Versioned path", path: "/api/v1/things/7", wantStatus: http.StatusOK, wantBody: "v1 7", wantDeprecated: true},
+		{name: "Current version", path: "/api/v2/things/7", wantStatus: http.StatusOK, wantBody: "v2 7"},
+		{name: "Alias defaults to the first version", path: "/api/things/7", wantStatus: http.StatusOK, wantBody: "v1 7", wantDeprecated: true},
+		{name: "Alias negotiated", path: "/api/things/7", accept: "application/vnd.chirpy.v2+json", wantStatus: http.StatusOK, wantBody: "v2 7"},
+		{name: "Alias negotiated among others", path: "/api/things/7", accept: "text/html, application/vnd.chirpy.v2+json; q=0.9", wantStatus: http.StatusOK, wantBody: "v2 7"},
+		{name: "Plain JSON gets the default", path: "/api/things/7", accept: "application/json", wantStatus: http.StatusOK, wantBody: "v1 7", wantDeprecated: true},
+		{name: "Unknown version", path: "/api/things/7", accept: "application/vnd.chirpy.v9+json", wantStatus: http.StatusNotAcceptable},
+		{name: "Route the default version lacks", path: "/api/widgets", wantStatus: http.StatusNotAcceptable},
+		{name: "Versioned path ignores Accept", path: "/api/v1/things/7", accept: "application/vnd.chirpy.v2+json", wantStatus: http.StatusOK, wantBody: "v1 7", wantDeprecated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, tt.wantBody)
+			}
+			if rec.Code == http.StatusNotAcceptable {
+				if p := decode[Problem](t, rec); p.Code != CodeUnsupportedVersion {
+					t.Errorf("problem code = %q, want %q", p.Code, CodeUnsupportedVersion)
+				}
+			}
+			h := rec.Header()
+			if !tt.wantDeprecated {
+				if h.Get("Deprecation") != "" || h.Get("Sunset") != "" {
+					t.Errorf("Deprecation = %q, Sunset = %q, want neither", h.Get("Deprecation"), h.Get("Sunset"))
+				}
+				return
+			}
+			if got := h.Get("Deprecation"); got != "@1767225600" {
+				t.Errorf("Deprecation = %q, want @1767225600", got)
+			}
+			if got := h.Get("Sunset"); got != "Wed, 01 Jul 2026 00:00:00 GMT" {
+				t.Errorf("Sunset = %q, want Wed, 01 Jul 2026 00:00:00 GMT", got)
+			}
+			if got := h.Get("Link"); got != `</api/v2>; rel="successor-version"` {
+				t.Errorf("Link = %q, want the successor version", got)
+			}
+		})
+	}
+
+	var aliases, versioned int
+	for _, route := range rt.Routes() {
+		if route.Alias {
+			aliases++
+		} else if route.Version != "" {
+			versioned++
+		}
+	}
+	if aliases != 2 || versioned != 3 {
+		t.Errorf("Routes() has %d aliases and %d versioned routes, want 2 and 3", aliases, versioned)
+	}
+}
+
+func TestVersionedAPI(t *testing.T) {
+	s := newTestServer(t, "dev")
+	s.signup(t, "a@example.com")
+	for _, path := range []string{"/api/v1/chirps", "/api/chirps"} {
+		rec := s.do(t, http.MethodGet, path, "", nil)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want %d: %s", path, rec.Code, http.StatusOK, rec.Body)
+		}
+		if rec.Header().Get("Deprecation") != "" {
+			t.Errorf("GET %s is deprecated, v1 is current", path)
+		}
+	}
+}
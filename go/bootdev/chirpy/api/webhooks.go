@@ -0,0 +1,210 @@
+package api
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/service"
+	"chirpy/internal/validate"
+	"chirpy/internal/webhook"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// maxDeliveryLog caps how many deliveries the delivery log endpoints return.
+const maxDeliveryLog = 100
+
+// CreateWebhook registers a webhook that receives the authenticated user's events.
+func (cfg *ApiConfig) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	cfg.createWebhook(w, r, uuid.NullUUID{UUID: userID, Valid: true})
+}
+
+// CreateAdminWebhook registers a webhook that receives every user's events.
+func (cfg *ApiConfig) CreateAdminWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg.createWebhook(w, r, uuid.NullUUID{})
+}
+
+func (cfg *ApiConfig) createWebhook(w http.ResponseWriter, r *http.Request, owner uuid.NullUUID) {
+	req, ok := decodeJSON[createWebhookRequest](w, r)
+	if !ok {
+		return
+	}
+	for _, event := range req.Events {
+		if !webhook.IsEventType(event) {
+			respondError(w, r, &service.ValidationError{Msg: "unknown event type: " + event})
+			return
+		}
+	}
+	// no pointing chirpy at its own network, the dispatcher checks again when it dials
+	err := webhook.CheckTarget(r.Context(), req.URL, cfg.WebhookResolver)
+	if err != nil {
+		msg := "must have a host that resolves"
+		if errors.Is(err, webhook.ErrForbiddenTarget) {
+			msg = "must resolve to a public address"
+		}
+		respondError(w, r, &service.ValidationError{Msg: "request body failed validation", Fields: []validate.FieldError{{Field: "url", Rule: "public", Message: msg}}})
+		return
+	}
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	sub, err := cfg.Store.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		UserID:     owner,
+		Url:        req.URL,
+		EventTypes: webhook.JoinEventTypes(req.Events),
+		Secret:     secret,
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	// the secret is only ever shown once, at creation
+	resp := newWebhookResponse(sub)
+	resp.Secret = sub.Secret
+	respondJSON(w, http.StatusCreated, resp)
+}
+
+// ListWebhooks lists the authenticated user's webhooks.
+func (cfg *ApiConfig) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	subs, err := cfg.Store.ListWebhookSubscriptionsByUser(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	resp := make([]WebhookResponse, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, newWebhookResponse(sub))
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// DeleteWebhook deletes one of the authenticated user's webhooks.
+func (cfg *ApiConfig) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	sub, ok := cfg.ownedWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+	err := cfg.Store.DeleteWebhookSubscription(r.Context(), sub.ID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries of one of the
+// authenticated user's webhooks.
+func (cfg *ApiConfig) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticatedUserID(w, r)
+	if !ok {
+		return
+	}
+	sub, ok := cfg.ownedWebhook(w, r, userID)
+	if !ok {
+		return
+	}
+	cfg.writeDeliveryLog(w, r, sub)
+}
+
+// ListAdminWebhookDeliveries returns the most recent deliveries of any webhook.
+func (cfg *ApiConfig) ListAdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.webhookFromPath(w, r)
+	if !ok {
+		return
+	}
+	cfg.writeDeliveryLog(w, r, sub)
+}
+
+// webhookFromPath loads the webhook named by the {webhookID} path value, writing
+// the error response and returning false if it can't.
+func (cfg *ApiConfig) webhookFromPath(w http.ResponseWriter, r *http.Request) (database.WebhookSubscription, bool) {
+	id, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		respondProblem(w, r, http.StatusBadRequest, CodeInvalidID, "error parsing webhook ID")
+		return database.WebhookSubscription{}, false
+	}
+	sub, err := cfg.Store.GetWebhookSubscription(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondProblem(w, r, http.StatusNotFound, CodeWebhookNotFound, "can't find webhook")
+		return database.WebhookSubscription{}, false
+	}
+	if err != nil {
+		respondError(w, r, err)
+		return database.WebhookSubscription{}, false
+	}
+	return sub, true
+}
+
+// ownedWebhook is webhookFromPath plus a check that userID owns the webhook.
+func (cfg *ApiConfig) ownedWebhook(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.WebhookSubscription, bool) {
+	sub, ok := cfg.webhookFromPath(w, r)
+	if !ok {
+		return sub, false
+	}
+	if !sub.UserID.Valid || sub.UserID.UUID != userID {
+		respondProblem(w, r, http.StatusForbidden, CodeNotWebhookOwner, "webhook does not belong to user")
+		return sub, false
+	}
+	return sub, true
+}
+
+func (cfg *ApiConfig) writeDeliveryLog(w http.ResponseWriter, r *http.Request, sub database.WebhookSubscription) {
+	deliveries, err := cfg.Store.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		SubscriptionID: sub.ID,
+		Limit:          maxDeliveryLog,
+	})
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	resp := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, d := range deliveries {
+		resp = append(resp, newWebhookDeliveryResponse(d))
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+func newWebhookResponse(sub database.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		ID:        sub.ID,
+		CreatedAt: sub.CreatedAt,
+		URL:       sub.Url,
+		Events:    webhook.SplitEventTypes(sub.EventTypes),
+	}
+}
+
+func newWebhookDeliveryResponse(d database.WebhookDelivery) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		ID:            d.ID,
+		CreatedAt:     d.CreatedAt,
+		EventID:       d.EventID,
+		EventType:     d.EventType,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		NextAttemptAt: d.NextAttemptAt,
+		LastError:     d.LastError.String,
+	}
+	if d.LastAttemptAt.Valid {
+		resp.LastAttemptAt = &d.LastAttemptAt.Time
+	}
+	if d.LastStatusCode.Valid {
+		resp.LastStatusCode = &d.LastStatusCode.Int32
+	}
+	return resp
+}
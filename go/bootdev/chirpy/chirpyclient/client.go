@@ -0,0 +1,345 @@
+// Package chirpyclient is a typed client for the Chirpy API.
+//
+//	c := chirpyclient.New("http://localhost:8080")
+//	_, err := c.Login(ctx, "a@example.com", "correct horse")
+//	chirp, err := c.CreateChirp(ctx, "hello #chirpy")
+//
+// The client keeps the tokens from Login and uses them for the calls that need
+// them, refreshing the access token through /api/v1/refresh when it expires.
+// Failed calls return an *Error decoded from the API's problem response.
+// Idempotent requests are retried on network errors and on 429, 502, 503 and
+// 504 with exponential backoff; every call stops when its context is done.
+package chirpyclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client calls one Chirpy server, it's safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+
+	mu           sync.RWMutex
+	accessToken  string
+	refreshToken string
+	// refreshMu makes concurrent calls that all find the access token expired
+	// share one refresh
+	refreshMu sync.Mutex
+}
+
+// Option configures a Client, see New.
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of a client with a 30s timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries retries idempotent requests up to n times, waiting backoff
+// before the first retry and doubling it for each one after. n = 0 turns
+// retries off. The default is 2 retries from 100ms.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// WithTokens starts the client with tokens saved from an earlier session, see
+// Client.Tokens.
+func WithTokens(accessToken, refreshToken string) Option {
+	return func(c *Client) {
+		c.accessToken = accessToken
+		c.refreshToken = refreshToken
+	}
+}
+
+// New returns a client for the server at baseURL, e.g. "https://chirpy.example.com".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		retries:    2,
+		backoff:    100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Tokens returns the current access and refresh tokens, to save the session
+// and restore it with WithTokens.
+func (c *Client) Tokens() (accessToken, refreshToken string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.accessToken, c.refreshToken
+}
+
+func (c *Client) setTokens(accessToken, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = accessToken
+	c.refreshToken = refreshToken
+}
+
+// Error is a failed call, decoded from the API's RFC 7807 problem response.
+// Code is stable, switch on it rather than on Detail. A response that isn't a
+// problem, from a proxy say, has no Code and its body, cut short, as Detail.
+type Error struct {
+	StatusCode int          `json:"status"`
+	Code       string       `json:"code"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail"`
+	Instance   string       `json:"instance"`
+	RequestID  string       `json:"request_id"`
+	Fields     []FieldError `json:"errors"`
+}
+
+// FieldError is one request field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("chirpy: %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, f := range e.Fields {
+		msg += "; " + f.Field + " " + f.Message
+	}
+	return msg
+}
+
+// Is matches another *Error with the same Code, so errors.Is finds a code
+// anywhere in a joined error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// IsCode reports whether err is or wraps an *Error with the given code, e.g.
+// "chirp_not_found".
+func IsCode(err error, code string) bool {
+	return errors.Is(err, &Error{Code: code})
+}
+
+// errNoRefreshToken is returned by Refresh before Login.
+var errNoRefreshToken = errors.New("chirpy: no refresh token, log in first")
+
+// maxErrorBody caps how much of a response that isn't a problem ends up in
+// Error.Detail.
+const maxErrorBody = 512
+
+type authMode int
+
+const (
+	noAuth authMode = iota
+	accessAuth
+	refreshAuth
+)
+
+// call is one API call: the request to make and what to decode the response into.
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	auth   authMode
+	body   any
+	// out is where a 2xx JSON body is decoded to, a *[]byte takes it as is
+	out any
+}
+
+// do makes the call, refreshing the access token once if it's rejected.
+func (c *Client) do(ctx context.Context, cl call) error {
+	token := c.tokenFor(cl.auth)
+	err := c.send(ctx, cl, token)
+	var apiErr *Error
+	if cl.auth != accessAuth || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	if _, refresh := c.Tokens(); refresh == "" {
+		return err
+	}
+	refreshErr := c.refreshAccessToken(ctx, token)
+	if refreshErr != nil {
+		return errors.Join(err, refreshErr)
+	}
+	return c.send(ctx, cl, c.tokenFor(accessAuth))
+}
+
+func (c *Client) tokenFor(mode authMode) string {
+	access, refresh := c.Tokens()
+	switch mode {
+	case accessAuth:
+		return access
+	case refreshAuth:
+		return refresh
+	}
+	return ""
+}
+
+// refreshAccessToken gets a new access token unless another call already
+// replaced stale while this one waited.
+func (c *Client) refreshAccessToken(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if access, _ := c.Tokens(); access != stale {
+		return nil
+	}
+	_, err := c.Refresh(ctx)
+	return err
+}
+
+// send makes the request, retrying it if it's idempotent and failed in a way a
+// retry can fix.
+func (c *Client) send(ctx context.Context, cl call, token string) error {
+	var body []byte
+	if cl.body != nil {
+		var err error
+		body, err = json.Marshal(cl.body)
+		if err != nil {
+			return fmt.Errorf("chirpy: encoding request body: %w", err)
+		}
+	}
+	retries := 0
+	if idempotent(cl.method) {
+		retries = c.retries
+	}
+	wait := c.backoff
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.attempt(ctx, cl, token, body)
+		if err == nil || attempt >= retries || !retryable(ctx, err) {
+			return err
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// attempt makes the request once. On a failed response it also returns the
+// server's Retry-After, if it sent one.
+func (c *Client) attempt(ctx context.Context, cl call, token string, body []byte) (time.Duration, error) {
+	target := c.baseURL + cl.path
+	if len(cl.query) > 0 {
+		target += "?" + cl.query.Encode()
+	}
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cl.method, target, reqBody)
+	if err != nil {
+		return 0, fmt.Errorf("chirpy: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		// drain what's left so the connection goes back to the pool
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+	}()
+	if resp.StatusCode >= 300 {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, decodeError(resp)
+	}
+	switch out := cl.out.(type) {
+	case nil:
+		return 0, nil
+	case *[]byte:
+		*out, err = io.ReadAll(resp.Body)
+	default:
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("chirpy: reading %s %s response: %w", cl.method, cl.path, err)
+	}
+	return 0, nil
+}
+
+func decodeError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	apiErr := &Error{}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" || mediaType == "application/json" {
+		json.Unmarshal(body, apiErr)
+	}
+	// the status line is the truth, whatever the body says
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.Code == "" && apiErr.Detail == "" {
+		if len(body) > maxErrorBody {
+			body = body[:maxErrorBody]
+		}
+		apiErr.Detail = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether err, from a request whose context is still live,
+// might go away on its own.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// the request never got a response
+		return true
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
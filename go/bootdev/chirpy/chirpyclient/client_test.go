@@ -0,0 +1,286 @@
+package chirpyclient
+
+import (
+	"chirpy/api"
+	"chirpy/internal/auth"
+	"chirpy/internal/database/memstore"
+	"chirpy/internal/service"
+	"chirpy/internal/webhook"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newTestServer runs the real API on an in-memory store, wrapped in wrap.
+func newTestServer(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	t.Helper()
+	store := memstore.New()
+	// cheap Argon2id params, the tests hash a lot of passwords
+	hasher := auth.NewArgon2idHasher(auth.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	cfg := &api.ApiConfig{
+		Metrics:  api.NewMetrics(),
+		Store:    store,
+		Platform: "dev",
+		Chirps:   service.NewChirpService(store),
+		Users:    service.NewUserService(store, hasher, auth.NewPasswordPolicy(8, 64)),
+		Auth:     service.NewAuthService(store, hasher, service.AuthConfig{JWTSecret: "test-secret"}),
+		// no DNS in tests
+		WebhookResolver: webhook.StaticResolver{"example.com": {netip.MustParseAddr("93.184.215.14")}},
+	}
+	router := api.NewRouter()
+	cfg.RegisterRoutes(router)
+	var h http.Handler = router
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func loggedIn(t *testing.T, c *Client, email string) User {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := c.CreateUser(ctx, email, "correct horse"); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	user, err := c.Login(ctx, email, "correct horse")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	return user
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil)
+	c := New(srv.URL)
+	user := loggedIn(t, c, "a@example.com")
+
+	chirp, err := c.CreateChirp(ctx, "hello #chirpy")
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	if chirp.UserID != user.ID || chirp.Body != "hello #chirpy" {
+		t.Errorf("CreateChirp() = %+v, want a chirp by %s", chirp, user.ID)
+	}
+	got, err := c.GetChirp(ctx, chirp.ID)
+	if err != nil || got.ID != chirp.ID {
+		t.Errorf("GetChirp() = %+v, %v, want %+v", got, err, chirp)
+	}
+	chirps, err := c.ListChirps(ctx, ListChirpsOptions{AuthorID: user.ID, Hashtag: "#chirpy", NewestFirst: true, IncludeAuthor: true})
+	if err != nil || len(chirps) != 1 || chirps[0].Author == nil || chirps[0].Author.ID != user.ID {
+		t.Errorf("ListChirps() = %+v, %v, want the one chirp with its author", chirps, err)
+	}
+	updated, err := c.UpdateUser(ctx, "b@example.com", "battery staple")
+	if err != nil || updated.Email != "b@example.com" {
+		t.Errorf("UpdateUser() = %+v, %v, want email b@example.com", updated, err)
+	}
+	hook, err := c.CreateWebhook(ctx, "https://example.com/hook", []string{"chirp.created"})
+	if err != nil || hook.Secret == "" {
+		t.Fatalf("CreateWebhook() = %+v, %v, want a webhook with its secret", hook, err)
+	}
+	hooks, err := c.ListWebhooks(ctx)
+	if err != nil || len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Errorf("ListWebhooks() = %+v, %v, want the webhook without its secret", hooks, err)
+	}
+	if _, err := c.ListWebhookDeliveries(ctx, hook.ID); err != nil {
+		t.Errorf("ListWebhookDeliveries() error = %v", err)
+	}
+	if err := c.DeleteWebhook(ctx, hook.ID); err != nil {
+		t.Errorf("DeleteWebhook() error = %v", err)
+	}
+	if err := c.DeleteChirp(ctx, chirp.ID); err != nil {
+		t.Errorf("DeleteChirp() error = %v", err)
+	}
+	spec, err := c.OpenAPI(ctx)
+	if err != nil || !strings.Contains(string(spec), `"openapi":"3.1.0"`) {
+		t.Errorf("OpenAPI() = %.80s, %v, want the spec", spec, err)
+	}
+	if page, err := c.AdminMetrics(ctx); err != nil || !strings.Contains(page, "Chirpy Admin") {
+		t.Errorf("AdminMetrics() = %.80q, %v, want the admin page", page, err)
+	}
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if access, refresh := c.Tokens(); access != "" || refresh != "" {
+		t.Errorf("Tokens() after Logout = %q, %q, want none", access, refresh)
+	}
+	if err := c.AdminReset(ctx); err != nil {
+		t.Errorf("AdminReset() error = %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil)
+	c := New(srv.URL)
+
+	tests := []struct {
+		name       string
+		call       func() error
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{
+			name:       "Not found",
+			call:       func() error { _, err := c.GetChirp(ctx, uuid.New()); return err },
+			wantStatus: http.StatusNotFound,
+			wantCode:   "chirp_not_found",
+		},
+		{
+			name:       "Validation",
+			call:       func() error { _, err := c.CreateUser(ctx, "not an email", "correct horse"); return err },
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "validation_failed",
+			wantField:  "email",
+		},
+		{
+			name:       "Not logged in",
+			call:       func() error { _, err := c.CreateChirp(ctx, "hi"); return err },
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "missing_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an *Error", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus || !IsCode(err, tt.wantCode) {
+				t.Errorf("error = %d %q, want %d %q", apiErr.StatusCode, apiErr.Code, tt.wantStatus, tt.wantCode)
+			}
+			if tt.wantField != "" && (len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != tt.wantField) {
+				t.Errorf("error fields = %+v, want %s", apiErr.Fields, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestClientRefreshesAccessToken(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t, nil)
+	c := New(srv.URL)
+	loggedIn(t, c, "a@example.com")
+	_, refresh := c.Tokens()
+
+	// a session restored with an access token that's no longer any good
+	restored := New(srv.URL, WithTokens("expired", refresh))
+	if _, err := restored.CreateChirp(ctx, "still here"); err != nil {
+		t.Fatalf("CreateChirp() error = %v, want the access token refreshed", err)
+	}
+	if access, _ := restored.Tokens(); access == "expired" {
+		t.Errorf("access token wasn't replaced")
+	}
+
+	revoked := New(srv.URL, WithTokens("expired", "revoked"))
+	_, err := revoked.CreateChirp(ctx, "gone")
+	if !IsCode(err, "invalid_access_token") || !IsCode(err, "invalid_refresh_token") {
+		t.Errorf("CreateChirp() error = %v, want both the access and refresh token rejected", err)
+	}
+}
+
+// failing answers the first n requests with status, then lets the rest through.
+func failing(n int32, status int, count *atomic.Int32) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if count.Add(1) <= n {
+				http.Error(w, "try again", status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		call         func(ctx context.Context, c *Client) error
+		wantErr      bool
+		wantRequests int32
+	}{
+		{
+			name:     "Idempotent request is retried",
+			failures: 2, status: http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.ListChirps(ctx, ListChirpsOptions{})
+				return err
+			},
+			wantRequests: 3,
+		},
+		{
+			name:     "Retries run out",
+			failures: 5, status: http.StatusBadGateway,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.ListChirps(ctx, ListChirpsOptions{})
+				return err
+			},
+			wantErr:      true,
+			wantRequests: 3,
+		},
+		{
+			name:     "POST isn't retried",
+			failures: 1, status: http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.CreateUser(ctx, "a@example.com", "correct horse")
+				return err
+			},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+		{
+			name:     "Client errors aren't retried",
+			failures: 1, status: http.StatusBadRequest,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.ListChirps(ctx, ListChirpsOptions{})
+				return err
+			},
+			wantErr:      true,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count atomic.Int32
+			srv := newTestServer(t, failing(tt.failures, tt.status, &count))
+			c := New(srv.URL, WithRetries(2, time.Millisecond))
+			err := tt.call(context.Background(), c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := count.Load(); got != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	var count atomic.Int32
+	srv := newTestServer(t, failing(100, http.StatusServiceUnavailable, &count))
+	c := New(srv.URL, WithRetries(10, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.ListChirps(ctx, ListChirpsOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ListChirps() took %s, want it to stop with the context", elapsed)
+	}
+}
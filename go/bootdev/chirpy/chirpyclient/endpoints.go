@@ -0,0 +1,217 @@
+package chirpyclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// CreateUser signs up a new user. It doesn't log them in.
+func (c *Client) CreateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/users", body: credentials{email, password}, out: &user})
+	return user, err
+}
+
+// Login logs in and keeps the session's tokens for the calls after it.
+func (c *Client) Login(ctx context.Context, email, password string) (User, error) {
+	var resp struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/login", body: credentials{email, password}, out: &resp})
+	if err != nil {
+		return User{}, err
+	}
+	c.setTokens(resp.Token, resp.RefreshToken)
+	return resp.User, nil
+}
+
+// UpdateUser changes the logged in user's email and password.
+func (c *Client) UpdateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	err := c.do(ctx, call{method: http.MethodPut, path: "/api/v1/users", auth: accessAuth, body: credentials{email, password}, out: &user})
+	return user, err
+}
+
+// Refresh swaps the refresh token for a new access token and returns it. Calls
+// that need the access token do this on their own when it's expired.
+func (c *Client) Refresh(ctx context.Context) (string, error) {
+	_, refresh := c.Tokens()
+	if refresh == "" {
+		return "", errNoRefreshToken
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/refresh", auth: refreshAuth, out: &resp})
+	if err != nil {
+		return "", err
+	}
+	c.setTokens(resp.Token, refresh)
+	return resp.Token, nil
+}
+
+// Logout revokes the refresh token and forgets the session.
+func (c *Client) Logout(ctx context.Context) error {
+	_, refresh := c.Tokens()
+	if refresh == "" {
+		return errNoRefreshToken
+	}
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/revoke", auth: refreshAuth})
+	if err != nil {
+		return err
+	}
+	c.setTokens("", "")
+	return nil
+}
+
+// CreateChirp posts a chirp as the logged in user.
+func (c *Client) CreateChirp(ctx context.Context, body string) (Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/chirps", auth: accessAuth, body: struct {
+		Body string `json:"body"`
+	}{body}, out: &chirp})
+	return chirp, err
+}
+
+// GetChirp gets one chirp.
+func (c *Client) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/chirps/" + id.String(), out: &chirp})
+	return chirp, err
+}
+
+// DeleteChirp deletes one of the logged in user's chirps.
+func (c *Client) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/api/v1/chirps/" + id.String(), auth: accessAuth})
+}
+
+// ListChirps lists the chirps matching opts.
+func (c *Client) ListChirps(ctx context.Context, opts ListChirpsOptions) ([]Chirp, error) {
+	query := url.Values{}
+	if opts.AuthorID != uuid.Nil {
+		query.Set("author_id", opts.AuthorID.String())
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", opts.Since.Format(time.RFC3339))
+	}
+	if !opts.Until.IsZero() {
+		query.Set("until", opts.Until.Format(time.RFC3339))
+	}
+	if opts.Hashtag != "" {
+		query.Set("hashtag", opts.Hashtag)
+	}
+	if opts.Search != "" {
+		query.Set("search", opts.Search)
+	}
+	if opts.NewestFirst {
+		query.Set("sort", "desc")
+	}
+	if opts.IncludeAuthor {
+		query.Set("include", "author")
+	}
+	var chirps []Chirp
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/chirps", query: query, out: &chirps})
+	return chirps, err
+}
+
+// Subscription gets the logged in user's Chirpy Red subscription.
+func (c *Client) Subscription(ctx context.Context) (Subscription, error) {
+	var sub Subscription
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/subscription", auth: accessAuth, out: &sub})
+	return sub, err
+}
+
+// CancelSubscription cancels the logged in user's subscription at the end of
+// the current period.
+func (c *Client) CancelSubscription(ctx context.Context) (Subscription, error) {
+	var sub Subscription
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/subscription/cancel", auth: accessAuth, out: &sub})
+	return sub, err
+}
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// CreateWebhook registers a webhook for the logged in user's events. The
+// returned Webhook's Secret is the only time it's shown.
+func (c *Client) CreateWebhook(ctx context.Context, target string, events []string) (Webhook, error) {
+	var hook Webhook
+	err := c.do(ctx, call{method: http.MethodPost, path: "/api/v1/webhooks", auth: accessAuth, body: webhookRequest{target, events}, out: &hook})
+	return hook, err
+}
+
+// ListWebhooks lists the logged in user's webhooks.
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/webhooks", auth: accessAuth, out: &hooks})
+	return hooks, err
+}
+
+// DeleteWebhook deletes one of the logged in user's webhooks.
+func (c *Client) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, call{method: http.MethodDelete, path: "/api/v1/webhooks/" + id.String(), auth: accessAuth})
+}
+
+// ListWebhookDeliveries lists the most recent deliveries of one of the logged
+// in user's webhooks.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id uuid.UUID) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/v1/webhooks/" + id.String() + "/deliveries", auth: accessAuth, out: &deliveries})
+	return deliveries, err
+}
+
+// OpenAPI gets the API's OpenAPI 3.1 spec.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var spec []byte
+	err := c.do(ctx, call{method: http.MethodGet, path: "/api/openapi.json", out: &spec})
+	return spec, err
+}
+
+// The admin calls below, except AdminMetrics, only work against a server
+// running on the dev platform. The Polka webhook isn't covered, it's Polka's to
+// call.
+
+// AdminMetrics gets the admin visit counts page, HTML.
+func (c *Client) AdminMetrics(ctx context.Context) (string, error) {
+	var page []byte
+	err := c.do(ctx, call{method: http.MethodGet, path: "/admin/metrics", out: &page})
+	return string(page), err
+}
+
+// AdminReset deletes every user and resets the visit count.
+func (c *Client) AdminReset(ctx context.Context) error {
+	return c.do(ctx, call{method: http.MethodPost, path: "/admin/reset"})
+}
+
+// AdminReplayPolkaEvent re-applies a stored Polka event.
+func (c *Client) AdminReplayPolkaEvent(ctx context.Context, eventID string) error {
+	return c.do(ctx, call{method: http.MethodPost, path: "/admin/polka/events/" + url.PathEscape(eventID) + "/replay"})
+}
+
+// AdminCreateWebhook registers a webhook for every user's events.
+func (c *Client) AdminCreateWebhook(ctx context.Context, target string, events []string) (Webhook, error) {
+	var hook Webhook
+	err := c.do(ctx, call{method: http.MethodPost, path: "/admin/webhooks", body: webhookRequest{target, events}, out: &hook})
+	return hook, err
+}
+
+// AdminListWebhookDeliveries lists the most recent deliveries of any webhook.
+func (c *Client) AdminListWebhookDeliveries(ctx context.Context, id uuid.UUID) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := c.do(ctx, call{method: http.MethodGet, path: "/admin/webhooks/" + id.String() + "/deliveries", out: &deliveries})
+	return deliveries, err
+}
@@ -0,0 +1,90 @@
+package chirpyclient
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User is a Chirpy account.
+type User struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// Chirp is a post of up to 140 characters. Author is only set when it was
+// asked for, see ListChirpsOptions.IncludeAuthor.
+type Chirp struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Author    *Author    `json:"author,omitempty"`
+	Links     ChirpLinks `json:"links"`
+}
+
+// Author is the public summary of a chirp's author.
+type Author struct {
+	ID          uuid.UUID `json:"id"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+// ChirpLinks are the API paths of a chirp and of its author's chirps.
+type ChirpLinks struct {
+	Self         string `json:"self"`
+	AuthorChirps string `json:"author_chirps"`
+}
+
+// ListChirpsOptions filters and sorts ListChirps, the zero value lists every
+// chirp, oldest first.
+type ListChirpsOptions struct {
+	AuthorID uuid.UUID
+	// Since is inclusive, Until exclusive
+	Since time.Time
+	Until time.Time
+	// Hashtag is with or without the #
+	Hashtag string
+	// Search matches anywhere in the body, case insensitive
+	Search      string
+	NewestFirst bool
+	// IncludeAuthor embeds each chirp's Author
+	IncludeAuthor bool
+}
+
+// Subscription is a user's Chirpy Red subscription.
+type Subscription struct {
+	Plan              string     `json:"plan"`
+	Status            string     `json:"status"`
+	Active            bool       `json:"active"`
+	CurrentPeriodEnd  time.Time  `json:"current_period_end"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	CanceledAt        *time.Time `json:"canceled_at,omitempty"`
+}
+
+// Webhook is an outbound webhook registration. Secret, used to check the
+// signature of its deliveries, is only set when it's created.
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is one entry of a webhook's delivery log.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode *int32     `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+}
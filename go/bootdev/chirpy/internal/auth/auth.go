@@ -10,26 +10,17 @@ import (
 
 	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes the given password using bcrypt and returns the hashed password as a string.
+// HashPassword hashes the given password with the DefaultHasher (Argon2id) and returns the encoded hash.
 func HashPassword(password string) (string, error) {
-	encryptedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	s := string(encryptedPassword)
-	return s, nil
+	return DefaultHasher.Hash(password)
 }
 
 // CheckPasswordHash checks if the provided password matches the hashed password.
+// Both Argon2id and legacy bcrypt hashes are accepted.
 func CheckPasswordHash(hash, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		return err
-	}
-	return nil
+	return DefaultHasher.Verify(hash, password)
 }
 
 type CustomClaims struct {
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrPasswordMismatch is returned when a password does not match its hash.
+	ErrPasswordMismatch = errors.New("password does not match")
+	// ErrUnknownHashAlgorithm is returned when a hash was not produced by a supported algorithm.
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	// ErrMalformedHash is returned when a hash names a supported algorithm but can't be decoded.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// PasswordHasher hashes and verifies passwords. Hashes are self-describing, they
+// carry their algorithm and parameters, so old hashes keep verifying after the
+// defaults change and NeedsRehash can tell when one should be upgraded.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) error
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idParams are the tunable cost parameters for Argon2id.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follow the OWASP password storage recommendation (19 MiB, t=2, p=1).
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with Argon2id in the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash). It still verifies legacy bcrypt
+// hashes, and reports them as needing a rehash.
+type Argon2idHasher struct {
+	Params Argon2idParams
+}
+
+// NewArgon2idHasher returns an Argon2idHasher using the given params.
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{Params: params}
+}
+
+// DefaultHasher is the hasher used by HashPassword and CheckPasswordHash.
+var DefaultHasher PasswordHasher = NewArgon2idHasher(DefaultArgon2idParams)
+
+const (
+	algArgon2id = "argon2id"
+	algBcrypt   = "bcrypt"
+)
+
+// Hash hashes the password with a fresh random salt.
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	return encodeArgon2id(h.Params, salt, key), nil
+}
+
+// Verify checks the password against an Argon2id or legacy bcrypt hash.
+func (h *Argon2idHasher) Verify(hash, password string) error {
+	switch hashAlgorithm(hash) {
+	case algArgon2id:
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case algBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrPasswordMismatch
+		}
+		return err
+	default:
+		return ErrUnknownHashAlgorithm
+	}
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// with params that differ from the hasher's current ones.
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	if hashAlgorithm(hash) != algArgon2id {
+		return true
+	}
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params != h.Params
+}
+
+// hashAlgorithm identifies the algorithm a stored hash was produced with.
+func hashAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return algArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return algBcrypt
+	default:
+		return ""
+	}
+}
+
+func encodeArgon2id(p Argon2idParams, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	var p Argon2idParams
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism)
+	// argon2.IDKey panics on zero time or threads, and needs 8 KiB per thread
+	if err != nil || p.Iterations == 0 || p.Parallelism == 0 || p.Memory < 8*uint32(p.Parallelism) {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap params keep the tests fast
+var testParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher(t *testing.T) {
+	h := NewArgon2idHasher(testParams)
+	hash, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash() failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %v, want argon2id PHC string", hash)
+	}
+	// "$salt$key", to put behind other params
+	saltAndKey := hash[strings.LastIndex(hash[:strings.LastIndex(hash, "$")], "$"):]
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		hash        string
+		password    string
+		wantErr     error
+		needsRehash bool
+	}{
+		{
+			name:        "Argon2id hash verifies",
+			hash:        hash,
+			password:    "correct horse battery staple",
+			wantErr:     nil,
+			needsRehash: false,
+		},
+		{
+			name:        "Argon2id hash rejects wrong password",
+			hash:        hash,
+			password:    "Tr0ub4dor&3",
+			wantErr:     ErrPasswordMismatch,
+			needsRehash: false,
+		},
+		{
+			name:        "Legacy bcrypt hash verifies and needs rehash",
+			hash:        string(legacy),
+			password:    "correct horse battery staple",
+			wantErr:     nil,
+			needsRehash: true,
+		},
+		{
+			name:        "Legacy bcrypt hash rejects wrong password",
+			hash:        string(legacy),
+			password:    "Tr0ub4dor&3",
+			wantErr:     ErrPasswordMismatch,
+			needsRehash: true,
+		},
+		{
+			name:        "Unknown algorithm is rejected",
+			hash:        "plaintext",
+			password:    "plaintext",
+			wantErr:     ErrUnknownHashAlgorithm,
+			needsRehash: true,
+		},
+		{
+			name:        "Zero iterations are rejected",
+			hash:        "$argon2id$v=19$m=64,t=0,p=1" + saltAndKey,
+			password:    "correct horse battery staple",
+			wantErr:     ErrMalformedHash,
+			needsRehash: true,
+		},
+		{
+			name:        "Zero parallelism is rejected",
+			hash:        "$argon2id$v=19$m=64,t=1,p=0" + saltAndKey,
+			password:    "correct horse battery staple",
+			wantErr:     ErrMalformedHash,
+			needsRehash: true,
+		},
+		{
+			name:        "Less than 8 KiB per thread is rejected",
+			hash:        "$argon2id$v=19$m=15,t=1,p=2" + saltAndKey,
+			password:    "correct horse battery staple",
+			wantErr:     ErrMalformedHash,
+			needsRehash: true,
+		},
+		{
+			name:        "Malformed argon2id hash is rejected",
+			hash:        "$argon2id$v=19$m=64,t=1,p=1$nope",
+			password:    "correct horse battery staple",
+			wantErr:     ErrMalformedHash,
+			needsRehash: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := h.Verify(tt.hash, tt.password)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", gotErr, tt.wantErr)
+			}
+			if got := h.NeedsRehash(tt.hash); got != tt.needsRehash {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.needsRehash)
+			}
+		})
+	}
+
+	t.Run("Changed params need rehash", func(t *testing.T) {
+		stronger := testParams
+		stronger.Iterations = 2
+		if !NewArgon2idHasher(stronger).NeedsRehash(hash) {
+			t.Error("NeedsRehash() = false, want true")
+		}
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("# common passwords\npassword123\n\nletmein!!\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write breached list: %v", err)
+	}
+	policy := NewPasswordPolicy(8, 16)
+	err = policy.LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{name: "Acceptable password", password: "hunter2hunter2", wantErr: nil},
+		{name: "Empty password", password: "", wantErr: ErrPasswordTooShort},
+		{name: "Too short", password: "short", wantErr: ErrPasswordTooShort},
+		{name: "Length counts characters not bytes", password: "pässwörd", wantErr: nil},
+		{name: "Too long", password: strings.Repeat("a", 17), wantErr: ErrPasswordTooLong},
+		{name: "Breached password", password: "password123", wantErr: ErrPasswordBreached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := policy.Validate(tt.password)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password appears in a list of breached passwords")
+)
+
+const (
+	DefaultPasswordMinLength = 8
+	DefaultPasswordMaxLength = 128
+)
+
+// PasswordPolicy decides which passwords users may choose. Lengths are counted
+// in characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy returns a policy with the given length bounds and an empty breached list.
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		breached:  map[string]struct{}{},
+	}
+}
+
+// LoadBreachedPasswords reads a breached-password list, one password per line.
+// Blank lines and lines starting with '#' are skipped.
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if p.breached == nil {
+		p.breached = map[string]struct{}{}
+	}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[line] = struct{}{}
+	}
+	return s.Err()
+}
+
+// Validate returns an error describing why the password is not allowed, or nil.
+func (p *PasswordPolicy) Validate(password string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("%w: must be at most %d characters", ErrPasswordTooLong, p.MaxLength)
+	}
+	if _, ok := p.breached[password]; ok {
+		return ErrPasswordBreached
+	}
+	return nil
+}
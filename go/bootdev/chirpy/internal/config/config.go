@@ -0,0 +1,349 @@
+// Package config loads chirpy's settings. Every setting has an environment
+// variable and can also come from .env or a YAML or TOML file, later sources
+// winning: defaults, then the config file, then .env, then the environment.
+package config
+
+import (
+	"bytes"
+	"chirpy/internal/auth"
+	"chirpy/internal/logging"
+	"chirpy/internal/tracing"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownDatabase means DB_URL points at no database Database recognises.
+var ErrUnknownDatabase = errors.New("DB_URL must be a postgres://, postgresql:// or sqlite:// URL, or a key=value Postgres DSN")
+
+// MinSecretLength is the shortest JWT_SECRET we accept, HS256 wants 256 bits.
+const MinSecretLength = 32
+
+// Config is every setting chirpy reads. The env tag names the variable, the
+// yaml and toml tags the config file key, and secret fields never get printed.
+type Config struct {
+	DatabaseURL           string        `env:"DB_URL" yaml:"db_url" toml:"db_url"`
+	Platform              string        `env:"PLATFORM" yaml:"platform" toml:"platform"`
+	JWTSecret             string        `env:"JWT_SECRET" yaml:"jwt_secret" toml:"jwt_secret" secret:"true"`
+	PolkaKey              string        `env:"POLKA_KEY" yaml:"polka_key" toml:"polka_key" secret:"true"`
+	AdminAPIKey           string        `env:"ADMIN_API_KEY" yaml:"admin_api_key" toml:"admin_api_key" secret:"true"`
+	PolkaAcceptAPIKey     bool          `env:"POLKA_ACCEPT_API_KEY" yaml:"polka_accept_api_key" toml:"polka_accept_api_key"`
+	Port                  int           `env:"PORT" yaml:"port" toml:"port"`
+	ReadTimeout           time.Duration `env:"READ_TIMEOUT" yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout          time.Duration `env:"WRITE_TIMEOUT" yaml:"write_timeout" toml:"write_timeout"`
+	AutoMigrate           bool          `env:"AUTO_MIGRATE" yaml:"auto_migrate" toml:"auto_migrate"`
+	ShutdownTimeout       time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	ShutdownDelay         time.Duration `env:"SHUTDOWN_DELAY" yaml:"shutdown_delay" toml:"shutdown_delay"`
+	HealthCheckTimeout    time.Duration `env:"HEALTH_CHECK_TIMEOUT" yaml:"health_check_timeout" toml:"health_check_timeout"`
+	DBMaxOpenConns        int           `env:"DB_MAX_OPEN_CONNS" yaml:"db_max_open_conns" toml:"db_max_open_conns"`
+	DBMaxIdleConns        int           `env:"DB_MAX_IDLE_CONNS" yaml:"db_max_idle_conns" toml:"db_max_idle_conns"`
+	DBConnMaxLifetime     time.Duration `env:"DB_CONN_MAX_LIFETIME" yaml:"db_conn_max_lifetime" toml:"db_conn_max_lifetime"`
+	DBConnMaxIdleTime     time.Duration `env:"DB_CONN_MAX_IDLE_TIME" yaml:"db_conn_max_idle_time" toml:"db_conn_max_idle_time"`
+	DBPingAttempts        int           `env:"DB_PING_ATTEMPTS" yaml:"db_ping_attempts" toml:"db_ping_attempts"`
+	LogFormat             string        `env:"LOG_FORMAT" yaml:"log_format" toml:"log_format"`
+	LogPII                bool          `env:"LOG_PII" yaml:"log_pii" toml:"log_pii"`
+	TraceExporter         string        `env:"TRACE_EXPORTER" yaml:"trace_exporter" toml:"trace_exporter"`
+	TraceFile             string        `env:"TRACE_FILE" yaml:"trace_file" toml:"trace_file"`
+	OTLPEndpoint          string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT" yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	PasswordMinLength     int           `env:"PASSWORD_MIN_LENGTH" yaml:"password_min_length" toml:"password_min_length"`
+	PasswordMaxLength     int           `env:"PASSWORD_MAX_LENGTH" yaml:"password_max_length" toml:"password_max_length"`
+	BreachedPasswordsFile string        `env:"BREACHED_PASSWORDS_FILE" yaml:"breached_passwords_file" toml:"breached_passwords_file"`
+}
+
+// Default is the configuration before any source is applied.
+func Default() Config {
+	return Config{
+		// Polka webhooks may still send "Authorization: ApiKey" while they move
+		// to signatures, turn this off once they're all signed
+		PolkaAcceptAPIKey:  true,
+		Port:               8080,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       10 * time.Second,
+		ShutdownTimeout:    15 * time.Second,
+		HealthCheckTimeout: 2 * time.Second,
+		DBMaxOpenConns:     25,
+		DBMaxIdleConns:     5,
+		DBConnMaxLifetime:  30 * time.Minute,
+		DBConnMaxIdleTime:  5 * time.Minute,
+		DBPingAttempts:     5,
+		LogFormat:          logging.FormatText,
+		TraceExporter:      tracing.ExporterNone,
+		TraceFile:          "traces.jsonl",
+		PasswordMinLength:  auth.DefaultPasswordMinLength,
+		PasswordMaxLength:  auth.DefaultPasswordMaxLength,
+	}
+}
+
+// Options says where Load looks.
+type Options struct {
+	// File is an optional .yaml, .yml or .toml config file.
+	File string
+	// EnvFile is the dotenv file, a missing one is fine. Defaults to ".env".
+	EnvFile string
+	// LookupEnv defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+}
+
+// Load builds the configuration from every source. It only fails on sources
+// it can't read or values it can't parse, call Validate before using it.
+func Load(opts Options) (Config, error) {
+	if opts.EnvFile == "" {
+		opts.EnvFile = ".env"
+	}
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+	cfg := Default()
+	if opts.File != "" {
+		err := cfg.loadFile(opts.File)
+		if err != nil {
+			return cfg, err
+		}
+	}
+	dotenv, err := godotenv.Read(opts.EnvFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cfg, fmt.Errorf("reading %s: %w", opts.EnvFile, err)
+	}
+	err = cfg.apply(func(name string) (string, bool) {
+		v, ok := dotenv[name]
+		return v, ok
+	})
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %w", opts.EnvFile, err)
+	}
+	return cfg, cfg.apply(opts.LookupEnv)
+}
+
+// loadFile decodes a YAML or TOML file over cfg, rejecting unknown keys so a
+// typo doesn't silently leave a default in place.
+func (cfg *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(b), cfg)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", md.Undecoded())
+		}
+	default:
+		return fmt.Errorf("config file %s: want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// apply sets every field whose variable lookup finds.
+func (cfg *Config) apply(lookup func(string) (string, bool)) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Tag.Get("env")
+		s, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		err := setField(v.Field(i), s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(f reflect.Value, s string) error {
+	switch f.Interface().(type) {
+	case string:
+		f.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
+
+// Databases DB_URL can point at, see Config.Database.
+const (
+	DatabasePostgres = "postgres"
+	DatabaseSQLite   = "sqlite"
+)
+
+// Database says which database DB_URL points at. postgres:// and postgresql://
+// URLs are Postgres, and so are lib/pq key=value DSNs such as
+// "host=localhost dbname=chirpy sslmode=disable". sqlite://path is SQLite. It
+// returns "" for anything else.
+func (cfg Config) Database() string {
+	url := cfg.DatabaseURL
+	switch {
+	case strings.HasPrefix(url, "postgres://"), strings.HasPrefix(url, "postgresql://"):
+		return DatabasePostgres
+	case strings.HasPrefix(url, "sqlite://"):
+		return DatabaseSQLite
+	case !strings.Contains(url, "://") && strings.Contains(url, "="):
+		return DatabasePostgres
+	}
+	return ""
+}
+
+// Validate reports every problem at once rather than the first.
+func (cfg Config) Validate() error {
+	return cfg.validate(true)
+}
+
+// ValidateForMigrate is Validate without the JWT_SECRET and POLKA_KEY checks,
+// running migrations doesn't need them.
+func (cfg Config) ValidateForMigrate() error {
+	return cfg.validate(false)
+}
+
+func (cfg Config) validate(secrets bool) error {
+	var errs []error
+	switch {
+	case cfg.DatabaseURL == "":
+		errs = append(errs, errors.New("DB_URL is required"))
+	case cfg.Database() == "":
+		errs = append(errs, ErrUnknownDatabase)
+	}
+	if secrets {
+		err := checkSecret(cfg.JWTSecret)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("JWT_SECRET %w", err))
+		}
+		if cfg.PolkaKey == "" {
+			errs = append(errs, errors.New("POLKA_KEY is required"))
+		}
+		// optional, without it the admin routes that need it refuse everyone
+		if cfg.AdminAPIKey != "" {
+			err := checkSecret(cfg.AdminAPIKey)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("ADMIN_API_KEY %w", err))
+			}
+		}
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT %d is not a valid port", cfg.Port))
+	}
+	if cfg.ReadTimeout <= 0 || cfg.WriteTimeout <= 0 {
+		errs = append(errs, errors.New("READ_TIMEOUT and WRITE_TIMEOUT must be positive"))
+	}
+	if cfg.ShutdownTimeout <= 0 || cfg.HealthCheckTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT and HEALTH_CHECK_TIMEOUT must be positive"))
+	}
+	if cfg.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("SHUTDOWN_DELAY can't be negative"))
+	}
+	if cfg.DBMaxOpenConns < 1 || cfg.DBMaxIdleConns < 0 || cfg.DBMaxIdleConns > cfg.DBMaxOpenConns {
+		errs = append(errs, fmt.Errorf("DB_MAX_IDLE_CONNS %d must be between 0 and DB_MAX_OPEN_CONNS %d, which must be at least 1", cfg.DBMaxIdleConns, cfg.DBMaxOpenConns))
+	}
+	if cfg.DBPingAttempts < 1 {
+		errs = append(errs, errors.New("DB_PING_ATTEMPTS must be at least 1"))
+	}
+	if cfg.LogFormat != logging.FormatText && cfg.LogFormat != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT %q must be %s or %s", cfg.LogFormat, logging.FormatText, logging.FormatJSON))
+	}
+	switch cfg.TraceExporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP:
+	case tracing.ExporterFile:
+		if cfg.TraceFile == "" {
+			errs = append(errs, errors.New("TRACE_FILE is required with TRACE_EXPORTER=file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER %q must be %s, %s or %s", cfg.TraceExporter, tracing.ExporterNone, tracing.ExporterFile, tracing.ExporterOTLP))
+	}
+	if cfg.PasswordMinLength < 1 || cfg.PasswordMinLength > cfg.PasswordMaxLength {
+		errs = append(errs, fmt.Errorf("PASSWORD_MIN_LENGTH %d must be between 1 and PASSWORD_MAX_LENGTH %d", cfg.PasswordMinLength, cfg.PasswordMaxLength))
+	}
+	return errors.Join(errs...)
+}
+
+// checkSecret rejects empty, short and low-variety secrets, e.g. a repeated
+// character or "changeme" padded out to length.
+func checkSecret(secret string) error {
+	if secret == "" {
+		return errors.New("is required")
+	}
+	if len(secret) < MinSecretLength {
+		return fmt.Errorf("must be at least %d characters, got %d", MinSecretLength, len(secret))
+	}
+	distinct := map[rune]bool{}
+	for _, r := range secret {
+		distinct[r] = true
+	}
+	if len(distinct) < 8 {
+		return errors.New("is too repetitive, generate one with `openssl rand -base64 64`")
+	}
+	return nil
+}
+
+// Print writes the configuration as NAME=value lines, secrets redacted and
+// the database password hidden.
+func (cfg Config) Print(w io.Writer) error {
+	v := reflect.ValueOf(cfg)
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		value := fmt.Sprint(v.Field(i).Interface())
+		switch {
+		case field.Tag.Get("secret") == "true" && value != "":
+			value = "[REDACTED]"
+		case field.Name == "DatabaseURL":
+			value = redactURL(value)
+		}
+		_, err := fmt.Fprintf(w, "%s=%s\n", field.Tag.Get("env"), value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		// can't tell where a password would be, don't risk it
+		return "[REDACTED]"
+	}
+	return u.Redacted()
+}
+
+// Addr is the address to listen on.
+func (cfg Config) Addr() string {
+	return ":" + strconv.Itoa(cfg.Port)
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
@@ -143,3 +144,82 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 	)
 	return i, err
 }
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id FROM chirps
+WHERE id = $1
+FOR UPDATE
+`
+
+// locks the chirp until the transaction ends, so a check made on it still
+// holds when the transaction writes
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const listChirps = `-- name: ListChirps :many
+SELECT id, created_at, updated_at, body, user_id FROM chirps
+WHERE ($1::uuid IS NULL OR user_id = $1)
+AND ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND ($4::text IS NULL OR body ~* ('(^|[^[:alnum:]_])#' || $4 || '([^[:alnum:]_]|$)'))
+AND ($5::text IS NULL OR strpos(lower(body), lower($5)) > 0)
+ORDER BY
+  CASE WHEN $6::bool THEN created_at END DESC,
+  created_at ASC
+`
+
+type ListChirpsParams struct {
+	AuthorID    uuid.NullUUID  `json:"author_id"`
+	Since       sql.NullTime   `json:"since"`
+	Until       sql.NullTime   `json:"until"`
+	Hashtag     sql.NullString `json:"hashtag"`
+	Search      sql.NullString `json:"search"`
+	NewestFirst bool           `json:"newest_first"`
+}
+
+// every filter is optional, a NULL one matches every chirp
+func (q *Queries) ListChirps(ctx context.Context, arg ListChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.Hashtag,
+		arg.Search,
+		arg.NewestFirst,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,27 @@
+package database
+
+import "strings"
+
+// HasHashtag reports whether body has #tag as a whole word, ignoring case, the
+// same match ListChirps' hashtag filter does on Postgres. Backends without
+// regular expressions filter with this instead.
+func HasHashtag(body, tag string) bool {
+	body, want := strings.ToLower(body), "#"+strings.ToLower(tag)
+	for i := 0; ; {
+		j := strings.Index(body[i:], want)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(want)
+		if (start == 0 || !isWordByte(body[start-1])) && (end == len(body) || !isWordByte(body[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+// isWordByte is [[:alnum:]_], counting any non-ASCII byte as a letter.
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 0x80 ||
+		('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
@@ -0,0 +1,697 @@
+// Package memstore is an in-memory database.Store for tests and tools that
+// don't want a Postgres. It mimics what the queries and schema do: rows come
+// back in the queries' ORDER BY, missing rows are sql.ErrNoRows, deleting a user
+// cascades like ON DELETE CASCADE, and key and foreign key violations are the
+// same *pq.Error Postgres returns.
+package memstore
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation     = pq.ErrorCode("23505")
+	codeForeignKeyViolation = pq.ErrorCode("23503")
+)
+
+// tables is everything the store holds, one map per table.
+type tables struct {
+	users                map[uuid.UUID]database.User
+	chirps               map[uuid.UUID]database.Chirp
+	refreshTokens        map[string]database.RefreshToken
+	subscriptions        map[uuid.UUID]database.Subscription
+	webhookEvents        map[string]database.WebhookEvent
+	webhookSubscriptions map[uuid.UUID]database.WebhookSubscription
+	webhookDeliveries    map[uuid.UUID]database.WebhookDelivery
+	outboxEvents         map[uuid.UUID]database.OutboxEvent
+}
+
+func (t *tables) clone() *tables {
+	return &tables{
+		users:                maps.Clone(t.users),
+		chirps:               maps.Clone(t.chirps),
+		refreshTokens:        maps.Clone(t.refreshTokens),
+		subscriptions:        maps.Clone(t.subscriptions),
+		webhookEvents:        maps.Clone(t.webhookEvents),
+		webhookSubscriptions: maps.Clone(t.webhookSubscriptions),
+		webhookDeliveries:    maps.Clone(t.webhookDeliveries),
+		outboxEvents:         maps.Clone(t.outboxEvents),
+	}
+}
+
+// Store is a thread-safe in-memory database.Store.
+type Store struct {
+	mu   *sync.Mutex
+	t    *tables
+	last *time.Time // last timestamp handed out by now
+	inTx bool
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{
+		mu: &sync.Mutex{},
+		t: &tables{
+			users:                map[uuid.UUID]database.User{},
+			chirps:               map[uuid.UUID]database.Chirp{},
+			refreshTokens:        map[string]database.RefreshToken{},
+			subscriptions:        map[uuid.UUID]database.Subscription{},
+			webhookEvents:        map[string]database.WebhookEvent{},
+			webhookSubscriptions: map[uuid.UUID]database.WebhookSubscription{},
+			webhookDeliveries:    map[uuid.UUID]database.WebhookDelivery{},
+			outboxEvents:         map[uuid.UUID]database.OutboxEvent{},
+		},
+		last: &time.Time{},
+	}
+}
+
+// lock takes the mutex unless we're inside InTx, which already holds it.
+func (s *Store) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// now stands in for NOW(). It never hands out the same time twice so that
+// ORDER BY created_at is deterministic.
+func (s *Store) now() time.Time {
+	now := time.Now().UTC()
+	if !now.After(*s.last) {
+		now = s.last.Add(time.Microsecond)
+	}
+	*s.last = now
+	return now
+}
+
+// InTx holds the lock for the whole of fn, so transactions are serialised, and
+// puts every table back the way it was if fn returns an error.
+func (s *Store) InTx(ctx context.Context, fn func(database.Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := s.t.clone()
+	err := fn(&Store{mu: s.mu, t: s.t, last: s.last, inTx: true})
+	if err != nil {
+		*s.t = *snapshot
+	}
+	return err
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{Code: codeUniqueViolation, Constraint: constraint, Message: "duplicate key value violates unique constraint \"" + constraint + "\""}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{Code: codeForeignKeyViolation, Constraint: constraint, Message: "insert or update violates foreign key constraint \"" + constraint + "\""}
+}
+
+// sortedBy returns the rows ordered by key, ascending.
+func sortedBy[K comparable, V any](rows map[K]V, match func(V) bool, key func(V) time.Time) []V {
+	var items []V
+	for _, row := range rows {
+		if match(row) {
+			items = append(items, row)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return key(items[i]).Before(key(items[j]))
+	})
+	return items
+}
+
+func limit[V any](items []V, n int32) []V {
+	if int(n) < len(items) {
+		return items[:n]
+	}
+	return items
+}
+
+// -- chirps
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	defer s.lock()()
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return database.Chirp{}, foreignKeyViolation("chirps_user_id_fkey")
+	}
+	now := s.now()
+	chirp := database.Chirp{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Body: arg.Body, UserID: arg.UserID}
+	s.t.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (s *Store) DeleteAllChirps(ctx context.Context) error {
+	defer s.lock()()
+	clear(s.t.chirps)
+	return nil
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+	delete(s.t.chirps, id)
+	return nil
+}
+
+func chirpCreatedAt(c database.Chirp) time.Time { return c.CreatedAt }
+
+func (s *Store) GetAllChirps(ctx context.Context) ([]database.Chirp, error) {
+	defer s.lock()()
+	return sortedBy(s.t.chirps, func(database.Chirp) bool { return true }, chirpCreatedAt), nil
+}
+
+func (s *Store) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	defer s.lock()()
+	return sortedBy(s.t.chirps, func(c database.Chirp) bool { return c.UserID == userID }, chirpCreatedAt), nil
+}
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	defer s.lock()()
+	chirp, ok := s.t.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+// GetChirpForUpdate is GetChirp, InTx already holds the lock on everything.
+func (s *Store) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	return s.GetChirp(ctx, id)
+}
+
+func (s *Store) ListChirps(ctx context.Context, arg database.ListChirpsParams) ([]database.Chirp, error) {
+	defer s.lock()()
+	chirps := sortedBy(s.t.chirps, func(c database.Chirp) bool {
+		return (!arg.AuthorID.Valid || c.UserID == arg.AuthorID.UUID) &&
+			(!arg.Since.Valid || !c.CreatedAt.Before(arg.Since.Time)) &&
+			(!arg.Until.Valid || c.CreatedAt.Before(arg.Until.Time)) &&
+			(!arg.Hashtag.Valid || database.HasHashtag(c.Body, arg.Hashtag.String)) &&
+			(!arg.Search.Valid || strings.Contains(strings.ToLower(c.Body), strings.ToLower(arg.Search.String)))
+	}, chirpCreatedAt)
+	if arg.NewestFirst {
+		slices.Reverse(chirps)
+	}
+	return chirps, nil
+}
+
+// -- users
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	defer s.lock()()
+	now := s.now()
+	user := database.User{ID: uuid.New(), CreatedAt: now, UpdatedAt: now, Email: arg.Email, HashedPassword: arg.HashedPassword}
+	s.t.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Store) DeleteAllUsers(ctx context.Context) error {
+	defer s.lock()()
+	for id := range s.t.users {
+		s.deleteUser(id)
+	}
+	return nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+	s.deleteUser(id)
+	return nil
+}
+
+// deleteUser deletes a user and, like ON DELETE CASCADE, everything that references them.
+func (s *Store) deleteUser(id uuid.UUID) {
+	delete(s.t.users, id)
+	maps.DeleteFunc(s.t.chirps, func(_ uuid.UUID, c database.Chirp) bool { return c.UserID == id })
+	maps.DeleteFunc(s.t.refreshTokens, func(_ string, rt database.RefreshToken) bool { return rt.UserID == id })
+	delete(s.t.subscriptions, id)
+	for subID, sub := range s.t.webhookSubscriptions {
+		if sub.UserID.Valid && sub.UserID.UUID == id {
+			s.deleteWebhookSubscription(subID)
+		}
+	}
+}
+
+// GetUserByEmail returns the oldest user with the email, emails aren't unique in the schema.
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	defer s.lock()()
+	users := sortedBy(s.t.users, func(u database.User) bool { return u.Email == email }, func(u database.User) time.Time { return u.CreatedAt })
+	if len(users) == 0 {
+		return database.User{}, sql.ErrNoRows
+	}
+	return users[0], nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	defer s.lock()()
+	user, ok := s.t.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+// GetUserByIDForUpdate is GetUserByID, InTx already holds the lock on
+// everything.
+func (s *Store) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return s.GetUserByID(ctx, id)
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	defer s.lock()()
+	user, ok := s.t.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = s.now()
+	s.t.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	defer s.lock()()
+	user, ok := s.t.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	user.HashedPassword = arg.HashedPassword
+	s.t.users[user.ID] = user
+	return nil
+}
+
+// -- refresh tokens
+
+func (s *Store) CountActiveRefreshTokens(ctx context.Context) (int64, error) {
+	defer s.lock()()
+	now := s.now()
+	var n int64
+	for _, rt := range s.t.refreshTokens {
+		if !rt.RevokedAt.Valid && rt.ExpiresAt.After(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (string, error) {
+	defer s.lock()()
+	if _, ok := s.t.refreshTokens[arg.Token]; ok {
+		return "", uniqueViolation("refresh_tokens_pkey")
+	}
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return "", foreignKeyViolation("refresh_tokens_user_id_fkey")
+	}
+	now := s.now()
+	s.t.refreshTokens[arg.Token] = database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: now,
+		UpdatedAt: now,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return arg.Token, nil
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	defer s.lock()()
+	rt, ok := s.t.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return rt, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+	defer s.lock()()
+	rt, ok := s.t.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	rt.RevokedAt = sql.NullTime{Time: s.now(), Valid: true}
+	s.t.refreshTokens[token] = rt
+	return nil
+}
+
+// -- subscriptions
+
+func (s *Store) CancelSubscriptionAtPeriodEnd(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	defer s.lock()()
+	sub, ok := s.t.subscriptions[userID]
+	if !ok || sub.Status != "active" {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	now := s.now()
+	sub.CancelAtPeriodEnd = true
+	sub.CanceledAt = sql.NullTime{Time: now, Valid: true}
+	sub.UpdatedAt = now
+	s.t.subscriptions[userID] = sub
+	return sub, nil
+}
+
+func (s *Store) EndSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	defer s.lock()()
+	sub, ok := s.t.subscriptions[userID]
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	now := s.now()
+	sub.Status = "canceled"
+	sub.CurrentPeriodEnd = now
+	if !sub.CanceledAt.Valid {
+		sub.CanceledAt = sql.NullTime{Time: now, Valid: true}
+	}
+	sub.UpdatedAt = now
+	s.t.subscriptions[userID] = sub
+	return sub, nil
+}
+
+func (s *Store) ExpireLapsedSubscriptions(ctx context.Context) (int64, error) {
+	defer s.lock()()
+	now := s.now()
+	var n int64
+	for userID, sub := range s.t.subscriptions {
+		if sub.Status == "active" && !sub.CurrentPeriodEnd.After(now) {
+			sub.Status = "expired"
+			sub.UpdatedAt = now
+			s.t.subscriptions[userID] = sub
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) GetSubscriptionByUserID(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	defer s.lock()()
+	sub, ok := s.t.subscriptions[userID]
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	return sub, nil
+}
+
+func (s *Store) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	defer s.lock()()
+	if _, ok := s.t.users[arg.UserID]; !ok {
+		return database.Subscription{}, foreignKeyViolation("subscriptions_user_id_fkey")
+	}
+	now := s.now()
+	sub, ok := s.t.subscriptions[arg.UserID]
+	if !ok {
+		sub = database.Subscription{ID: uuid.New(), CreatedAt: now, UserID: arg.UserID}
+	}
+	if sub.Status != "active" {
+		sub.CancelAtPeriodEnd = false
+		sub.CanceledAt = sql.NullTime{}
+	}
+	sub.UpdatedAt = now
+	sub.Plan = arg.Plan
+	sub.Status = "active"
+	sub.CurrentPeriodEnd = arg.CurrentPeriodEnd
+	s.t.subscriptions[arg.UserID] = sub
+	return sub, nil
+}
+
+// -- inbound webhook events
+
+// CreateWebhookEvent returns sql.ErrNoRows for an ID it already has, like ON CONFLICT DO NOTHING RETURNING.
+func (s *Store) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	defer s.lock()()
+	if _, ok := s.t.webhookEvents[arg.ID]; ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	event := database.WebhookEvent{ID: arg.ID, EventType: arg.EventType, Payload: arg.Payload, ReceivedAt: s.now()}
+	s.t.webhookEvents[event.ID] = event
+	return event, nil
+}
+
+func (s *Store) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	defer s.lock()()
+	event, ok := s.t.webhookEvents[id]
+	if !ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	return event, nil
+}
+
+// ClaimWebhookEvent returns sql.ErrNoRows unless the event exists and isn't
+// processed yet.
+func (s *Store) ClaimWebhookEvent(ctx context.Context, id string) (string, error) {
+	defer s.lock()()
+	event, ok := s.t.webhookEvents[id]
+	if !ok || event.ProcessedAt.Valid {
+		return "", sql.ErrNoRows
+	}
+	event.ProcessedAt = sql.NullTime{Time: s.now(), Valid: true}
+	s.t.webhookEvents[id] = event
+	return id, nil
+}
+
+func (s *Store) MarkWebhookEventProcessed(ctx context.Context, id string) error {
+	defer s.lock()()
+	event, ok := s.t.webhookEvents[id]
+	if !ok {
+		return nil
+	}
+	event.ProcessedAt = sql.NullTime{Time: s.now(), Valid: true}
+	s.t.webhookEvents[id] = event
+	return nil
+}
+
+// -- outbound webhooks
+
+// CreateWebhookDelivery does nothing if the subscription already has a delivery for the event.
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	defer s.lock()()
+	if _, ok := s.t.webhookSubscriptions[arg.SubscriptionID]; !ok {
+		return foreignKeyViolation("webhook_deliveries_subscription_id_fkey")
+	}
+	for _, d := range s.t.webhookDeliveries {
+		if d.SubscriptionID == arg.SubscriptionID && d.EventID == arg.EventID {
+			return nil
+		}
+	}
+	now := s.now()
+	d := database.WebhookDelivery{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		SubscriptionID: arg.SubscriptionID,
+		EventID:        arg.EventID,
+		EventType:      arg.EventType,
+		Payload:        arg.Payload,
+		Status:         "pending",
+		NextAttemptAt:  now,
+	}
+	s.t.webhookDeliveries[d.ID] = d
+	return nil
+}
+
+func (s *Store) CreateWebhookSubscription(ctx context.Context, arg database.CreateWebhookSubscriptionParams) (database.WebhookSubscription, error) {
+	defer s.lock()()
+	if arg.UserID.Valid {
+		if _, ok := s.t.users[arg.UserID.UUID]; !ok {
+			return database.WebhookSubscription{}, foreignKeyViolation("webhook_subscriptions_user_id_fkey")
+		}
+	}
+	now := s.now()
+	sub := database.WebhookSubscription{
+		ID:         uuid.New(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		UserID:     arg.UserID,
+		Url:        arg.Url,
+		EventTypes: arg.EventTypes,
+		Secret:     arg.Secret,
+	}
+	s.t.webhookSubscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+func (s *Store) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+	s.deleteWebhookSubscription(id)
+	return nil
+}
+
+// deleteWebhookSubscription deletes a subscription and its deliveries.
+func (s *Store) deleteWebhookSubscription(id uuid.UUID) {
+	delete(s.t.webhookSubscriptions, id)
+	maps.DeleteFunc(s.t.webhookDeliveries, func(_ uuid.UUID, d database.WebhookDelivery) bool {
+		return d.SubscriptionID == id
+	})
+}
+
+func (s *Store) GetWebhookSubscription(ctx context.Context, id uuid.UUID) (database.WebhookSubscription, error) {
+	defer s.lock()()
+	sub, ok := s.t.webhookSubscriptions[id]
+	if !ok {
+		return database.WebhookSubscription{}, sql.ErrNoRows
+	}
+	return sub, nil
+}
+
+// ClaimDueWebhookDeliveries leases the due deliveries until arg.LeaseUntil,
+// the lock makes it atomic like FOR UPDATE SKIP LOCKED.
+func (s *Store) ClaimDueWebhookDeliveries(ctx context.Context, arg database.ClaimDueWebhookDeliveriesParams) ([]database.ClaimDueWebhookDeliveriesRow, error) {
+	defer s.lock()()
+	now := s.now()
+	due := sortedBy(s.t.webhookDeliveries, func(d database.WebhookDelivery) bool {
+		return d.Status == "pending" && !d.NextAttemptAt.After(now)
+	}, func(d database.WebhookDelivery) time.Time { return d.NextAttemptAt })
+	var items []database.ClaimDueWebhookDeliveriesRow
+	for _, d := range limit(due, arg.BatchSize) {
+		d.NextAttemptAt = arg.LeaseUntil
+		d.UpdatedAt = now
+		s.t.webhookDeliveries[d.ID] = d
+		sub := s.t.webhookSubscriptions[d.SubscriptionID]
+		items = append(items, database.ClaimDueWebhookDeliveriesRow{
+			ID:             d.ID,
+			SubscriptionID: d.SubscriptionID,
+			EventID:        d.EventID,
+			EventType:      d.EventType,
+			Payload:        d.Payload,
+			Attempts:       d.Attempts,
+			Url:            sub.Url,
+			Secret:         sub.Secret,
+		})
+	}
+	return items, nil
+}
+
+// ListWebhookDeliveries returns the subscription's deliveries, newest first.
+func (s *Store) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	defer s.lock()()
+	items := sortedBy(s.t.webhookDeliveries, func(d database.WebhookDelivery) bool {
+		return d.SubscriptionID == arg.SubscriptionID
+	}, func(d database.WebhookDelivery) time.Time { return d.CreatedAt })
+	slices.Reverse(items)
+	return limit(items, arg.Limit), nil
+}
+
+func webhookSubscriptionCreatedAt(sub database.WebhookSubscription) time.Time { return sub.CreatedAt }
+
+// ListWebhookSubscriptionsByUser matches nothing for a NULL user, like user_id = NULL.
+func (s *Store) ListWebhookSubscriptionsByUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookSubscription, error) {
+	defer s.lock()()
+	return sortedBy(s.t.webhookSubscriptions, func(sub database.WebhookSubscription) bool {
+		return userID.Valid && sub.UserID == userID
+	}, webhookSubscriptionCreatedAt), nil
+}
+
+func (s *Store) ListWebhookSubscriptionsForEvent(ctx context.Context, arg database.ListWebhookSubscriptionsForEventParams) ([]database.WebhookSubscription, error) {
+	defer s.lock()()
+	return sortedBy(s.t.webhookSubscriptions, func(sub database.WebhookSubscription) bool {
+		if sub.UserID.Valid && sub.UserID != arg.ActorID {
+			return false
+		}
+		return slices.Contains(strings.Split(sub.EventTypes, ","), arg.EventType)
+	}, webhookSubscriptionCreatedAt), nil
+}
+
+func (s *Store) MarkWebhookDeliveryFailed(ctx context.Context, arg database.MarkWebhookDeliveryFailedParams) error {
+	defer s.lock()()
+	d, ok := s.t.webhookDeliveries[arg.ID]
+	if !ok {
+		return nil
+	}
+	now := s.now()
+	d.Status = arg.Status
+	d.Attempts++
+	d.NextAttemptAt = arg.NextAttemptAt
+	d.LastAttemptAt = sql.NullTime{Time: now, Valid: true}
+	d.LastStatusCode = arg.LastStatusCode
+	d.LastError = arg.LastError
+	d.UpdatedAt = now
+	s.t.webhookDeliveries[d.ID] = d
+	return nil
+}
+
+func (s *Store) MarkWebhookDeliverySucceeded(ctx context.Context, arg database.MarkWebhookDeliverySucceededParams) error {
+	defer s.lock()()
+	d, ok := s.t.webhookDeliveries[arg.ID]
+	if !ok {
+		return nil
+	}
+	now := s.now()
+	d.Status = "succeeded"
+	d.Attempts++
+	d.LastAttemptAt = sql.NullTime{Time: now, Valid: true}
+	d.LastStatusCode = arg.LastStatusCode
+	d.LastError = sql.NullString{}
+	d.UpdatedAt = now
+	s.t.webhookDeliveries[d.ID] = d
+	return nil
+}
+
+// -- outbox
+
+func (s *Store) CreateOutboxEvent(ctx context.Context, arg database.CreateOutboxEventParams) error {
+	defer s.lock()()
+	if _, ok := s.t.outboxEvents[arg.ID]; ok {
+		return uniqueViolation("outbox_events_pkey")
+	}
+	now := s.now()
+	s.t.outboxEvents[arg.ID] = database.OutboxEvent{
+		ID:            arg.ID,
+		CreatedAt:     now,
+		EventType:     arg.EventType,
+		ActorID:       arg.ActorID,
+		Payload:       arg.Payload,
+		NextAttemptAt: now,
+	}
+	return nil
+}
+
+func (s *Store) ListDueOutboxEvents(ctx context.Context, n int32) ([]database.OutboxEvent, error) {
+	defer s.lock()()
+	now := s.now()
+	items := sortedBy(s.t.outboxEvents, func(e database.OutboxEvent) bool {
+		return !e.DispatchedAt.Valid && !e.ParkedAt.Valid && !e.NextAttemptAt.After(now)
+	}, func(e database.OutboxEvent) time.Time { return e.NextAttemptAt })
+	return limit(items, n), nil
+}
+
+func (s *Store) MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID) error {
+	defer s.lock()()
+	e, ok := s.t.outboxEvents[id]
+	if !ok {
+		return nil
+	}
+	e.DispatchedAt = sql.NullTime{Time: s.now(), Valid: true}
+	s.t.outboxEvents[id] = e
+	return nil
+}
+
+func (s *Store) MarkOutboxEventFailed(ctx context.Context, arg database.MarkOutboxEventFailedParams) error {
+	defer s.lock()()
+	e, ok := s.t.outboxEvents[arg.ID]
+	if !ok {
+		return nil
+	}
+	e.Attempts++
+	e.NextAttemptAt = arg.NextAttemptAt
+	e.LastError = arg.LastError
+	e.ParkedAt = sql.NullTime{}
+	if arg.Park {
+		e.ParkedAt = sql.NullTime{Time: s.now(), Valid: true}
+	}
+	s.t.outboxEvents[arg.ID] = e
+	return nil
+}
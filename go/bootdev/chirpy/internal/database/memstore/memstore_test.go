@@ -0,0 +1,13 @@
+package memstore
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/database/storetest"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return New()
+	})
+}
@@ -19,6 +19,19 @@ type Chirp struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
+type OutboxEvent struct {
+	ID            uuid.UUID      `json:"id"`
+	CreatedAt     time.Time      `json:"created_at"`
+	EventType     string         `json:"event_type"`
+	ActorID       uuid.NullUUID  `json:"actor_id"`
+	Payload       string         `json:"payload"`
+	DispatchedAt  sql.NullTime   `json:"dispatched_at"`
+	Attempts      int32          `json:"attempts"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	LastError     sql.NullString `json:"last_error"`
+	ParkedAt      sql.NullTime   `json:"parked_at"`
+}
+
 type RefreshToken struct {
 	Token     string       `json:"token"`
 	CreatedAt time.Time    `json:"created_at"`
@@ -28,11 +41,56 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime `json:"revoked_at"`
 }
 
+type Subscription struct {
+	ID                uuid.UUID    `json:"id"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	UserID            uuid.UUID    `json:"user_id"`
+	Plan              string       `json:"plan"`
+	Status            string       `json:"status"`
+	CurrentPeriodEnd  time.Time    `json:"current_period_end"`
+	CancelAtPeriodEnd bool         `json:"cancel_at_period_end"`
+	CanceledAt        sql.NullTime `json:"canceled_at"`
+}
+
 type User struct {
 	ID             uuid.UUID `json:"id"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID      `json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	SubscriptionID uuid.UUID      `json:"subscription_id"`
+	EventID        uuid.UUID      `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Payload        string         `json:"payload"`
+	Status         string         `json:"status"`
+	Attempts       int32          `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime   `json:"last_attempt_at"`
+	LastStatusCode sql.NullInt32  `json:"last_status_code"`
+	LastError      sql.NullString `json:"last_error"`
+}
+
+type WebhookEvent struct {
+	ID          string       `json:"id"`
+	EventType   string       `json:"event_type"`
+	Payload     string       `json:"payload"`
+	ReceivedAt  time.Time    `json:"received_at"`
+	ProcessedAt sql.NullTime `json:"processed_at"`
+}
+
+type WebhookSubscription struct {
+	ID         uuid.UUID     `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	UserID     uuid.NullUUID `json:"user_id"`
+	Url        string        `json:"url"`
+	EventTypes string        `json:"event_types"`
+	Secret     string        `json:"secret"`
 }
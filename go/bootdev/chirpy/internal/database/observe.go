@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// QueryObserver is told how long each query took, named after its sqlc
+// "-- name:" comment, e.g. to export query durations as metrics.
+type QueryObserver func(query string, elapsed time.Duration)
+
+// ObserveDBTX wraps db so that observe sees every query run through it. A nil
+// observe returns db unchanged.
+func ObserveDBTX(db DBTX, observe QueryObserver) DBTX {
+	if observe == nil {
+		return db
+	}
+	return observedDBTX{DBTX: db, observe: observe}
+}
+
+type observedDBTX struct {
+	DBTX
+	observe QueryObserver
+}
+
+func (o observedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer o.time(query, time.Now())
+	return o.DBTX.ExecContext(ctx, query, args...)
+}
+
+// QueryContext only times until the first row is ready, not the caller's scanning.
+func (o observedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer o.time(query, time.Now())
+	return o.DBTX.QueryContext(ctx, query, args...)
+}
+
+func (o observedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer o.time(query, time.Now())
+	return o.DBTX.QueryRowContext(ctx, query, args...)
+}
+
+func (o observedDBTX) time(query string, start time.Time) {
+	o.observe(QueryName(query), time.Since(start))
+}
+
+// QueryName is the name sqlc gave query, or "unnamed" for hand written SQL.
+func QueryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "unnamed"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
@@ -0,0 +1,23 @@
+package database
+
+import "testing"
+
+func TestQueryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "sqlc query", query: getRefreshToken, want: "GetRefreshToken"},
+		{name: "sqlc exec", query: revokeRefreshToken, want: "RevokeRefreshToken"},
+		{name: "Hand written", query: "SELECT 1", want: "unnamed"},
+		{name: "Empty", query: "", want: "unnamed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QueryName(tt.query); got != tt.want {
+				t.Errorf("QueryName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
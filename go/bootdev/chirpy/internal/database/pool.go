@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// PoolConfig is the connection pool limits, see the sql.DB setters.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Configure applies the pool limits to db.
+func (p PoolConfig) Configure(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+}
+
+// Pinger is what Ping needs from a *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// MaxPingBackoff caps the wait between Ping attempts.
+const MaxPingBackoff = 8 * time.Second
+
+// Ping pings db up to attempts times, doubling the wait from backoff between
+// tries, so chirpy can start alongside a database that's still booting.
+func Ping(ctx context.Context, db Pinger, attempts int, backoff time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		slog.Warn("🔌 database not reachable, retrying", "attempt", attempt, "retry_in", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, MaxPingBackoff)
+	}
+	return fmt.Errorf("database not reachable after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// flakyDB fails the first failures pings.
+type flakyDB struct {
+	failures int
+	pings    int
+}
+
+func (f *flakyDB) PingContext(ctx context.Context) error {
+	f.pings++
+	if f.pings <= f.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		attempts  int
+		wantPings int
+		wantErr   bool
+	}{
+		{name: "Up straight away", failures: 0, attempts: 3, wantPings: 1},
+		{name: "Up after retries", failures: 2, attempts: 3, wantPings: 3},
+		{name: "Never comes up", failures: 5, attempts: 3, wantPings: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &flakyDB{failures: tt.failures}
+			err := Ping(context.Background(), db, tt.attempts, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if db.pings != tt.wantPings {
+				t.Errorf("Ping() pinged %d times, want %d", db.pings, tt.wantPings)
+			}
+		})
+	}
+}
+
+func TestPingStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Ping(ctx, &flakyDB{failures: 5}, 3, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Ping() error = %v, want context.Canceled", err)
+	}
+}
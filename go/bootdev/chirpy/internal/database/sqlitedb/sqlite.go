@@ -0,0 +1,50 @@
+// Package sqlitedb is the SQLite backend: sqlc code generated from
+// sql/sqlite, kept in parity with the Postgres queries, and a Store adapting it
+// to database.Store so the rest of chirpy can't tell the two apart. The schema
+// and queries call NOW() and gen_random_uuid(), which only exist on connections
+// made by this package, so apply sql/sqlite/migrations through Open too.
+package sqlitedb
+
+import (
+	"chirpy/internal/database"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+)
+
+// timeFormat is how the driver writes time.Time with _time_format=sqlite.
+// NOW() formats the same way, always in UTC, so timestamps compare as text.
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// the queries and schema defaults call the Postgres functions, give every
+// connection our own versions of them, plus has_hashtag for the regular
+// expression ListChirps uses on Postgres
+func init() {
+	sqlite.MustRegisterScalarFunction("gen_random_uuid", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	sqlite.MustRegisterScalarFunction("now", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UTC().Format(timeFormat), nil
+	})
+	sqlite.MustRegisterDeterministicScalarFunction("has_hashtag", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		body, _ := args[0].(string)
+		tag, _ := args[1].(string)
+		return database.HasHashtag(body, tag), nil
+	})
+}
+
+// Open opens the SQLite database at path, ":memory:" for a throwaway one, with
+// foreign keys enforced. SQLite has a single writer so the pool is capped at
+// one connection, which also keeps a :memory: database alive between queries.
+func Open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
@@ -0,0 +1,321 @@
+package sqlitedb
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// Store is a database.Store backed by SQLite. The generated models have the
+// same fields as the Postgres ones so rows convert directly, params are copied
+// by hand where the ? order or types differ and times are stored in UTC.
+type Store struct {
+	q       *Queries
+	db      *sql.DB // nil once inside a transaction
+	observe database.QueryObserver
+}
+
+var _ database.Store = (*Store)(nil)
+
+// NewStore returns a Store backed by db, see Open. observe, if not nil, sees
+// every query including those run in transactions, and queries are traced.
+func NewStore(db *sql.DB, observe database.QueryObserver) *Store {
+	s := &Store{db: db, observe: observe}
+	s.q = New(s.instrument(db))
+	return s
+}
+
+func (s *Store) instrument(db DBTX) DBTX {
+	return database.TraceDBTX(database.ObserveDBTX(db, s.observe), "sqlite")
+}
+
+func (s *Store) InTx(ctx context.Context, fn func(database.Store) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback after a successful Commit is a no-op
+	defer tx.Rollback()
+	err = fn(&Store{q: New(s.instrument(tx)), observe: s.observe})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// convertAll converts every row, keeping sqlc's nil for no rows.
+func convertAll[T, U any](rows []T, conv func(T) U) []U {
+	if rows == nil {
+		return nil
+	}
+	out := make([]U, len(rows))
+	for i, r := range rows {
+		out[i] = conv(r)
+	}
+	return out
+}
+
+func toChirp(c Chirp) database.Chirp { return database.Chirp(c) }
+
+func toOutboxEvent(e OutboxEvent) database.OutboxEvent { return database.OutboxEvent(e) }
+
+func toWebhookSubscription(s WebhookSubscription) database.WebhookSubscription {
+	return database.WebhookSubscription(s)
+}
+
+func toWebhookDelivery(d WebhookDelivery) database.WebhookDelivery {
+	return database.WebhookDelivery(d)
+}
+
+func toDueWebhookDelivery(r ClaimDueWebhookDeliveriesRow) database.ClaimDueWebhookDeliveriesRow {
+	return database.ClaimDueWebhookDeliveriesRow(r)
+}
+
+// -- chirps
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	c, err := s.q.CreateChirp(ctx, CreateChirpParams(arg))
+	return database.Chirp(c), err
+}
+
+func (s *Store) DeleteAllChirps(ctx context.Context) error {
+	return s.q.DeleteAllChirps(ctx)
+}
+
+func (s *Store) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteChirp(ctx, id)
+}
+
+func (s *Store) GetAllChirps(ctx context.Context) ([]database.Chirp, error) {
+	chirps, err := s.q.GetAllChirps(ctx)
+	return convertAll(chirps, toChirp), err
+}
+
+func (s *Store) GetAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	chirps, err := s.q.GetAllChirpsByAuthor(ctx, userID)
+	return convertAll(chirps, toChirp), err
+}
+
+func (s *Store) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	c, err := s.q.GetChirp(ctx, id)
+	return database.Chirp(c), err
+}
+
+func (s *Store) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	c, err := s.q.GetChirpForUpdate(ctx, id)
+	return database.Chirp(c), err
+}
+
+func (s *Store) ListChirps(ctx context.Context, arg database.ListChirpsParams) ([]database.Chirp, error) {
+	arg.Since.Time = arg.Since.Time.UTC()
+	arg.Until.Time = arg.Until.Time.UTC()
+	chirps, err := s.q.ListChirps(ctx, ListChirpsParams(arg))
+	return convertAll(chirps, toChirp), err
+}
+
+// -- outbox
+
+func (s *Store) CreateOutboxEvent(ctx context.Context, arg database.CreateOutboxEventParams) error {
+	return s.q.CreateOutboxEvent(ctx, CreateOutboxEventParams(arg))
+}
+
+func (s *Store) ListDueOutboxEvents(ctx context.Context, limit int32) ([]database.OutboxEvent, error) {
+	evts, err := s.q.ListDueOutboxEvents(ctx, int64(limit))
+	return convertAll(evts, toOutboxEvent), err
+}
+
+func (s *Store) MarkOutboxEventDispatched(ctx context.Context, id uuid.UUID) error {
+	return s.q.MarkOutboxEventDispatched(ctx, id)
+}
+
+func (s *Store) MarkOutboxEventFailed(ctx context.Context, arg database.MarkOutboxEventFailedParams) error {
+	arg.NextAttemptAt = arg.NextAttemptAt.UTC()
+	return s.q.MarkOutboxEventFailed(ctx, MarkOutboxEventFailedParams(arg))
+}
+
+// -- subscriptions
+
+func (s *Store) CancelSubscriptionAtPeriodEnd(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.q.CancelSubscriptionAtPeriodEnd(ctx, userID)
+	return database.Subscription(sub), err
+}
+
+func (s *Store) EndSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.q.EndSubscription(ctx, userID)
+	return database.Subscription(sub), err
+}
+
+func (s *Store) ExpireLapsedSubscriptions(ctx context.Context) (int64, error) {
+	return s.q.ExpireLapsedSubscriptions(ctx)
+}
+
+func (s *Store) GetSubscriptionByUserID(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.q.GetSubscriptionByUserID(ctx, userID)
+	return database.Subscription(sub), err
+}
+
+func (s *Store) UpsertSubscription(ctx context.Context, arg database.UpsertSubscriptionParams) (database.Subscription, error) {
+	sub, err := s.q.UpsertSubscription(ctx, UpsertSubscriptionParams{
+		UserID:           arg.UserID,
+		Plan:             arg.Plan,
+		CurrentPeriodEnd: arg.CurrentPeriodEnd.UTC(),
+	})
+	return database.Subscription(sub), err
+}
+
+// -- refresh tokens
+
+func (s *Store) CountActiveRefreshTokens(ctx context.Context) (int64, error) {
+	return s.q.CountActiveRefreshTokens(ctx)
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (string, error) {
+	return s.q.CreateRefreshToken(ctx, CreateRefreshTokenParams{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	})
+}
+
+func (s *Store) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	t, err := s.q.GetRefreshToken(ctx, token)
+	return database.RefreshToken(t), err
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+	return s.q.RevokeRefreshToken(ctx, token)
+}
+
+// -- users
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	u, err := s.q.CreateUser(ctx, CreateUserParams(arg))
+	return database.User(u), err
+}
+
+func (s *Store) DeleteAllUsers(ctx context.Context) error {
+	return s.q.DeleteAllUsers(ctx)
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteUser(ctx, id)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	u, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(u), err
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.GetUserByID(ctx, id)
+	return database.User(u), err
+}
+
+func (s *Store) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.GetUserByIDForUpdate(ctx, id)
+	return database.User(u), err
+}
+
+func (s *Store) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	u, err := s.q.UpdateUser(ctx, UpdateUserParams{
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		ID:             arg.ID,
+	})
+	return database.User(u), err
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	return s.q.UpdateUserPassword(ctx, UpdateUserPasswordParams{
+		HashedPassword: arg.HashedPassword,
+		ID:             arg.ID,
+	})
+}
+
+// -- outbound webhooks
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error {
+	return s.q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams(arg))
+}
+
+func (s *Store) CreateWebhookSubscription(ctx context.Context, arg database.CreateWebhookSubscriptionParams) (database.WebhookSubscription, error) {
+	sub, err := s.q.CreateWebhookSubscription(ctx, CreateWebhookSubscriptionParams(arg))
+	return database.WebhookSubscription(sub), err
+}
+
+func (s *Store) DeleteWebhookSubscription(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteWebhookSubscription(ctx, id)
+}
+
+func (s *Store) GetWebhookSubscription(ctx context.Context, id uuid.UUID) (database.WebhookSubscription, error) {
+	sub, err := s.q.GetWebhookSubscription(ctx, id)
+	return database.WebhookSubscription(sub), err
+}
+
+func (s *Store) ClaimDueWebhookDeliveries(ctx context.Context, arg database.ClaimDueWebhookDeliveriesParams) ([]database.ClaimDueWebhookDeliveriesRow, error) {
+	rows, err := s.q.ClaimDueWebhookDeliveries(ctx, ClaimDueWebhookDeliveriesParams{
+		LeaseUntil: arg.LeaseUntil.UTC(),
+		BatchSize:  int64(arg.BatchSize),
+	})
+	return convertAll(rows, toDueWebhookDelivery), err
+}
+
+func (s *Store) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	deliveries, err := s.q.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{
+		SubscriptionID: arg.SubscriptionID,
+		Limit:          int64(arg.Limit),
+	})
+	return convertAll(deliveries, toWebhookDelivery), err
+}
+
+func (s *Store) ListWebhookSubscriptionsByUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookSubscription, error) {
+	subs, err := s.q.ListWebhookSubscriptionsByUser(ctx, userID)
+	return convertAll(subs, toWebhookSubscription), err
+}
+
+func (s *Store) ListWebhookSubscriptionsForEvent(ctx context.Context, arg database.ListWebhookSubscriptionsForEventParams) ([]database.WebhookSubscription, error) {
+	subs, err := s.q.ListWebhookSubscriptionsForEvent(ctx, ListWebhookSubscriptionsForEventParams(arg))
+	return convertAll(subs, toWebhookSubscription), err
+}
+
+func (s *Store) MarkWebhookDeliveryFailed(ctx context.Context, arg database.MarkWebhookDeliveryFailedParams) error {
+	return s.q.MarkWebhookDeliveryFailed(ctx, MarkWebhookDeliveryFailedParams{
+		Status:         arg.Status,
+		NextAttemptAt:  arg.NextAttemptAt.UTC(),
+		LastStatusCode: arg.LastStatusCode,
+		LastError:      arg.LastError,
+		ID:             arg.ID,
+	})
+}
+
+func (s *Store) MarkWebhookDeliverySucceeded(ctx context.Context, arg database.MarkWebhookDeliverySucceededParams) error {
+	return s.q.MarkWebhookDeliverySucceeded(ctx, MarkWebhookDeliverySucceededParams{
+		LastStatusCode: arg.LastStatusCode,
+		ID:             arg.ID,
+	})
+}
+
+// -- polka webhook events
+
+func (s *Store) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	evt, err := s.q.CreateWebhookEvent(ctx, CreateWebhookEventParams(arg))
+	return database.WebhookEvent(evt), err
+}
+
+func (s *Store) GetWebhookEvent(ctx context.Context, id string) (database.WebhookEvent, error) {
+	evt, err := s.q.GetWebhookEvent(ctx, id)
+	return database.WebhookEvent(evt), err
+}
+
+func (s *Store) ClaimWebhookEvent(ctx context.Context, id string) (string, error) {
+	return s.q.ClaimWebhookEvent(ctx, id)
+}
+
+func (s *Store) MarkWebhookEventProcessed(ctx context.Context, id string) error {
+	return s.q.MarkWebhookEventProcessed(ctx, id)
+}
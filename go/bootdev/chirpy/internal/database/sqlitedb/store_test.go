@@ -0,0 +1,98 @@
+package sqlitedb
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/database/storetest"
+	"chirpy/internal/migrate"
+	"chirpy/internal/tracing"
+	"chirpy/sql/sqlite/migrations"
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// migratedDB is an in-memory database with every migration applied.
+func migratedDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrate.SQLite, migrations.FS)
+	if err != nil {
+		t.Fatalf("migrate.New() error = %v", err)
+	}
+	_, err = m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return NewStore(migratedDB(t), nil)
+	})
+}
+
+func TestStoreObservesQueries(t *testing.T) {
+	var queries []string
+	s := NewStore(migratedDB(t), func(query string, elapsed time.Duration) {
+		queries = append(queries, query)
+	})
+	ctx := context.Background()
+	_, err := s.CountActiveRefreshTokens(ctx)
+	if err != nil {
+		t.Fatalf("CountActiveRefreshTokens() error = %v", err)
+	}
+	err = s.InTx(ctx, func(tx database.Store) error {
+		_, err := tx.GetAllChirps(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+	want := []string{"CountActiveRefreshTokens", "GetAllChirps"}
+	if !slices.Equal(queries, want) {
+		t.Errorf("observed %v, want %v", queries, want)
+	}
+}
+
+func TestStoreTracesQueries(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	s := NewStore(migratedDB(t), nil)
+
+	// outside a trace, e.g. a worker polling, no span
+	_, err := s.GetAllChirps(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllChirps() error = %v", err)
+	}
+	ctx, parent := tracing.Tracer().Start(context.Background(), "request")
+	err = s.InTx(ctx, func(tx database.Store) error {
+		_, err := tx.CountActiveRefreshTokens(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the query and its parent", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "CountActiveRefreshTokens" || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("query span %q with parent %v, want CountActiveRefreshTokens under the request", query.Name(), query.Parent().SpanID())
+	}
+}
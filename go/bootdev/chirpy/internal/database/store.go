@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Store is the storage chirpy runs on, every sqlc query plus transactions.
+// SQLStore is the Postgres implementation, memstore.Store the in-memory one.
+type Store interface {
+	Querier
+	// InTx runs fn in a transaction, committing if it returns nil and rolling
+	// back otherwise. Calling InTx on the Store passed to fn joins the outer
+	// transaction.
+	InTx(ctx context.Context, fn func(Store) error) error
+}
+
+// SQLStore is the sqlc generated Queries plus the *sql.DB to begin transactions on.
+type SQLStore struct {
+	*Queries
+	db      *sql.DB // nil once inside a transaction
+	observe QueryObserver
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore returns a Store backed by db. observe, if not nil, sees every
+// query including those run in transactions, and queries are traced.
+func NewSQLStore(db *sql.DB, observe QueryObserver) *SQLStore {
+	s := &SQLStore{db: db, observe: observe}
+	s.Queries = New(s.instrument(db))
+	return s
+}
+
+func (s *SQLStore) instrument(db DBTX) DBTX {
+	return TraceDBTX(ObserveDBTX(db, s.observe), "postgresql")
+}
+
+func (s *SQLStore) InTx(ctx context.Context, fn func(Store) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback after a successful Commit is a no-op
+	defer tx.Rollback()
+	err = fn(&SQLStore{Queries: New(s.instrument(tx)), observe: s.observe})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,67 @@
+package database_test
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/database/storetest"
+	"chirpy/internal/migrate"
+	"chirpy/sql/migrations"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// TestSQLStore runs the conformance suite against Postgres when
+// CHIRPY_TEST_DATABASE_URL is set, inside a throwaway schema.
+func TestSQLStore(t *testing.T) {
+	dbURL := os.Getenv("CHIRPY_TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("CHIRPY_TEST_DATABASE_URL not set")
+	}
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("chirpy_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// unknown URL params are passed to Postgres as run-time settings
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("parsing CHIRPY_TEST_DATABASE_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := migrate.New(db, migrate.Postgres, migrations.FS)
+	if err != nil {
+		t.Fatalf("migrate.New() error = %v", err)
+	}
+	_, err = m.Up(context.Background())
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	storetest.Run(t, func(t *testing.T) database.Store {
+		_, err := db.Exec("TRUNCATE users, webhook_events, webhook_subscriptions, outbox_events CASCADE")
+		if err != nil {
+			t.Fatalf("truncating tables: %v", err)
+		}
+		return database.NewSQLStore(db, nil)
+	})
+}
@@ -0,0 +1,680 @@
+// Package storetest is the conformance suite every database.Store has to pass,
+// so the Postgres, SQLite and in-memory backends behave the same to the services.
+package storetest
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Run runs the suite, newStore must return an empty store for every subtest.
+func Run(t *testing.T, newStore func(t *testing.T) database.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s database.Store)
+	}{
+		{"Users", testUsers},
+		{"Chirps", testChirps},
+		{"ListChirps", testListChirps},
+		{"DeleteUserCascades", testDeleteUserCascades},
+		{"RefreshTokens", testRefreshTokens},
+		{"Subscriptions", testSubscriptions},
+		{"WebhookEvents", testWebhookEvents},
+		{"Outbox", testOutbox},
+		{"WebhookSubscriptions", testWebhookSubscriptions},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"InTx", testInTx},
+		{"ForUpdate", testForUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func mustCreateUser(t *testing.T, s database.Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser(%q) error = %v", email, err)
+	}
+	return user
+}
+
+func mustCreateChirp(t *testing.T, s database.Store, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	chirp, err := s.CreateChirp(context.Background(), database.CreateChirpParams{Body: body, UserID: userID})
+	if err != nil {
+		t.Fatalf("CreateChirp(%q) error = %v", body, err)
+	}
+	return chirp
+}
+
+func bodies(chirps []database.Chirp) string {
+	got := []string{}
+	for _, c := range chirps {
+		got = append(got, c.Body)
+	}
+	return strings.Join(got, ",")
+}
+
+func testUsers(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	if user.ID == uuid.Nil || user.CreatedAt.IsZero() || user.Email != "a@example.com" {
+		t.Errorf("CreateUser() = %+v, want an ID, created_at and the email", user)
+	}
+
+	got, err := s.GetUserByEmail(ctx, "a@example.com")
+	if err != nil || got.ID != user.ID {
+		t.Errorf("GetUserByEmail() = %v, %v, want %v", got.ID, err, user.ID)
+	}
+	_, err = s.GetUserByEmail(ctx, "nobody@example.com")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByEmail() for unknown email error = %v, want sql.ErrNoRows", err)
+	}
+	_, err = s.GetUserByID(ctx, uuid.New())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByID() for unknown ID error = %v, want sql.ErrNoRows", err)
+	}
+
+	updated, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: "b@example.com", HashedPassword: "new hash"})
+	if err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if updated.Email != "b@example.com" || updated.HashedPassword != "new hash" || updated.UpdatedAt.Before(user.UpdatedAt) {
+		t.Errorf("UpdateUser() = %+v, want new email and hash", updated)
+	}
+	err = s.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.ID, HashedPassword: "rehashed"})
+	if err != nil {
+		t.Fatalf("UpdateUserPassword() error = %v", err)
+	}
+	got, err = s.GetUserByID(ctx, user.ID)
+	if err != nil || got.HashedPassword != "rehashed" {
+		t.Errorf("after UpdateUserPassword() hash = %q, %v, want %q", got.HashedPassword, err, "rehashed")
+	}
+}
+
+func testChirps(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	a1 := mustCreateChirp(t, s, alice.ID, "a1")
+	mustCreateChirp(t, s, bob.ID, "b1")
+	mustCreateChirp(t, s, alice.ID, "a2")
+
+	_, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New()})
+	if err == nil {
+		t.Errorf("CreateChirp() for unknown user succeeded, want a foreign key error")
+	}
+
+	all, err := s.GetAllChirps(ctx)
+	if err != nil || bodies(all) != "a1,b1,a2" {
+		t.Errorf("GetAllChirps() = %v, %v, want a1,b1,a2", bodies(all), err)
+	}
+	byAuthor, err := s.GetAllChirpsByAuthor(ctx, alice.ID)
+	if err != nil || bodies(byAuthor) != "a1,a2" {
+		t.Errorf("GetAllChirpsByAuthor() = %v, %v, want a1,a2", bodies(byAuthor), err)
+	}
+
+	got, err := s.GetChirp(ctx, a1.ID)
+	if err != nil || got.Body != "a1" || got.UserID != alice.ID || !got.CreatedAt.Equal(a1.CreatedAt) {
+		t.Errorf("GetChirp() = %+v, %v, want %+v", got, err, a1)
+	}
+	err = s.DeleteChirp(ctx, a1.ID)
+	if err != nil {
+		t.Fatalf("DeleteChirp() error = %v", err)
+	}
+	_, err = s.GetChirp(ctx, a1.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() after delete error = %v, want sql.ErrNoRows", err)
+	}
+
+	err = s.DeleteAllChirps(ctx)
+	if err != nil {
+		t.Fatalf("DeleteAllChirps() error = %v", err)
+	}
+	all, err = s.GetAllChirps(ctx)
+	if err != nil || len(all) != 0 {
+		t.Errorf("GetAllChirps() after DeleteAllChirps() = %v, %v, want none", bodies(all), err)
+	}
+}
+
+func testListChirps(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	a1 := mustCreateChirp(t, s, alice.ID, "learning #Go")
+	b1 := mustCreateChirp(t, s, bob.ID, "#golang is not #go.")
+	a2 := mustCreateChirp(t, s, alice.ID, "Hello World")
+
+	tests := []struct {
+		name string
+		arg  database.ListChirpsParams
+		want string
+	}{
+		{name: "No filters", want: "learning #Go,#golang is not #go.,Hello World"},
+		{name: "Newest first", arg: database.ListChirpsParams{NewestFirst: true}, want: "Hello World,#golang is not #go.,learning #Go"},
+		{name: "Author", arg: database.ListChirpsParams{AuthorID: uuid.NullUUID{UUID: alice.ID, Valid: true}}, want: "learning #Go,Hello World"},
+		{name: "Since is inclusive", arg: database.ListChirpsParams{Since: sql.NullTime{Time: b1.CreatedAt, Valid: true}}, want: "#golang is not #go.,Hello World"},
+		{name: "Until is exclusive", arg: database.ListChirpsParams{Until: sql.NullTime{Time: b1.CreatedAt, Valid: true}}, want: "learning #Go"},
+		{name: "Hashtag is a whole word and ignores case", arg: database.ListChirpsParams{Hashtag: sql.NullString{String: "GO", Valid: true}}, want: "learning #Go,#golang is not #go."},
+		{name: "Search ignores case", arg: database.ListChirpsParams{Search: sql.NullString{String: "world", Valid: true}}, want: "Hello World"},
+		{
+			name: "Filters combine",
+			arg: database.ListChirpsParams{
+				AuthorID:    uuid.NullUUID{UUID: alice.ID, Valid: true},
+				Since:       sql.NullTime{Time: a1.CreatedAt, Valid: true},
+				Until:       sql.NullTime{Time: a2.CreatedAt.Add(time.Second), Valid: true},
+				Search:      sql.NullString{String: "l", Valid: true},
+				NewestFirst: true,
+			},
+			want: "Hello World,learning #Go",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ListChirps(ctx, tt.arg)
+			if err != nil || bodies(got) != tt.want {
+				t.Errorf("ListChirps() = %v, %v, want %v", bodies(got), err, tt.want)
+			}
+		})
+	}
+}
+
+func testDeleteUserCascades(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	chirp := mustCreateChirp(t, s, user.ID, "bye")
+	_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	_, err = s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: user.ID, Plan: "chirpy_red", CurrentPeriodEnd: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("UpsertSubscription() error = %v", err)
+	}
+	hook, err := s.CreateWebhookSubscription(ctx, database.CreateWebhookSubscriptionParams{
+		UserID:     uuid.NullUUID{UUID: user.ID, Valid: true},
+		Url:        "https://example.com/hook",
+		EventTypes: "chirp.created",
+		Secret:     "secret",
+	})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription() error = %v", err)
+	}
+
+	err = s.DeleteUser(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("DeleteUser() error = %v", err)
+	}
+	_, err = s.GetChirp(ctx, chirp.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() error = %v, want sql.ErrNoRows", err)
+	}
+	_, err = s.GetRefreshToken(ctx, "tok")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetRefreshToken() error = %v, want sql.ErrNoRows", err)
+	}
+	_, err = s.GetSubscriptionByUserID(ctx, user.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetSubscriptionByUserID() error = %v, want sql.ErrNoRows", err)
+	}
+	_, err = s.GetWebhookSubscription(ctx, hook.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetWebhookSubscription() error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	// Postgres keeps microseconds
+	expires := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	token, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: user.ID, ExpiresAt: expires})
+	if err != nil || token != "tok" {
+		t.Fatalf("CreateRefreshToken() = %q, %v, want %q", token, err, "tok")
+	}
+	_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: user.ID, ExpiresAt: expires})
+	if err == nil {
+		t.Errorf("CreateRefreshToken() with a duplicate token succeeded, want a unique violation")
+	}
+
+	got, err := s.GetRefreshToken(ctx, "tok")
+	if err != nil {
+		t.Fatalf("GetRefreshToken() error = %v", err)
+	}
+	if got.UserID != user.ID || !got.ExpiresAt.Equal(expires) || got.RevokedAt.Valid {
+		t.Errorf("GetRefreshToken() = %+v, want user %v, expiry %v and not revoked", got, user.ID, expires)
+	}
+	_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "expired", UserID: user.ID, ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	// only "tok" counts, "expired" is past its expiry
+	n, err := s.CountActiveRefreshTokens(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("CountActiveRefreshTokens() = %d, %v, want 1", n, err)
+	}
+	err = s.RevokeRefreshToken(ctx, "tok")
+	if err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+	got, err = s.GetRefreshToken(ctx, "tok")
+	if err != nil || !got.RevokedAt.Valid {
+		t.Errorf("after RevokeRefreshToken() revoked_at = %v, %v, want set", got.RevokedAt, err)
+	}
+	n, err = s.CountActiveRefreshTokens(ctx)
+	if err != nil || n != 0 {
+		t.Errorf("after RevokeRefreshToken() CountActiveRefreshTokens() = %d, %v, want 0", n, err)
+	}
+}
+
+func testSubscriptions(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	lapsed := mustCreateUser(t, s, "lapsed@example.com")
+
+	_, err := s.GetSubscriptionByUserID(ctx, user.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetSubscriptionByUserID() before upsert error = %v, want sql.ErrNoRows", err)
+	}
+	periodEnd := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Microsecond)
+	sub, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: user.ID, Plan: "chirpy_red", CurrentPeriodEnd: periodEnd})
+	if err != nil {
+		t.Fatalf("UpsertSubscription() error = %v", err)
+	}
+	if sub.Status != "active" || sub.CancelAtPeriodEnd || !sub.CurrentPeriodEnd.Equal(periodEnd) {
+		t.Errorf("UpsertSubscription() = %+v, want active until %v", sub, periodEnd)
+	}
+
+	canceled, err := s.CancelSubscriptionAtPeriodEnd(ctx, user.ID)
+	if err != nil || !canceled.CancelAtPeriodEnd || !canceled.CanceledAt.Valid || canceled.Status != "active" {
+		t.Errorf("CancelSubscriptionAtPeriodEnd() = %+v, %v, want active and canceling", canceled, err)
+	}
+	renewed, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: user.ID, Plan: "chirpy_red", CurrentPeriodEnd: periodEnd.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("UpsertSubscription() renewal error = %v", err)
+	}
+	if renewed.ID != sub.ID || !renewed.CancelAtPeriodEnd || !renewed.CanceledAt.Time.Equal(canceled.CanceledAt.Time) {
+		t.Errorf("UpsertSubscription() renewal = %+v, want the same row, still canceling", renewed)
+	}
+
+	ended, err := s.EndSubscription(ctx, user.ID)
+	if err != nil || ended.Status != "canceled" || !ended.CanceledAt.Valid {
+		t.Errorf("EndSubscription() = %+v, %v, want canceled", ended, err)
+	}
+	_, err = s.CancelSubscriptionAtPeriodEnd(ctx, user.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CancelSubscriptionAtPeriodEnd() of an ended subscription error = %v, want sql.ErrNoRows", err)
+	}
+	resubscribed, err := s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: user.ID, Plan: "chirpy_red", CurrentPeriodEnd: periodEnd})
+	if err != nil || resubscribed.Status != "active" || resubscribed.CancelAtPeriodEnd || resubscribed.CanceledAt.Valid {
+		t.Errorf("UpsertSubscription() after it ended = %+v, %v, want active and not canceling", resubscribed, err)
+	}
+
+	_, err = s.UpsertSubscription(ctx, database.UpsertSubscriptionParams{UserID: lapsed.ID, Plan: "chirpy_red", CurrentPeriodEnd: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("UpsertSubscription() error = %v", err)
+	}
+	n, err := s.ExpireLapsedSubscriptions(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("ExpireLapsedSubscriptions() = %d, %v, want 1", n, err)
+	}
+	got, err := s.GetSubscriptionByUserID(ctx, lapsed.ID)
+	if err != nil || got.Status != "expired" {
+		t.Errorf("lapsed subscription status = %q, %v, want expired", got.Status, err)
+	}
+}
+
+func testWebhookEvents(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	evt, err := s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "evt_1", EventType: "user.upgraded", Payload: "{}"})
+	if err != nil || evt.ReceivedAt.IsZero() || evt.ProcessedAt.Valid {
+		t.Fatalf("CreateWebhookEvent() = %+v, %v, want received and unprocessed", evt, err)
+	}
+	_, err = s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "evt_1", EventType: "user.upgraded", Payload: "{}"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CreateWebhookEvent() duplicate error = %v, want sql.ErrNoRows", err)
+	}
+	err = s.MarkWebhookEventProcessed(ctx, "evt_1")
+	if err != nil {
+		t.Fatalf("MarkWebhookEventProcessed() error = %v", err)
+	}
+	got, err := s.GetWebhookEvent(ctx, "evt_1")
+	if err != nil || !got.ProcessedAt.Valid {
+		t.Errorf("GetWebhookEvent() = %+v, %v, want processed", got, err)
+	}
+
+	_, err = s.CreateWebhookEvent(ctx, database.CreateWebhookEventParams{ID: "evt_2", EventType: "subscription.renewed", Payload: "{}"})
+	if err != nil {
+		t.Fatalf("CreateWebhookEvent() error = %v", err)
+	}
+	id, err := s.ClaimWebhookEvent(ctx, "evt_2")
+	if err != nil || id != "evt_2" {
+		t.Errorf("ClaimWebhookEvent() = %q, %v, want evt_2", id, err)
+	}
+	for _, id := range []string{"evt_1", "evt_2", "evt_missing"} {
+		_, err = s.ClaimWebhookEvent(ctx, id)
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("ClaimWebhookEvent(%q) error = %v, want sql.ErrNoRows", id, err)
+		}
+	}
+}
+
+func testOutbox(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for i, id := range ids {
+		actor := uuid.NullUUID{}
+		if i == 0 {
+			actor = uuid.NullUUID{UUID: uuid.New(), Valid: true}
+		}
+		err := s.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{ID: id, EventType: "chirp.created", ActorID: actor, Payload: "{}"})
+		if err != nil {
+			t.Fatalf("CreateOutboxEvent() error = %v", err)
+		}
+	}
+	evts, err := s.ListDueOutboxEvents(ctx, 2)
+	if err != nil || len(evts) != 2 || evts[0].ID != ids[0] || evts[1].ID != ids[1] {
+		t.Fatalf("ListDueOutboxEvents(2) = %+v, %v, want the oldest two", evts, err)
+	}
+	if !evts[0].ActorID.Valid || evts[1].ActorID.Valid {
+		t.Errorf("actor IDs = %v, %v, want set then NULL", evts[0].ActorID, evts[1].ActorID)
+	}
+	err = s.MarkOutboxEventDispatched(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("MarkOutboxEventDispatched() error = %v", err)
+	}
+	evts, err = s.ListDueOutboxEvents(ctx, 10)
+	if err != nil || len(evts) != 2 || evts[0].ID != ids[1] {
+		t.Fatalf("ListDueOutboxEvents() after dispatch = %+v, %v, want the last two", evts, err)
+	}
+
+	// a failed event waits for its next attempt, a parked one for good
+	err = s.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+		ID:            ids[1],
+		NextAttemptAt: time.Now().Add(time.Hour),
+		LastError:     sql.NullString{String: "webhooks: boom", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkOutboxEventFailed() error = %v", err)
+	}
+	err = s.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+		ID:            ids[2],
+		NextAttemptAt: time.Now().Add(-time.Second),
+		LastError:     sql.NullString{String: "webhooks: boom", Valid: true},
+		Park:          true,
+	})
+	if err != nil {
+		t.Fatalf("MarkOutboxEventFailed() park error = %v", err)
+	}
+	evts, err = s.ListDueOutboxEvents(ctx, 10)
+	if err != nil || len(evts) != 0 {
+		t.Errorf("ListDueOutboxEvents() after failures = %+v, %v, want none", evts, err)
+	}
+	err = s.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{ID: ids[1], NextAttemptAt: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatalf("MarkOutboxEventFailed() error = %v", err)
+	}
+	evts, err = s.ListDueOutboxEvents(ctx, 10)
+	if err != nil || len(evts) != 1 || evts[0].ID != ids[1] || evts[0].Attempts != 2 || evts[0].LastError.Valid {
+		t.Errorf("ListDueOutboxEvents() once due again = %+v, %v, want the retried event with 2 attempts", evts, err)
+	}
+}
+
+func testWebhookSubscriptions(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	create := func(userID uuid.NullUUID, eventTypes string) database.WebhookSubscription {
+		t.Helper()
+		sub, err := s.CreateWebhookSubscription(ctx, database.CreateWebhookSubscriptionParams{
+			UserID:     userID,
+			Url:        "https://example.com/hook",
+			EventTypes: eventTypes,
+			Secret:     "secret",
+		})
+		if err != nil {
+			t.Fatalf("CreateWebhookSubscription() error = %v", err)
+		}
+		return sub
+	}
+	admin := create(uuid.NullUUID{}, "chirp.created,chirp.deleted")
+	mine := create(uuid.NullUUID{UUID: alice.ID, Valid: true}, "chirp.created")
+	create(uuid.NullUUID{UUID: bob.ID, Valid: true}, "chirp.created")
+
+	byUser, err := s.ListWebhookSubscriptionsByUser(ctx, uuid.NullUUID{UUID: alice.ID, Valid: true})
+	if err != nil || len(byUser) != 1 || byUser[0].ID != mine.ID {
+		t.Errorf("ListWebhookSubscriptionsByUser() = %+v, %v, want only alice's", byUser, err)
+	}
+
+	tests := []struct {
+		name      string
+		actor     uuid.UUID
+		eventType string
+		want      []uuid.UUID
+	}{
+		{name: "Admin and the actor's own", actor: alice.ID, eventType: "chirp.created", want: []uuid.UUID{admin.ID, mine.ID}},
+		{name: "Admin only", actor: alice.ID, eventType: "chirp.deleted", want: []uuid.UUID{admin.ID}},
+		{name: "Whole event types only", actor: alice.ID, eventType: "chirp.create", want: []uuid.UUID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := s.ListWebhookSubscriptionsForEvent(ctx, database.ListWebhookSubscriptionsForEventParams{
+				ActorID:   uuid.NullUUID{UUID: tt.actor, Valid: true},
+				EventType: tt.eventType,
+			})
+			if err != nil {
+				t.Fatalf("ListWebhookSubscriptionsForEvent() error = %v", err)
+			}
+			// the query has no ORDER BY
+			got := []uuid.UUID{}
+			for _, sub := range subs {
+				got = append(got, sub.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListWebhookSubscriptionsForEvent() = %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !slices.Contains(got, id) {
+					t.Errorf("ListWebhookSubscriptionsForEvent() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	sub, err := s.CreateWebhookSubscription(ctx, database.CreateWebhookSubscriptionParams{Url: "https://example.com/hook", EventTypes: "chirp.created", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription() error = %v", err)
+	}
+	events := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	for _, id := range events {
+		err := s.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{SubscriptionID: sub.ID, EventID: id, EventType: "chirp.created", Payload: "{}"})
+		if err != nil {
+			t.Fatalf("CreateWebhookDelivery() error = %v", err)
+		}
+	}
+	// fan-out is idempotent per event
+	err = s.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{SubscriptionID: sub.ID, EventID: events[0], EventType: "chirp.created", Payload: "{}"})
+	if err != nil {
+		t.Fatalf("CreateWebhookDelivery() duplicate error = %v", err)
+	}
+
+	deliveries, err := s.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{SubscriptionID: sub.ID, Limit: 10})
+	if err != nil || len(deliveries) != 3 || deliveries[0].EventID != events[2] {
+		t.Fatalf("ListWebhookDeliveries() = %+v, %v, want 3, newest first", deliveries, err)
+	}
+	lease := database.ClaimDueWebhookDeliveriesParams{LeaseUntil: time.Now().Add(time.Minute), BatchSize: 10}
+	due, err := s.ClaimDueWebhookDeliveries(ctx, lease)
+	if err != nil || len(due) != 3 || due[0].Url != sub.Url || due[0].Secret != sub.Secret {
+		t.Fatalf("ClaimDueWebhookDeliveries() = %+v, %v, want all 3 with the subscription's URL and secret", due, err)
+	}
+	// claimed deliveries aren't due again until the lease runs out
+	due, err = s.ClaimDueWebhookDeliveries(ctx, lease)
+	if err != nil || len(due) != 0 {
+		t.Fatalf("ClaimDueWebhookDeliveries() while leased = %+v, %v, want none", due, err)
+	}
+
+	ok, retry := deliveries[0], deliveries[1]
+	err = s.MarkWebhookDeliverySucceeded(ctx, database.MarkWebhookDeliverySucceededParams{ID: ok.ID, LastStatusCode: sql.NullInt32{Int32: 200, Valid: true}})
+	if err != nil {
+		t.Fatalf("MarkWebhookDeliverySucceeded() error = %v", err)
+	}
+	err = s.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		ID:             retry.ID,
+		Status:         "pending",
+		NextAttemptAt:  time.Now().Add(time.Hour),
+		LastStatusCode: sql.NullInt32{Int32: 500, Valid: true},
+		LastError:      sql.NullString{String: "boom", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("MarkWebhookDeliveryFailed() error = %v", err)
+	}
+	// an expired lease, the instance that claimed it died before sending
+	err = s.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		ID:            deliveries[2].ID,
+		Status:        "pending",
+		NextAttemptAt: time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatalf("MarkWebhookDeliveryFailed() error = %v", err)
+	}
+	due, err = s.ClaimDueWebhookDeliveries(ctx, lease)
+	if err != nil || len(due) != 1 || due[0].ID != deliveries[2].ID {
+		t.Errorf("ClaimDueWebhookDeliveries() = %+v, %v, want only the delivery with an expired lease", due, err)
+	}
+
+	deliveries, err = s.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{SubscriptionID: sub.ID, Limit: 2})
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("ListWebhookDeliveries(limit 2) = %+v, %v, want 2", deliveries, err)
+	}
+	if d := deliveries[0]; d.Status != "succeeded" || d.Attempts != 1 || d.LastStatusCode.Int32 != 200 || d.LastError.Valid {
+		t.Errorf("succeeded delivery = %+v", d)
+	}
+	if d := deliveries[1]; d.Status != "pending" || d.Attempts != 1 || d.LastStatusCode.Int32 != 500 || d.LastError.String != "boom" {
+		t.Errorf("failed delivery = %+v", d)
+	}
+
+	err = s.DeleteWebhookSubscription(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("DeleteWebhookSubscription() error = %v", err)
+	}
+	deliveries, err = s.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{SubscriptionID: sub.ID, Limit: 10})
+	if err != nil || len(deliveries) != 0 {
+		t.Errorf("ListWebhookDeliveries() after deleting the subscription = %+v, %v, want none", deliveries, err)
+	}
+}
+
+func testInTx(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	errBoom := errors.New("boom")
+	err := s.InTx(ctx, func(tx database.Store) error {
+		mustCreateUser(t, tx, "rolled-back@example.com")
+		// nested calls join the outer transaction
+		return tx.InTx(ctx, func(tx database.Store) error {
+			mustCreateUser(t, tx, "nested@example.com")
+			return errBoom
+		})
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("InTx() error = %v, want %v", err, errBoom)
+	}
+	for _, email := range []string{"rolled-back@example.com", "nested@example.com"} {
+		_, err = s.GetUserByEmail(ctx, email)
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetUserByEmail(%q) after rollback error = %v, want sql.ErrNoRows", email, err)
+		}
+	}
+
+	err = s.InTx(ctx, func(tx database.Store) error {
+		mustCreateUser(t, tx, "committed@example.com")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+	_, err = s.GetUserByEmail(ctx, "committed@example.com")
+	if err != nil {
+		t.Errorf("GetUserByEmail() after commit error = %v", err)
+	}
+}
+
+// testForUpdate races two writers that both check the row they lock before
+// writing, as a stale If-Match does. The lock must make the second one see the
+// first one's write, so exactly one of them succeeds.
+func testForUpdate(t *testing.T, s database.Store) {
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	chirp := mustCreateChirp(t, s, user.ID, "hello")
+	errStale := errors.New("stale")
+	race := func(write func(tx database.Store, i int) error) int {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = s.InTx(ctx, func(tx database.Store) error {
+					return write(tx, i)
+				})
+			}()
+		}
+		wg.Wait()
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+			} else if !errors.Is(err, errStale) {
+				t.Errorf("InTx() error = %v", err)
+			}
+		}
+		return succeeded
+	}
+
+	succeeded := race(func(tx database.Store, i int) error {
+		current, err := tx.GetUserByIDForUpdate(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if current.Email != user.Email {
+			return errStale
+		}
+		// give the other writer time to read the old row, if it can
+		time.Sleep(50 * time.Millisecond)
+		_, err = tx.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: fmt.Sprintf("writer%d@example.com", i), HashedPassword: "hash"})
+		return err
+	})
+	if succeeded != 1 {
+		t.Errorf("concurrent updates checked on GetUserByIDForUpdate: %d succeeded, want 1", succeeded)
+	}
+
+	succeeded = race(func(tx database.Store, i int) error {
+		_, err := tx.GetChirpForUpdate(ctx, chirp.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errStale
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+		return tx.DeleteChirp(ctx, chirp.ID)
+	})
+	if succeeded != 1 {
+		t.Errorf("concurrent deletes checked on GetChirpForUpdate: %d succeeded, want 1", succeeded)
+	}
+}
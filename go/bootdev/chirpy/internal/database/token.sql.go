@@ -12,6 +12,18 @@ import (
 	"github.com/google/uuid"
 )
 
+const countActiveRefreshTokens = `-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW()
+`
+
+func (q *Queries) CountActiveRefreshTokens(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countActiveRefreshTokens)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
     token, user_id, expires_at
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"chirpy/internal/tracing"
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceDBTX wraps db so that every query run inside a trace gets a span named
+// after the sqlc query. Queries outside a trace, the background workers
+// polling, don't start traces of their own. system is the db.system attribute,
+// e.g. "postgresql".
+func TraceDBTX(db DBTX, system string) DBTX {
+	return tracedDBTX{DBTX: db, system: system}
+}
+
+type tracedDBTX struct {
+	DBTX
+	system string
+}
+
+func (t tracedDBTX) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	res, err := t.DBTX.ExecContext(ctx, query, args...)
+	recordError(span, err)
+	return res, err
+}
+
+func (t tracedDBTX) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	rows, err := t.DBTX.QueryContext(ctx, query, args...)
+	recordError(span, err)
+	return rows, err
+}
+
+func (t tracedDBTX) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+	row := t.DBTX.QueryRowContext(ctx, query, args...)
+	// sql.ErrNoRows only comes from Scan, Err is the query failing
+	recordError(span, row.Err())
+	return row
+}
+
+func (t tracedDBTX) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	name := QueryName(query)
+	return tracing.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", t.system),
+			attribute.String("db.operation.name", name),
+			// the SQL has placeholders, never the values
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
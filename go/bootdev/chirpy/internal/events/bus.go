@@ -0,0 +1,58 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// AllEvents subscribes a handler to every event type.
+const AllEvents = "*"
+
+// Handler reacts to an event. Events are delivered at least once, so handlers
+// must tolerate seeing the same event ID again.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus is an in-process publish/subscribe dispatcher.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]namedHandler
+}
+
+type namedHandler struct {
+	name string
+	fn   Handler
+}
+
+// NewBus returns a Bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{handlers: map[string][]namedHandler{}}
+}
+
+// Subscribe registers fn for eventType, or for every event with AllEvents. The
+// name only shows up in errors and logs.
+//
+// fn must be idempotent by event ID: when any handler fails the Relay
+// publishes the whole event again, so handlers that succeeded see it twice.
+func (b *Bus) Subscribe(eventType, name string, fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], namedHandler{name: name, fn: fn})
+}
+
+// Publish calls every matching handler in subscription order. All handlers run
+// even if one fails, the returned error joins their failures.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	handlers := append(append([]namedHandler{}, b.handlers[e.Type]...), b.handlers[AllEvents]...)
+	b.mu.RUnlock()
+	var errs []error
+	for _, h := range handlers {
+		err := h.fn(ctx, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBusPublish(t *testing.T) {
+	var got []string
+	record := func(name string) Handler {
+		return func(_ context.Context, e Event) error {
+			got = append(got, name+":"+e.Type)
+			return nil
+		}
+	}
+	bus := NewBus()
+	bus.Subscribe(ChirpCreated, "chirps", record("chirps"))
+	bus.Subscribe(AllEvents, "all", record("all"))
+	bus.Subscribe(ChirpCreated, "failing", func(context.Context, Event) error {
+		return errors.New("boom")
+	})
+
+	tests := []struct {
+		name      string
+		event     Event
+		want      []string
+		wantError bool
+	}{
+		{
+			name:      "Specific and wildcard handlers run, failures are reported",
+			event:     Event{Type: ChirpCreated},
+			want:      []string{"chirps:chirp.created", "all:chirp.created"},
+			wantError: true,
+		},
+		{
+			name:      "Only wildcard handlers run for other events",
+			event:     Event{Type: UserUpgraded},
+			want:      []string{"all:user.upgraded"},
+			wantError: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			err := bus.Publish(context.Background(), tt.event)
+			if (err != nil) != tt.wantError {
+				t.Errorf("Publish() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("handlers ran = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCounterSkipsRedeliveries(t *testing.T) {
+	bus := NewBus()
+	counter := NewCounter()
+	bus.Subscribe(AllEvents, "metrics", counter.Handle)
+	failing := true
+	bus.Subscribe(ChirpCreated, "flaky", func(context.Context, Event) error {
+		if failing {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	e := Event{ID: uuid.New(), Type: ChirpCreated}
+	err := bus.Publish(context.Background(), e)
+	if err == nil {
+		t.Fatalf("Publish() error = nil, want the flaky handler's failure")
+	}
+	// the relay's retry on its next pass
+	failing = false
+	err = bus.Publish(context.Background(), e)
+	if err != nil {
+		t.Fatalf("Publish() retry error = %v", err)
+	}
+	bus.Publish(context.Background(), Event{ID: uuid.New(), Type: ChirpCreated})
+	if got := counter.Snapshot()[ChirpCreated]; got != 2 {
+		t.Errorf("counted %d chirp.created events, want 2", got)
+	}
+}
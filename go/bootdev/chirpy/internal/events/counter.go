@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// counterWindow is how many recent event IDs a Counter remembers to skip
+// redeliveries. The Relay retries a failed event on its next pass, so a
+// redelivery comes well within it.
+const counterWindow = 10000
+
+// Counter is a subscriber that counts published events by type, for the admin
+// metrics page. An event redelivered because another handler failed is only
+// counted once.
+type Counter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	seen   map[uuid.UUID]struct{}
+	// recent is the ring of seen IDs, oldest at next once it's full
+	recent []uuid.UUID
+	next   int
+}
+
+// NewCounter returns an empty Counter.
+func NewCounter() *Counter {
+	return &Counter{counts: map[string]int64{}, seen: map[uuid.UUID]struct{}{}}
+}
+
+// Handle is the Handler to subscribe.
+func (c *Counter) Handle(_ context.Context, e Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.seen[e.ID]; ok {
+		return nil
+	}
+	if len(c.recent) < counterWindow {
+		c.recent = append(c.recent, e.ID)
+	} else {
+		delete(c.seen, c.recent[c.next])
+		c.recent[c.next] = e.ID
+		c.next = (c.next + 1) % counterWindow
+	}
+	c.seen[e.ID] = struct{}{}
+	c.counts[e.Type]++
+	return nil
+}
+
+// Snapshot returns a copy of the current counts.
+func (c *Counter) Snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int64, len(c.counts))
+	for k, v := range c.counts {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+// Package events is chirpy's domain event plumbing. Services record events in
+// the outbox_events table inside the same transaction as the change they
+// describe, and the Relay publishes committed events to Bus subscribers.
+package events
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Domain event types.
+const (
+	ChirpCreated        = "chirp.created"
+	ChirpDeleted        = "chirp.deleted"
+	UserUpgraded        = "user.upgraded"
+	UserDowngraded      = "user.downgraded"
+	SubscriptionRenewed = "subscription.renewed"
+)
+
+// Event is a domain event as read back from the outbox. ActorID is the user
+// the event is about, or uuid.Nil.
+type Event struct {
+	ID         uuid.UUID
+	Type       string
+	ActorID    uuid.UUID
+	OccurredAt time.Time
+	Payload    json.RawMessage
+}
+
+// OutboxWriter is the part of the storage layer Record needs.
+type OutboxWriter interface {
+	CreateOutboxEvent(ctx context.Context, arg database.CreateOutboxEventParams) error
+}
+
+// Record writes an event to the outbox. Pass the transaction's repository so
+// the event commits or rolls back together with the change it describes.
+func Record(ctx context.Context, q OutboxWriter, eventType string, actorID uuid.UUID, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return q.CreateOutboxEvent(ctx, database.CreateOutboxEventParams{
+		ID:        uuid.New(),
+		EventType: eventType,
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		Payload:   string(payload),
+	})
+}
+
+func fromOutbox(row database.OutboxEvent) Event {
+	return Event{
+		ID:         row.ID,
+		Type:       row.EventType,
+		ActorID:    row.ActorID.UUID,
+		OccurredAt: row.CreatedAt,
+		Payload:    json.RawMessage(row.Payload),
+	}
+}
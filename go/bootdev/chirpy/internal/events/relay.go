@@ -0,0 +1,109 @@
+package events
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Relay moves committed events from the outbox onto the Bus. An event whose
+// handlers fail stays in the outbox and is published again, to every handler
+// (see Bus.Subscribe), after a backoff doubling from BaseBackoff up to
+// MaxBackoff. After MaxAttempts it's parked: it keeps its last_error and isn't
+// published again until parked_at is cleared by hand, so a broken subscriber
+// can't hold up newer events.
+type Relay struct {
+	queries     database.Store
+	bus         *Bus
+	Interval    time.Duration
+	BatchSize   int32
+	MaxAttempts int32
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Heartbeat, if set, beats after every pass that succeeds, so a worker
+	// that keeps failing turns readiness stale.
+	Heartbeat *health.Heartbeat
+}
+
+// NewRelay returns a Relay polling every second, parking events that fail 10
+// times over about half an hour.
+func NewRelay(q database.Store, bus *Bus) *Relay {
+	return &Relay{
+		queries:     q,
+		bus:         bus,
+		Interval:    time.Second,
+		BatchSize:   100,
+		MaxAttempts: 10,
+		BaseBackoff: 5 * time.Second,
+		MaxBackoff:  15 * time.Minute,
+	}
+}
+
+// Run publishes pending events every Interval until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		err := r.DispatchPending(ctx)
+		if err != nil {
+			slog.Error("outbox relay failed", "error", err)
+		} else {
+			r.Heartbeat.Beat()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchPending makes one pass over the events that are due, oldest first.
+func (r *Relay) DispatchPending(ctx context.Context) error {
+	rows, err := r.queries.ListDueOutboxEvents(ctx, r.BatchSize)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		e := fromOutbox(row)
+		err := r.bus.Publish(ctx, e)
+		if err != nil {
+			err = r.failed(ctx, row, err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = r.queries.MarkOutboxEventDispatched(ctx, e.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failed reschedules an event whose handlers failed, or parks it once it's out
+// of attempts.
+func (r *Relay) failed(ctx context.Context, row database.OutboxEvent, handlerErr error) error {
+	attempt := row.Attempts + 1
+	delay := r.BaseBackoff
+	for i := int32(1); i < attempt && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.MaxBackoff)
+	park := attempt >= r.MaxAttempts
+	if park {
+		slog.Error("📦 parking outbox event, its handlers kept failing", "event_id", row.ID, "event", row.EventType, "attempts", attempt, "error", handlerErr)
+	} else {
+		slog.Warn("event handlers failed, will retry", "event_id", row.ID, "event", row.EventType, "attempt", attempt, "retry_in", delay, "error", handlerErr)
+	}
+	return r.queries.MarkOutboxEventFailed(ctx, database.MarkOutboxEventFailedParams{
+		ID:            row.ID,
+		NextAttemptAt: time.Now().Add(delay),
+		LastError:     sql.NullString{String: handlerErr.Error(), Valid: true},
+		Park:          park,
+	})
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/database/memstore"
+	"chirpy/internal/health"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRelayFailingEventsDontBlockNewerOnes(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int32
+		// an event that's out of attempts is parked, so retrying straight away
+		// still can't starve the rest
+		retryAtOnce bool
+	}{
+		{name: "Failed events back off", maxAttempts: 10},
+		{name: "Exhausted events are parked", maxAttempts: 1, retryAtOnce: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New()
+			bus := NewBus()
+			failures := 0
+			var dispatched []uuid.UUID
+			bus.Subscribe(ChirpDeleted, "broken", func(context.Context, Event) error {
+				failures++
+				return errors.New("boom")
+			})
+			bus.Subscribe(ChirpCreated, "ok", func(_ context.Context, e Event) error {
+				dispatched = append(dispatched, e.ID)
+				return nil
+			})
+			relay := NewRelay(store, bus)
+			relay.BatchSize = 2
+			relay.MaxAttempts = tt.maxAttempts
+			if tt.retryAtOnce {
+				relay.BaseBackoff, relay.MaxBackoff = 0, 0
+			}
+			// a whole batch of events the broken subscriber fails on, then a newer one
+			for range relay.BatchSize {
+				err := Record(ctx, store, ChirpDeleted, uuid.Nil, "{}")
+				if err != nil {
+					t.Fatalf("Record() error = %v", err)
+				}
+			}
+			err := Record(ctx, store, ChirpCreated, uuid.Nil, "{}")
+			if err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+
+			for range 3 {
+				err := relay.DispatchPending(ctx)
+				if err != nil {
+					t.Fatalf("DispatchPending() error = %v", err)
+				}
+			}
+			if len(dispatched) != 1 {
+				t.Errorf("newer event dispatched %d times, want once", len(dispatched))
+			}
+			if want := int(relay.BatchSize); failures != want {
+				t.Errorf("failing events published %d times, want %d, once each", failures, want)
+			}
+		})
+	}
+}
+
+// brokenStore fails every read of the outbox, as a lost database would.
+type brokenStore struct {
+	database.Store
+}
+
+func (brokenStore) ListDueOutboxEvents(context.Context, int32) ([]database.OutboxEvent, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRelayFailingPassesDontBeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := NewRelay(brokenStore{memstore.New()}, NewBus())
+	relay.Interval = 5 * time.Millisecond
+	relay.Heartbeat = &health.Heartbeat{}
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	err := relay.Heartbeat.Check(time.Minute)(context.Background())
+	if err == nil {
+		t.Errorf("heartbeat Check() after only failed passes = nil, want readiness to go stale")
+	}
+}
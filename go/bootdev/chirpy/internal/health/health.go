@@ -0,0 +1,177 @@
+// Package health serves the liveness and readiness probes. Liveness only says
+// the process is up; readiness runs every registered Check, each under its own
+// timeout, and fails while the server is shutting down.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds each check when the Checker has none set.
+const DefaultTimeout = 2 * time.Second
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Check returns nil when the dependency it checks is healthy.
+type Check func(ctx context.Context) error
+
+// CheckResult is one check in the readiness report.
+type CheckResult struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report is the /readyz response body.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the registered checks for /readyz.
+type Checker struct {
+	Timeout time.Duration
+
+	mu           sync.Mutex
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a Checker with no checks and DefaultTimeout.
+func NewChecker() *Checker {
+	return &Checker{Timeout: DefaultTimeout, checks: map[string]Check{}}
+}
+
+// Register adds a check, replacing any with the same name.
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+// ShutDown makes readiness fail from now on, so load balancers stop sending
+// traffic while in-flight requests drain.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Run runs every check concurrently and reports them all.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := make(map[string]Check, len(c.checks))
+	for name, check := range c.checks {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+	if c.shuttingDown.Load() {
+		report.Status = StatusUnavailable
+		report.Checks["shutdown"] = CheckResult{Status: StatusUnavailable, Error: "server is shutting down"}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	// a check that ignores ctx still can't hold up the probe
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = errors.New("timed out after " + timeout.String())
+	}
+	if err != nil {
+		result.Status = StatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler always answers 200, if it can answer at all we're alive.
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": StatusOK})
+}
+
+// ReadinessHandler answers 200 when every check passes and 503 otherwise,
+// with the per-check breakdown either way.
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Heartbeat is how a background worker shows it's still looping. The zero
+// value is ready to use and Beat on a nil Heartbeat does nothing, so workers
+// don't have to care whether anyone is watching.
+type Heartbeat struct {
+	last atomic.Int64 // unix nanos
+}
+
+// Beat records that the worker just finished a pass.
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.last.Store(time.Now().UnixNano())
+}
+
+// Check fails when the last beat is older than maxAge, or there wasn't one.
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		last := h.last.Load()
+		if last == 0 {
+			return errors.New("no heartbeat yet")
+		}
+		age := time.Since(time.Unix(0, last))
+		if age > maxAge {
+			return errors.New("last heartbeat " + age.Round(time.Second).String() + " ago")
+		}
+		return nil
+	}
+}
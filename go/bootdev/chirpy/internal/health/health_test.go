@@ -0,0 +1,127 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func failing(ctx context.Context) error { return errors.New("connection refused") }
+
+// hanging ignores ctx, the checker has to time it out on its own.
+func hanging(ctx context.Context) error {
+	time.Sleep(time.Second)
+	return nil
+}
+
+func TestReadinessHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		shutDown   bool
+		wantCode   int
+		wantStatus map[string]string
+	}{
+		{
+			name:       "All healthy",
+			checks:     map[string]Check{"database": ok, "migrations": ok},
+			wantCode:   http.StatusOK,
+			wantStatus: map[string]string{"database": StatusOK, "migrations": StatusOK},
+		},
+		{
+			name:       "One failing",
+			checks:     map[string]Check{"database": failing, "migrations": ok},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: map[string]string{"database": StatusUnavailable, "migrations": StatusOK},
+		},
+		{
+			name:       "Timed out",
+			checks:     map[string]Check{"database": hanging},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: map[string]string{"database": StatusUnavailable},
+		},
+		{
+			name:       "Shutting down",
+			checks:     map[string]Check{"database": ok},
+			shutDown:   true,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: map[string]string{"database": StatusOK, "shutdown": StatusUnavailable},
+		},
+		{
+			name:       "No checks",
+			wantCode:   http.StatusOK,
+			wantStatus: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker()
+			c.Timeout = 50 * time.Millisecond
+			for name, check := range tt.checks {
+				c.Register(name, check)
+			}
+			if tt.shutDown {
+				c.ShutDown()
+			}
+			rec := httptest.NewRecorder()
+			c.ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("ReadinessHandler() code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			var report Report
+			err := json.NewDecoder(rec.Body).Decode(&report)
+			if err != nil {
+				t.Fatalf("decoding report: %v", err)
+			}
+			if len(report.Checks) != len(tt.wantStatus) {
+				t.Errorf("report has checks %v, want %v", report.Checks, tt.wantStatus)
+			}
+			for name, want := range tt.wantStatus {
+				got := report.Checks[name]
+				if got.Status != want {
+					t.Errorf("check %q = %+v, want status %q", name, got, want)
+				}
+				if want != StatusOK && got.Error == "" {
+					t.Errorf("check %q failed without an error message", name)
+				}
+			}
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	c := NewChecker()
+	c.Register("database", failing)
+	c.ShutDown()
+	rec := httptest.NewRecorder()
+	c.LivenessHandler(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("LivenessHandler() code = %d, want 200 regardless of dependencies", rec.Code)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	var hb Heartbeat
+	check := hb.Check(time.Minute)
+	if check(context.Background()) == nil {
+		t.Errorf("Check() before any beat = nil, want an error")
+	}
+	hb.Beat()
+	if err := check(context.Background()); err != nil {
+		t.Errorf("Check() after a beat error = %v", err)
+	}
+	hb.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	if check(context.Background()) == nil {
+		t.Errorf("Check() after a stale beat = nil, want an error")
+	}
+
+	var nilBeat *Heartbeat
+	// workers without a heartbeat call Beat on nil
+	nilBeat.Beat()
+}
@@ -0,0 +1,77 @@
+// Package httpx holds the small pieces chirpy's HTTP middleware share.
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Recorder remembers the status code and body size the handler wrote.
+type Recorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int64
+	wroteHeader bool
+}
+
+// NewRecorder wraps w, a handler that never calls WriteHeader sent a 200.
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.Status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the real writer.
+func (r *Recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type patternKey struct{}
+
+// Track lets middleware further out read the pattern the mux matched. The mux
+// only sets it on the request it's given, and any middleware that adds to the
+// context passes on a copy, so every middleware calling Route calls Track on
+// the way in.
+func Track(r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(patternKey{}).(*string); ok {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), patternKey{}, new(string)))
+}
+
+// Route is what to label a served request by, the ServeMux pattern that
+// matched without its method: "GET /api/chirps/{id}" becomes
+// "/api/chirps/{id}" and no pattern, a 404 from the mux, "unmatched". Unlike
+// the path it doesn't grow with every ID.
+func Route(r *http.Request) string {
+	pattern := r.Pattern
+	shared, _ := r.Context().Value(patternKey{}).(*string)
+	switch {
+	case pattern != "" && shared != nil:
+		*shared = pattern
+	case pattern == "" && shared != nil:
+		pattern = *shared
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	_, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return pattern
+	}
+	return strings.TrimSpace(path)
+}
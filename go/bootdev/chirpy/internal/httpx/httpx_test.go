@@ -0,0 +1,80 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoute(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "GET /api/chirps/{chirpID}", want: "/api/chirps/{chirpID}"},
+		{pattern: "/api/users", want: "/api/users"},
+		{pattern: "", want: "unmatched"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Pattern = tt.pattern
+		if got := Route(r); got != tt.want {
+			t.Errorf("Route() with pattern %q = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+// the outer middleware only has its own copy of the request, which the mux
+// never sees
+func TestRouteThroughContextCopies(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {})
+	var outer, inner string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		r = Track(r)
+		r = r.WithContext(context.WithValue(r.Context(), struct{}{}, "copy"))
+		mux.ServeHTTP(w, Track(r))
+		inner = Route(r)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil)
+	r = Track(r)
+	handler(httptest.NewRecorder(), r)
+	outer = Route(r)
+	if inner != "/api/chirps/{chirpID}" || outer != inner {
+		t.Errorf("Route() inner = %q, outer = %q, want both /api/chirps/{chirpID}", inner, outer)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+		wantBytes  int64
+	}{
+		{
+			name:       "Implicit 200",
+			handler:    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hello")) },
+			wantStatus: http.StatusOK,
+			wantBytes:  5,
+		},
+		{
+			name: "First WriteHeader wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusTeapot)
+			},
+			wantStatus: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := NewRecorder(httptest.NewRecorder())
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Status != tt.wantStatus || rec.Bytes != tt.wantBytes {
+				t.Errorf("recorded %d and %d bytes, want %d and %d bytes", rec.Status, rec.Bytes, tt.wantStatus, tt.wantBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package logging sets up chirpy's slog logger and the request logging
+// middleware. Every request gets an X-Request-ID and a logger tagged with it
+// and its trace ID, handlers log through FromContext so their lines can be tied
+// to the request.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"chirpy/internal/httpx"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the correlation ID in and out.
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// PIIKeys are the attribute keys whose values New redacts.
+var PIIKeys = []string{"email", "chirp", "body", "password"}
+
+// New returns a logger writing format, FormatText or FormatJSON, to w. With
+// redactPII every attribute keyed by one of PIIKeys logs as [REDACTED].
+func New(w io.Writer, format string, redactPII bool) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{}
+	if redactPII {
+		opts.ReplaceAttr = redact
+	}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, want %s or %s", format, FormatText, FormatJSON)
+	}
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if slices.Contains(PIIKeys, a.Key) {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	return a
+}
+
+// validRequestID is what we'll take from a client, anything else could be
+// used to forge log lines so it's replaced.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type ctxKey struct{}
+
+// requestInfo is what the middleware shares with the handlers.
+type requestInfo struct {
+	id     string
+	logger *slog.Logger
+	userID string
+}
+
+// Middleware propagates the client's X-Request-ID or assigns one, puts a
+// logger tagged with it in the request context and logs one line per request
+// once it's served.
+func Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		info := &requestInfo{id: id, logger: logger.With("request_id", id)}
+		// ties the logs to the trace when the tracing middleware runs first
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			info.logger = info.logger.With("trace_id", sc.TraceID().String())
+		}
+		r = httpx.Track(r.WithContext(context.WithValue(r.Context(), ctxKey{}, info)))
+		rec := httpx.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", httpx.Route(r)),
+			slog.Int("status", rec.Status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int64("bytes", rec.Bytes),
+		}
+		if info.userID != "" {
+			attrs = append(attrs, slog.String("user_id", info.userID))
+		}
+		info.logger.LogAttrs(r.Context(), level, "🌐 request", attrs...)
+	})
+}
+
+// FromContext is the request's logger, or slog.Default outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+		return info.logger
+	}
+	return slog.Default()
+}
+
+// RequestID is the request's correlation ID, "" outside a request.
+func RequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// SetUserID records who made the request for its log line.
+func SetUserID(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(ctxKey{}).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
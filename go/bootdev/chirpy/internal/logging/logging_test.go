@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		redactPII bool
+		want      string
+		wantErr   bool
+	}{
+		{name: "Text redacted", format: FormatText, redactPII: true, want: "email=[REDACTED] count=2"},
+		{name: "JSON redacted", format: FormatJSON, redactPII: true, want: `"email":"[REDACTED]","count":2`},
+		{name: "PII allowed", format: FormatText, want: "email=a@example.com count=2"},
+		{name: "Unknown format", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.format, tt.redactPII)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			logger.Info("hit", "email", "a@example.com", "count", 2)
+			if !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("logged %q, want it to contain %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantID    string // "" means a fresh one
+	}{
+		{name: "Propagates the client's ID", requestID: "abc-123", wantID: "abc-123"},
+		{name: "Assigns one", requestID: ""},
+		{name: "Replaces a forged one", requestID: "abc\nlevel=ERROR msg=pwned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, _ := New(&buf, FormatJSON, true)
+			mux := http.NewServeMux()
+			var handlerID string
+			mux.HandleFunc("POST /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+				handlerID = RequestID(r.Context())
+				SetUserID(r.Context(), "user-1")
+				FromContext(r.Context()).Info("in handler")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps/42", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			Middleware(logger, mux).ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			switch {
+			case tt.wantID != "" && id != tt.wantID:
+				t.Errorf("response %s = %q, want %q", RequestIDHeader, id, tt.wantID)
+			case tt.wantID == "" && (id == "" || id == tt.requestID):
+				t.Errorf("response %s = %q, want a freshly assigned ID", RequestIDHeader, id)
+			}
+			if handlerID != id {
+				t.Errorf("RequestID() in the handler = %q, want %q", handlerID, id)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("logged %d lines, want the handler's and the request's:\n%s", len(lines), buf.String())
+			}
+			var handlerLine, requestLine map[string]any
+			json.Unmarshal([]byte(lines[0]), &handlerLine)
+			json.Unmarshal([]byte(lines[1]), &requestLine)
+			if handlerLine["request_id"] != id {
+				t.Errorf("handler line = %v, want request_id %q", handlerLine, id)
+			}
+			want := map[string]any{
+				"request_id": id,
+				"method":     "POST",
+				"route":      "/api/chirps/{chirpID}",
+				"status":     float64(http.StatusCreated),
+				"bytes":      float64(5),
+				"user_id":    "user-1",
+			}
+			for k, v := range want {
+				if requestLine[k] != v {
+					t.Errorf("request line %s = %v, want %v", k, requestLine[k], v)
+				}
+			}
+			if _, ok := requestLine["duration_ms"]; !ok {
+				t.Errorf("request line = %v, want a duration_ms", requestLine)
+			}
+		})
+	}
+}
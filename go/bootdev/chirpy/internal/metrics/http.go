@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"chirpy/internal/httpx"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Instrument counts and times every request next serves. Both metrics must
+// have the labels method, route and status, see httpx.Route.
+func Instrument(next http.Handler, requests *Counter, duration *Histogram) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r = httpx.Track(r)
+		rec := httpx.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+		labels := []string{r.Method, httpx.Route(r), strconv.Itoa(rec.Status)}
+		requests.Inc(labels...)
+		duration.Observe(time.Since(start).Seconds(), labels...)
+	})
+}
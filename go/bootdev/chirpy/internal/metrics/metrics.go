@@ -0,0 +1,319 @@
+// Package metrics is the little of a Prometheus client chirpy needs: labelled
+// counters and histograms, plus gauges read at scrape time, served in the text
+// exposition format.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the Prometheus client's default buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// collector is one metric family.
+type collector interface {
+	write(ctx context.Context, w io.Writer)
+}
+
+// Registry holds the metrics served on /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]collector{}}
+}
+
+// register panics on a bad or duplicate name, those are programming errors
+// that show up the first time chirpy starts.
+func (r *Registry) register(name string, labels []string, c collector) {
+	if !metricName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+	for _, l := range labels {
+		if !labelName.MatchString(l) || l == "le" {
+			panic(fmt.Sprintf("metrics: invalid label name %q on %s", l, name))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.collectors[name] = c
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: newFamily(name, help, "counter", labels)}
+	r.register(name, labels, c)
+	return c
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which must
+// be sorted, and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets for %s aren't sorted", name))
+	}
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.register(name, labels, h)
+	return h
+}
+
+// NewGaugeFunc registers a gauge whose value fn reads on every scrape. If fn
+// fails the gauge is left out of that scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func(ctx context.Context) (float64, error)) {
+	r.register(name, nil, &gaugeFunc{family: newFamily(name, help, "gauge", nil), fn: fn})
+}
+
+// WriteTo writes every metric in the text exposition format, sorted by name.
+func (r *Registry) WriteTo(ctx context.Context, w io.Writer) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		r.mu.Lock()
+		c := r.collectors[name]
+		r.mu.Unlock()
+		c.write(ctx, w)
+	}
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var b bytes.Buffer
+	r.WriteTo(req.Context(), &b)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b.Bytes())
+}
+
+// family is what every metric type shares, its name and label names.
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func newFamily(name, help, typ string, labels []string) family {
+	return family{name: name, help: help, typ: typ, labels: labels}
+}
+
+// key checks the label values and joins them into a map key.
+func (f family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants labels %v, got values %v", f.name, f.labels, values))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.typ)
+}
+
+// labelPairs renders {a="x",b="y"}, with extra appended e.g. le for buckets.
+func (f family) labelPairs(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, v := range values {
+		pairs = append(pairs, f.labels[i]+`="`+escapeLabel(v)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter only goes up, per combination of label values.
+type Counter struct {
+	family
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	n      float64
+}
+
+// Inc adds one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which can't be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: %s can't go down", c.name))
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.series == nil {
+		c.series = map[string]*counterSeries{}
+	}
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: slices.Clone(labelValues)}
+		c.series[key] = s
+	}
+	s.n += v
+}
+
+// Value is the current count.
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[key]; ok {
+		return s.n
+	}
+	return 0
+}
+
+// Reset zeroes every series, Prometheus reads it like a restart.
+func (c *Counter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series = nil
+}
+
+func (c *Counter) write(_ context.Context, w io.Writer) {
+	c.writeHeader(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// an unlabelled counter is 0 before its first Inc rather than missing
+	if len(c.labels) == 0 && len(c.series) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(s.values), formatFloat(s.n))
+	}
+}
+
+// Histogram counts observations into buckets, per combination of label values.
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// Observe records v, e.g. a duration in seconds.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.series == nil {
+		h.series = map[string]*histogramSeries{}
+	}
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	// the first bucket whose upper bound is >= v, past the end means only +Inf
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(_ context.Context, w io.Writer) {
+	h.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.values, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(s.values), s.count)
+	}
+}
+
+type gaugeFunc struct {
+	family
+	fn func(ctx context.Context) (float64, error)
+}
+
+func (g *gaugeFunc) write(ctx context.Context, w io.Writer) {
+	v, err := g.fn(ctx)
+	if err != nil {
+		slog.Warn("⚠️ metrics: reading gauge failed", "metric", g.name, "error", err)
+		return
+	}
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(v))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
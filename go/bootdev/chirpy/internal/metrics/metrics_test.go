@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	logins := r.NewCounter("logins_failed_total", "Failed logins.")
+	requests := r.NewCounter("requests_total", "Requests by route.", "route")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("sessions", "Active sessions.", func(ctx context.Context) (float64, error) { return 3, nil })
+	r.NewGaugeFunc("broken", "Always fails.", func(ctx context.Context) (float64, error) { return 0, errors.New("db down") })
+
+	requests.Inc("/api/chirps")
+	requests.Add(2, "/api/chirps")
+	requests.Inc(`/say "hi"`)
+	latency.Observe(0.05, "/api/chirps")
+	latency.Observe(0.5, "/api/chirps")
+	latency.Observe(5, "/api/chirps")
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/api/chirps",le="0.1"} 1
+latency_seconds_bucket{route="/api/chirps",le="1"} 2
+latency_seconds_bucket{route="/api/chirps",le="+Inf"} 3
+latency_seconds_sum{route="/api/chirps"} 5.55
+latency_seconds_count{route="/api/chirps"} 3
+# HELP logins_failed_total Failed logins.
+# TYPE logins_failed_total counter
+logins_failed_total 0
+# HELP requests_total Requests by route.
+# TYPE requests_total counter
+requests_total{route="/api/chirps"} 3
+requests_total{route="/say \"hi\""} 1
+# HELP sessions Active sessions.
+# TYPE sessions gauge
+sessions 3
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("scrape =\n%s\nwant\n%s", got, want)
+	}
+
+	logins.Inc()
+	if got := logins.Value(); got != 1 {
+		t.Errorf("Value() = %v, want 1", got)
+	}
+	logins.Reset()
+	if got := logins.Value(); got != 0 {
+		t.Errorf("Value() after Reset() = %v, want 0", got)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(r *Registry)
+	}{
+		{name: "Duplicate name", fn: func(r *Registry) { r.NewCounter("a_total", ""); r.NewCounter("a_total", "") }},
+		{name: "Bad metric name", fn: func(r *Registry) { r.NewCounter("a-total", "") }},
+		{name: "Reserved label", fn: func(r *Registry) { r.NewHistogram("a", "", DefBuckets, "le") }},
+		{name: "Unsorted buckets", fn: func(r *Registry) { r.NewHistogram("a", "", []float64{1, 0.1}) }},
+		{name: "Wrong label count", fn: func(r *Registry) { r.NewCounter("a_total", "", "route").Inc() }},
+		{name: "Counter going down", fn: func(r *Registry) { r.NewCounter("a_total", "").Add(-1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("want a panic")
+				}
+			}()
+			tt.fn(NewRegistry())
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "", "method", "route", "status")
+	duration := r.NewHistogram("duration_seconds", "", DefBuckets, "method", "route", "status")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusTeapot) // superfluous, the client saw 201
+	})
+	h := Instrument(mux, requests, duration)
+
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/api/users", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	tests := []struct {
+		labels []string
+		want   float64
+	}{
+		{labels: []string{"GET", "/api/chirps/{chirpID}", "200"}, want: 2},
+		{labels: []string{"GET", "/api/users", "201"}, want: 1},
+		{labels: []string{"GET", "unmatched", "404"}, want: 1},
+	}
+	for _, tt := range tests {
+		if got := requests.Value(tt.labels...); got != tt.want {
+			t.Errorf("requests%v = %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+	if out := scrape(t, r); !strings.Contains(out, `duration_seconds_count{method="GET",route="/api/chirps/{chirpID}",status="200"} 2`) {
+		t.Errorf("scrape is missing the request duration:\n%s", out)
+	}
+}
@@ -0,0 +1,387 @@
+// Package migrate applies the goose annotated migrations embedded in the
+// binary. It keeps its bookkeeping in goose's own goose_db_version table, so a
+// database migrated by hand with the goose CLI is picked up where it left off.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaMismatch means the database isn't at the version the binary expects.
+var ErrSchemaMismatch = errors.New("schema version mismatch")
+
+// ErrNoAppliedMigrations means there is nothing for Down to roll back.
+var ErrNoAppliedMigrations = errors.New("no migrations applied")
+
+// errAlreadyRun means another migrator applied or rolled back the migration
+// between our reading goose_db_version and taking the lock.
+var errAlreadyRun = errors.New("another migrator got there first")
+
+// Dialect is the SQL that differs between the databases we migrate.
+type Dialect struct {
+	createVersionTable string
+	versionTableExists string
+	insertVersion      string
+	deleteVersion      string
+	// lock and unlock bracket Up and Down on a connection of their own, so
+	// migrators started side by side, e.g. replicas with AUTO_MIGRATE, take
+	// turns instead of applying the same migration twice
+	lock   string
+	unlock string
+	// lockTx starts every migration's transaction on databases without session
+	// locks, the migration is then skipped if another migrator already ran it
+	lockTx string
+}
+
+var (
+	Postgres = Dialect{
+		createVersionTable: `CREATE TABLE IF NOT EXISTS goose_db_version (
+    id SERIAL PRIMARY KEY,
+    version_id BIGINT NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP DEFAULT NOW()
+)`,
+		versionTableExists: "SELECT to_regclass('goose_db_version') IS NOT NULL",
+		insertVersion:      "INSERT INTO goose_db_version (version_id, is_applied, tstamp) VALUES ($1, TRUE, $2)",
+		deleteVersion:      "DELETE FROM goose_db_version WHERE version_id = $1",
+		// an arbitrary key, held by the session until unlocked or disconnected
+		lock:   "SELECT pg_advisory_lock(4356271738912011)",
+		unlock: "SELECT pg_advisory_unlock(4356271738912011)",
+	}
+	SQLite = Dialect{
+		createVersionTable: `CREATE TABLE IF NOT EXISTS goose_db_version (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version_id INTEGER NOT NULL,
+    is_applied BOOLEAN NOT NULL,
+    tstamp TIMESTAMP
+)`,
+		versionTableExists: "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version')",
+		insertVersion:      "INSERT INTO goose_db_version (version_id, is_applied, tstamp) VALUES (?, TRUE, ?)",
+		deleteVersion:      "DELETE FROM goose_db_version WHERE version_id = ?",
+		// a write that changes nothing still takes the database's single write
+		// lock, and holds it until the transaction ends
+		lockTx: "DELETE FROM goose_db_version WHERE version_id < 0",
+	}
+)
+
+// Migration is one NNN_name.sql file split into its Up and Down sections.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether, and when, it was applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New loads the *.sql migrations at the root of fsys.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Load parses the *.sql migrations at the root of fsys, oldest first.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := []Migration{}
+	for _, file := range files {
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("%s: want a NNN_name.sql file name", file)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%s: %q is not a version number", file, prefix)
+		}
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parse(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, Up: up, Down: down})
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("two migrations with version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// parse splits a migration on its -- +goose Up and Down annotations. Each
+// section runs as a single multi-statement Exec so StatementBegin/End, which
+// only guide goose's own statement splitting, are dropped.
+func parse(src string) (up, down string, err error) {
+	var sections [2]strings.Builder
+	current := -1
+	for _, line := range strings.SplitAfter(src, "\n") {
+		annotation, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+		if !ok {
+			if current >= 0 {
+				sections[current].WriteString(line)
+			}
+			continue
+		}
+		switch strings.TrimSpace(annotation) {
+		case "Up":
+			current = 0
+		case "Down":
+			current = 1
+		case "StatementBegin", "StatementEnd":
+		default:
+			return "", "", fmt.Errorf("unsupported annotation %q", strings.TrimSpace(line))
+		}
+	}
+	if current < 0 {
+		return "", "", errors.New("no -- +goose Up annotation")
+	}
+	return strings.TrimSpace(sections[0].String()), strings.TrimSpace(sections[1].String()), nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// queryer is the *sql.DB, *sql.Conn or *sql.Tx a read runs on.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// locked runs fn on a connection of its own holding the dialect's lock, with
+// goose_db_version created for Up and Down to record migrations in. Only they
+// call it, everything else only reads.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if m.dialect.lock != "" {
+		_, err := conn.ExecContext(ctx, m.dialect.lock)
+		if err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+		defer func() {
+			_, err := conn.ExecContext(context.WithoutCancel(ctx), m.dialect.unlock)
+			if err != nil {
+				// don't hand a connection that may still hold the lock back to the pool
+				conn.Raw(func(any) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+	_, err = conn.ExecContext(ctx, m.dialect.createVersionTable)
+	if err != nil {
+		return fmt.Errorf("creating goose_db_version: %w", err)
+	}
+	return fn(conn)
+}
+
+// applied returns when each applied version was applied. Like goose, the
+// newest row for a version decides whether it's applied. It only reads, so
+// Check can run on every readiness probe and as a read-only role; a database
+// without goose_db_version has nothing applied.
+func (m *Migrator) applied(ctx context.Context, q queryer) (map[int64]time.Time, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, m.dialect.versionTableExists).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[int64]time.Time{}, nil
+	}
+	rows, err := q.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM goose_db_version ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	seen := map[int64]bool{}
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var at sql.NullTime
+		if err := rows.Scan(&version, &isApplied, &at); err != nil {
+			return nil, err
+		}
+		if seen[version] {
+			continue
+		}
+		seen[version] = true
+		// goose's own version 0 row marks the table as initialised
+		if isApplied && version > 0 {
+			applied[version] = at.Time
+		}
+	}
+	return applied, rows.Err()
+}
+
+// Version is the newest applied migration, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// Status lists every migration, oldest first, with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		at, ok := applied[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: at}
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the ones it applied. It holds the migration lock throughout, so
+// concurrent migrators take turns.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := []Migration{}
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			err := m.run(ctx, conn, mig, true)
+			if errors.Is(err, errAlreadyRun) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("applying %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the newest applied migration and returns it.
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	var done Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range slices.Backward(m.migrations) {
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			err := m.run(ctx, conn, mig, false)
+			if err != nil {
+				return fmt.Errorf("rolling back %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			done = mig
+			return nil
+		}
+		return ErrNoAppliedMigrations
+	})
+	return done, err
+}
+
+// run applies or rolls back a migration and records it in one transaction.
+// It returns errAlreadyRun if another migrator got to the migration first.
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	section, record, args := mig.Down, m.dialect.deleteVersion, []any{mig.Version}
+	if up {
+		section, record, args = mig.Up, m.dialect.insertVersion, []any{mig.Version, time.Now().UTC()}
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback after a successful Commit is a no-op
+	defer tx.Rollback()
+	if m.dialect.lockTx != "" {
+		_, err = tx.ExecContext(ctx, m.dialect.lockTx)
+		if err != nil {
+			return fmt.Errorf("taking the migration lock: %w", err)
+		}
+		applied, err := m.applied(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if _, ok := applied[mig.Version]; ok == up {
+			return errAlreadyRun
+		}
+	}
+	if section != "" {
+		_, err = tx.ExecContext(ctx, section)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Check returns ErrSchemaMismatch unless the database is at Latest.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version < m.Latest():
+		return fmt.Errorf("%w: database is at version %d, this binary expects %d, run `chirpy migrate up`", ErrSchemaMismatch, version, m.Latest())
+	case version > m.Latest():
+		return fmt.Errorf("%w: database is at version %d, newer than the %d this binary knows about", ErrSchemaMismatch, version, m.Latest())
+	}
+	return nil
+}
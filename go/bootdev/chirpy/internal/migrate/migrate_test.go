@@ -0,0 +1,303 @@
+package migrate
+
+import (
+	"chirpy/internal/database/sqlitedb"
+	"chirpy/internal/subscription"
+	sqlitemigrations "chirpy/sql/sqlite/migrations"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlitedb.Open(":memory:")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "Sorted by version with sections split",
+			files: fstest.MapFS{
+				"010_later.sql": {Data: []byte("-- +goose Up\nCREATE TABLE b (id INTEGER);\n\n-- +goose Down\nDROP TABLE b;\n")},
+				"002_first.sql": {Data: []byte("\n-- +goose Up\n-- +goose StatementBegin\nCREATE TABLE a (id INTEGER);\n-- +goose StatementEnd\n")},
+				"README.md":     {Data: []byte("not a migration")},
+			},
+			want: []Migration{
+				{Version: 2, Name: "first", Up: "CREATE TABLE a (id INTEGER);"},
+				{Version: 10, Name: "later", Up: "CREATE TABLE b (id INTEGER);", Down: "DROP TABLE b;"},
+			},
+		},
+		{
+			name:    "No version prefix",
+			files:   fstest.MapFS{"first.sql": {Data: []byte("-- +goose Up\n")}},
+			wantErr: true,
+		},
+		{
+			name: "Duplicate version",
+			files: fstest.MapFS{
+				"001_a.sql": {Data: []byte("-- +goose Up\n")},
+				"1_b.sql":   {Data: []byte("-- +goose Up\n")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Missing Up annotation",
+			files:   fstest.MapFS{"001_a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);\n")}},
+			wantErr: true,
+		},
+		{
+			name:    "Unsupported annotation",
+			files:   fstest.MapFS{"001_a.sql": {Data: []byte("-- +goose NO TRANSACTION\n-- +goose Up\n")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Load() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Load()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m, err := New(db, SQLite, fstest.MapFS{
+		"001_users.sql":  {Data: []byte("-- +goose Up\nCREATE TABLE users (id INTEGER);\n-- +goose Down\nDROP TABLE users;\n")},
+		"002_chirps.sql": {Data: []byte("-- +goose Up\nCREATE TABLE chirps (id INTEGER);\n-- +goose Down\nDROP TABLE chirps;\n")},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	err = m.Check(ctx)
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Errorf("Check() on an empty database error = %v, want ErrSchemaMismatch", err)
+	}
+	// Check runs on every readiness probe, it mustn't issue DDL
+	var tables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'goose_db_version'").Scan(&tables)
+	if err != nil || tables != 0 {
+		t.Errorf("goose_db_version tables after Check() = %d, %v, want none", tables, err)
+	}
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 2 {
+		t.Fatalf("Up() = %d migrations, %v, want 2", len(applied), err)
+	}
+	applied, err = m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second Up() = %d migrations, %v, want none", len(applied), err)
+	}
+	err = m.Check(ctx)
+	if err != nil {
+		t.Errorf("Check() after Up() error = %v", err)
+	}
+
+	rolledBack, err := m.Down(ctx)
+	if err != nil || rolledBack.Version != 2 {
+		t.Fatalf("Down() = %d, %v, want version 2", rolledBack.Version, err)
+	}
+	_, err = db.Exec("SELECT * FROM chirps")
+	if err == nil {
+		t.Errorf("chirps table still exists after Down()")
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !statuses[0].Applied || statuses[0].AppliedAt.IsZero() || statuses[1].Applied {
+		t.Errorf("Status() = %+v, want 001 applied and 002 pending", statuses)
+	}
+	version, err := m.Version(ctx)
+	if err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v, want 1", version, err)
+	}
+
+	_, err = m.Down(ctx)
+	if err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	_, err = m.Down(ctx)
+	if !errors.Is(err, ErrNoAppliedMigrations) {
+		t.Errorf("Down() with nothing applied error = %v, want ErrNoAppliedMigrations", err)
+	}
+}
+
+func TestMigratorFailedMigrationRollsBack(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m, err := New(db, SQLite, fstest.MapFS{
+		"001_ok.sql":     {Data: []byte("-- +goose Up\nCREATE TABLE ok (id INTEGER);\n")},
+		"002_broken.sql": {Data: []byte("-- +goose Up\nCREATE TABLE half (id INTEGER);\nNOT SQL;\n")},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	applied, err := m.Up(ctx)
+	if err == nil || len(applied) != 1 {
+		t.Fatalf("Up() = %d migrations, %v, want 1 and an error", len(applied), err)
+	}
+	_, err = db.Exec("SELECT * FROM half")
+	if err == nil {
+		t.Errorf("half applied migration left its table behind")
+	}
+	version, err := m.Version(ctx)
+	if err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v, want 1", version, err)
+	}
+}
+
+// TestMigratorStaleRead has a migrator act on what it read of
+// goose_db_version before another migrator, started alongside it as replicas
+// with AUTO_MIGRATE are, applied everything.
+func TestMigratorStaleRead(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+	files := fstest.MapFS{
+		"001_users.sql": {Data: []byte("-- +goose Up\nCREATE TABLE users (id INTEGER);\n-- +goose Down\nDROP TABLE users;\n")},
+	}
+	migrators := make([]*Migrator, 2)
+	for i := range migrators {
+		db, err := sqlitedb.Open(path)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		migrators[i], err = New(db, SQLite, files)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+	}
+	stale := migrators[1]
+	err := stale.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := stale.applied(ctx, conn)
+		if err != nil || len(applied) != 0 {
+			t.Fatalf("applied() = %v, %v, want nothing", applied, err)
+		}
+		_, err = migrators[0].Up(ctx)
+		if err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+		return stale.run(ctx, conn, stale.migrations[0], true)
+	})
+	if !errors.Is(err, errAlreadyRun) {
+		t.Errorf("run() after another migrator applied the migration error = %v, want errAlreadyRun", err)
+	}
+	version, err := stale.Version(ctx)
+	if err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v, want 1", version, err)
+	}
+}
+
+// TestSQLiteMigrations walks the real SQLite migrations all the way up, down
+// and up again so every Down section gets exercised.
+func TestSQLiteMigrations(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(openSQLite(t), SQLite, sqlitemigrations.FS)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	for {
+		_, err := m.Down(ctx)
+		if errors.Is(err, ErrNoAppliedMigrations) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Down() error = %v", err)
+		}
+	}
+	_, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() after rolling everything back error = %v", err)
+	}
+	err = m.Check(ctx)
+	if err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+}
+
+// TestSQLiteLegacyRedBackfill checks that Red users from before subscriptions
+// keep Red: migration 006 gives them subscription.LegacyPeriodEnd.
+func TestSQLiteLegacyRedBackfill(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m, err := New(db, SQLite, sqlitemigrations.FS)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	for {
+		version, err := m.Version(ctx)
+		if err != nil {
+			t.Fatalf("Version() error = %v", err)
+		}
+		if version < 6 {
+			break
+		}
+		_, err = m.Down(ctx)
+		if err != nil {
+			t.Fatalf("Down() error = %v", err)
+		}
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO users (email, is_chirpy_red) VALUES ('red@example.com', TRUE), ('plain@example.com', FALSE)`)
+	if err != nil {
+		t.Fatalf("inserting users error = %v", err)
+	}
+	_, err = m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	store := sqlitedb.NewStore(db, nil)
+	user, err := store.GetUserByEmail(ctx, "red@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	sub, err := store.GetSubscriptionByUserID(ctx, user.ID)
+	if err != nil || !sub.CurrentPeriodEnd.Equal(subscription.LegacyPeriodEnd) || !subscription.IsActive(sub, time.Now()) {
+		t.Errorf("legacy Red subscription = %+v, %v, want active until %s", sub, err, subscription.LegacyPeriodEnd)
+	}
+	n, err := store.ExpireLapsedSubscriptions(ctx)
+	if err != nil || n != 0 {
+		t.Errorf("ExpireLapsedSubscriptions() = %d, %v, want the legacy subscription left alone", n, err)
+	}
+	var count int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM subscriptions`).Scan(&count)
+	if err != nil || count != 1 {
+		t.Errorf("subscriptions = %d, %v, want only the Red user's", count, err)
+	}
+}
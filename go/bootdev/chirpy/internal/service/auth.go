@@ -0,0 +1,170 @@
+package service
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// Session is what a successful login hands back to the client.
+type Session struct {
+	User         User
+	AccessToken  string
+	RefreshToken string
+}
+
+// AuthService logs users in and issues, refreshes and revokes their tokens.
+type AuthService interface {
+	Login(ctx context.Context, email, password string) (Session, error)
+	Refresh(ctx context.Context, refreshToken string) (string, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	// Authenticate validates an access token and returns its user ID.
+	Authenticate(accessToken string) (uuid.UUID, error)
+}
+
+// AuthConfig holds the token settings, zero TTLs fall back to the defaults.
+type AuthConfig struct {
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type authService struct {
+	store  database.Store
+	hasher auth.PasswordHasher
+	cfg    AuthConfig
+	// dummyHash is verified against for unknown emails, so they take as long
+	// as a wrong password and timing doesn't reveal who's registered
+	dummyHash string
+}
+
+// NewAuthService returns an AuthService backed by store.
+func NewAuthService(store database.Store, hasher auth.PasswordHasher, cfg AuthConfig) AuthService {
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	// a failed hash leaves it empty, unknown emails then just fail faster
+	dummyHash, err := hasher.Hash("chirpy dummy password")
+	if err != nil {
+		slog.Error("hashing the dummy login password failed", "error", err)
+	}
+	return &authService{store: store, hasher: hasher, cfg: cfg, dummyHash: dummyHash}
+}
+
+// Login checks the password, transparently upgrading outdated hashes, and
+// issues an access token and a refresh token.
+func (s *authService) Login(ctx context.Context, email, password string) (Session, error) {
+	user, err := s.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.hasher.Verify(s.dummyHash, password)
+		return Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	err = s.hasher.Verify(user.HashedPassword, password)
+	if err != nil {
+		return Session{}, ErrInvalidCredentials
+	}
+	// upgrade legacy or outdated hashes now that we know the plaintext
+	if s.hasher.NeedsRehash(user.HashedPassword) {
+		s.rehashPassword(ctx, user.ID, password)
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return Session{}, err
+	}
+	_, err = s.store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     refreshToken,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	accessToken, err := auth.MakeJWT(user.ID, s.cfg.JWTSecret, s.cfg.AccessTokenTTL)
+	if err != nil {
+		return Session{}, err
+	}
+	u, err := withSubscription(ctx, s.store, user)
+	if err != nil {
+		return Session{}, err
+	}
+	return Session{User: u, AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// rehashPassword re-hashes a verified password with the current hasher and stores it.
+// Failures are only logged, the login itself already succeeded.
+func (s *authService) rehashPassword(ctx context.Context, userID uuid.UUID, password string) {
+	hp, err := s.hasher.Hash(password)
+	if err != nil {
+		slog.Error("rehash password failed", "user_id", userID, "error", err)
+		return
+	}
+	err = s.store.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: userID, HashedPassword: hp})
+	if err != nil {
+		slog.Error("UpdateUserPassword failed", "user_id", userID, "error", err)
+		return
+	}
+	slog.Info("🔑 password hash upgraded", "user_id", userID)
+}
+
+// Refresh issues a new access token for a valid, unrevoked refresh token.
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (string, error) {
+	rt, err := s.store.GetRefreshToken(ctx, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if rt.ExpiresAt.Before(time.Now()) || rt.RevokedAt.Valid {
+		return "", ErrInvalidRefreshToken
+	}
+	_, err = s.store.GetUserByID(ctx, rt.UserID)
+	// a token outliving its user is as good as revoked
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return auth.MakeJWT(rt.UserID, s.cfg.JWTSecret, s.cfg.AccessTokenTTL)
+}
+
+// Revoke revokes a refresh token, revoking one twice is an error.
+func (s *authService) Revoke(ctx context.Context, refreshToken string) error {
+	rt, err := s.store.GetRefreshToken(ctx, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if rt.RevokedAt.Valid {
+		return ErrInvalidRefreshToken
+	}
+	return s.store.RevokeRefreshToken(ctx, refreshToken)
+}
+
+func (s *authService) Authenticate(accessToken string) (uuid.UUID, error) {
+	userID, err := auth.ValidateJWT(accessToken, s.cfg.JWTSecret)
+	if err != nil || userID == uuid.Nil {
+		return uuid.Nil, ErrInvalidAccessToken
+	}
+	return userID, nil
+}
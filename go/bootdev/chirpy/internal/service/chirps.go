@@ -0,0 +1,190 @@
+package service
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/events"
+	"chirpy/internal/validate"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const maxChirpLength = 140
+
+// profanity is replaced with **** in chirp bodies.
+var profanity = regexp.MustCompile(`(?i)kerfuffle|sharbert|fornax`)
+
+// ChirpService creates, reads and deletes chirps.
+type ChirpService interface {
+	Create(ctx context.Context, userID uuid.UUID, body string) (database.Chirp, error)
+	Get(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	List(ctx context.Context, query ChirpQuery) ([]database.Chirp, error)
+	Delete(ctx context.Context, userID, chirpID uuid.UUID, pre Precondition[database.Chirp]) error
+}
+
+const maxHashtagLength = 50
+
+var hashtagPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ChirpQuery is what List selects, built up a filter at a time:
+//
+//	service.NewChirpQuery().ByAuthor(id).WithHashtag("go").NewestFirst()
+//
+// Filters combine with AND and all run in one query. The zero ChirpQuery
+// lists every chirp oldest first.
+type ChirpQuery struct {
+	authorID    uuid.UUID
+	since       time.Time
+	until       time.Time
+	hashtag     string
+	search      string
+	newestFirst bool
+}
+
+// NewChirpQuery returns a query for every chirp, oldest first.
+func NewChirpQuery() ChirpQuery {
+	return ChirpQuery{}
+}
+
+// ByAuthor keeps the chirps userID wrote.
+func (q ChirpQuery) ByAuthor(userID uuid.UUID) ChirpQuery {
+	q.authorID = userID
+	return q
+}
+
+// Since keeps chirps created at or after t.
+func (q ChirpQuery) Since(t time.Time) ChirpQuery {
+	q.since = t
+	return q
+}
+
+// Until keeps chirps created before t.
+func (q ChirpQuery) Until(t time.Time) ChirpQuery {
+	q.until = t
+	return q
+}
+
+// WithHashtag keeps chirps tagged #tag, the # is optional and case is ignored.
+func (q ChirpQuery) WithHashtag(tag string) ChirpQuery {
+	q.hashtag = strings.TrimPrefix(tag, "#")
+	return q
+}
+
+// Matching keeps chirps whose body contains text, ignoring case.
+func (q ChirpQuery) Matching(text string) ChirpQuery {
+	q.search = strings.TrimSpace(text)
+	return q
+}
+
+// NewestFirst orders the chirps newest first.
+func (q ChirpQuery) NewestFirst() ChirpQuery {
+	q.newestFirst = true
+	return q
+}
+
+// Validate checks every filter at once and returns a *ValidationError listing
+// each one that's wrong.
+func (q ChirpQuery) Validate() error {
+	var fields []validate.FieldError
+	if !q.since.IsZero() && !q.until.IsZero() && !q.since.Before(q.until) {
+		fields = append(fields, validate.FieldError{Field: "until", Rule: "after_since", Message: "must be after since"})
+	}
+	if q.hashtag != "" && (len(q.hashtag) > maxHashtagLength || !hashtagPattern.MatchString(q.hashtag)) {
+		fields = append(fields, validate.FieldError{Field: "hashtag", Rule: "hashtag", Message: fmt.Sprintf("must be 1 to %d letters, digits or underscores", maxHashtagLength)})
+	}
+	if utf8.RuneCountInString(q.search) > maxChirpLength {
+		fields = append(fields, validate.FieldError{Field: "search", Rule: "max", Message: fmt.Sprintf("must be at most %d characters", maxChirpLength)})
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Msg: "invalid chirp query", Fields: fields}
+	}
+	return nil
+}
+
+func (q ChirpQuery) params() database.ListChirpsParams {
+	// timestamps are stored in UTC
+	return database.ListChirpsParams{
+		AuthorID:    uuid.NullUUID{UUID: q.authorID, Valid: q.authorID != uuid.Nil},
+		Since:       sql.NullTime{Time: q.since.UTC(), Valid: !q.since.IsZero()},
+		Until:       sql.NullTime{Time: q.until.UTC(), Valid: !q.until.IsZero()},
+		Hashtag:     sql.NullString{String: q.hashtag, Valid: q.hashtag != ""},
+		Search:      sql.NullString{String: q.search, Valid: q.search != ""},
+		NewestFirst: q.newestFirst,
+	}
+}
+
+type chirpService struct {
+	store database.Store
+}
+
+// NewChirpService returns a ChirpService backed by store.
+func NewChirpService(store database.Store) ChirpService {
+	return &chirpService{store: store}
+}
+
+// Create validates and sanitises the body, stores the chirp and records chirp.created.
+func (s *chirpService) Create(ctx context.Context, userID uuid.UUID, body string) (database.Chirp, error) {
+	if utf8.RuneCountInString(body) > maxChirpLength {
+		return database.Chirp{}, &ValidationError{Msg: "chirp is too long"}
+	}
+	body = profanity.ReplaceAllString(body, "****")
+	var chirp database.Chirp
+	err := s.store.InTx(ctx, func(store database.Store) error {
+		var err error
+		chirp, err = store.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: userID})
+		if err != nil {
+			return err
+		}
+		return events.Record(ctx, store, events.ChirpCreated, userID, chirp)
+	})
+	return chirp, err
+}
+
+func (s *chirpService) Get(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.store.GetChirp(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Chirp{}, ErrChirpNotFound
+	}
+	return chirp, err
+}
+
+// List validates the query before running it.
+func (s *chirpService) List(ctx context.Context, query ChirpQuery) ([]database.Chirp, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListChirps(ctx, query.params())
+}
+
+// Delete deletes a chirp owned by userID and records chirp.deleted.
+func (s *chirpService) Delete(ctx context.Context, userID, chirpID uuid.UUID, pre Precondition[database.Chirp]) error {
+	return s.store.InTx(ctx, func(store database.Store) error {
+		// locked, so a concurrent delete can't pass the same precondition
+		chirp, err := store.GetChirpForUpdate(ctx, chirpID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrChirpNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if chirp.UserID != userID {
+			return ErrNotChirpOwner
+		}
+		if !pre.holds(chirp) {
+			return ErrPreconditionFailed
+		}
+		err = store.DeleteChirp(ctx, chirpID)
+		if err != nil {
+			return err
+		}
+		return events.Record(ctx, store, events.ChirpDeleted, userID, chirp)
+	})
+}
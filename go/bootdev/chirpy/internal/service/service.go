@@ -0,0 +1,76 @@
+// Package service holds chirpy's business logic: ChirpService, UserService and
+// AuthService. Services only talk to storage through database.Store, so they run
+// the same against Postgres or memstore, from the HTTP API, a CLI or tests.
+//
+// Multi-step operations run in a single Store.InTx transaction and record
+// the domain events they cause in the outbox in that same transaction, so an
+// event exists if and only if its change committed.
+//
+// Failures a caller can act on are an *Error or a *ValidationError, anything
+// else is unexpected and its message isn't meant for clients.
+package service
+
+import "chirpy/internal/validate"
+
+// Kind is the sort of failure an Error is. Callers map it to their own
+// responses, the HTTP API to a status code.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindPreconditionFailed
+)
+
+// Error is a failure the caller can act on. Code is stable and machine
+// readable, Msg is safe to show to the client.
+type Error struct {
+	Kind Kind
+	Code string
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+var (
+	ErrChirpNotFound       = &Error{Kind: KindNotFound, Code: "chirp_not_found", Msg: "chirp not found"}
+	ErrNotChirpOwner       = &Error{Kind: KindForbidden, Code: "not_chirp_owner", Msg: "chirp does not belong to user"}
+	ErrUserNotFound        = &Error{Kind: KindNotFound, Code: "user_not_found", Msg: "user not found"}
+	ErrNoSubscription      = &Error{Kind: KindNotFound, Code: "no_subscription", Msg: "no subscription"}
+	ErrInvalidCredentials  = &Error{Kind: KindUnauthenticated, Code: "invalid_credentials", Msg: "invalid email or password"}
+	ErrInvalidAccessToken  = &Error{Kind: KindUnauthenticated, Code: "invalid_access_token", Msg: "invalid or missing access token"}
+	ErrInvalidRefreshToken = &Error{Kind: KindUnauthenticated, Code: "invalid_refresh_token", Msg: "invalid or expired refresh token"}
+	ErrPreconditionFailed  = &Error{Kind: KindPreconditionFailed, Code: "precondition_failed", Msg: "it changed since you last read it"}
+	// ErrWebhookEventProcessed is a duplicate delivery, acknowledge it and move on
+	ErrWebhookEventProcessed = &Error{Kind: KindInvalid, Code: "event_already_processed", Msg: "event already processed"}
+)
+
+// Precondition is a caller's check on the current state of what a write is
+// about to change, run in the write's transaction just before the write, on
+// the row locked for it so a concurrent write can't pass the same check. The
+// write fails with ErrPreconditionFailed if it returns false; a nil
+// Precondition always holds.
+type Precondition[T any] func(current T) bool
+
+func (p Precondition[T]) holds(current T) bool {
+	return p == nil || p(current)
+}
+
+// ValidationError reports input a service refused, its message is safe to
+// show to the client. Fields, if set, says what's wrong with each field.
+type ValidationError struct {
+	Msg    string
+	Fields []validate.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+// CodeValidationFailed is the Code of every ValidationError.
+const CodeValidationFailed = "validation_failed"
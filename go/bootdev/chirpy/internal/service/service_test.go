@@ -0,0 +1,572 @@
+package service
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/database/memstore"
+	"chirpy/internal/events"
+	"chirpy/internal/subscription"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// testHasher keeps the Argon2id cost low so the tests stay fast.
+var testHasher = auth.NewArgon2idHasher(auth.Argon2idParams{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+})
+
+type testServices struct {
+	store  *memstore.Store
+	chirps ChirpService
+	users  UserService
+	auth   AuthService
+}
+
+func newTestServices() testServices {
+	store := memstore.New()
+	return testServices{
+		store:  store,
+		chirps: NewChirpService(store),
+		users:  NewUserService(store, testHasher, auth.NewPasswordPolicy(8, 64)),
+		auth:   NewAuthService(store, testHasher, AuthConfig{JWTSecret: "test-secret"}),
+	}
+}
+
+// outbox returns the types of the recorded domain events, oldest first.
+func outbox(t *testing.T, s testServices) []string {
+	t.Helper()
+	evts, err := s.store.ListDueOutboxEvents(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("ListDueOutboxEvents() error = %v", err)
+	}
+	types := []string{}
+	for _, e := range evts {
+		types = append(types, e.EventType)
+	}
+	return types
+}
+
+func mustCreateWebhookEvent(t *testing.T, s testServices, id string) {
+	t.Helper()
+	_, err := s.store.CreateWebhookEvent(context.Background(), database.CreateWebhookEventParams{ID: id})
+	if err != nil {
+		t.Fatalf("CreateWebhookEvent(%q) error = %v", id, err)
+	}
+}
+
+func webhookEventProcessed(t *testing.T, s testServices, id string) bool {
+	t.Helper()
+	evt, err := s.store.GetWebhookEvent(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetWebhookEvent(%q) error = %v", id, err)
+	}
+	return evt.ProcessedAt.Valid
+}
+
+func mustCreateUser(t *testing.T, s testServices, email string) User {
+	t.Helper()
+	user, err := s.users.Create(context.Background(), email, "correct horse")
+	if err != nil {
+		t.Fatalf("Create(%q) error = %v", email, err)
+	}
+	return user
+}
+
+func TestChirpServiceCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     string
+		wantErr  bool
+		wantEvts int
+	}{
+		{
+			name:     "Plain chirp",
+			body:     "hello world",
+			want:     "hello world",
+			wantEvts: 1,
+		},
+		{
+			name:     "Profanity is replaced regardless of case",
+			body:     "what a Kerfuffle and a sharbert",
+			want:     "what a **** and a ****",
+			wantEvts: 1,
+		},
+		{
+			name:    "Too long",
+			body:    strings.Repeat("a", 141),
+			wantErr: true,
+		},
+		{
+			name:     "Length is counted in characters, not bytes",
+			body:     strings.Repeat("🐦", 140),
+			want:     strings.Repeat("🐦", 140),
+			wantEvts: 1,
+		},
+		{
+			name:    "Too long in characters",
+			body:    strings.Repeat("é", 141),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServices()
+			user := mustCreateUser(t, s, "a@example.com")
+			chirp, err := s.chirps.Create(context.Background(), user.ID, tt.body)
+			var verr *ValidationError
+			if tt.wantErr {
+				if !errors.As(err, &verr) {
+					t.Fatalf("Create() error = %v, want ValidationError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if chirp.Body != tt.want {
+				t.Errorf("Create() body = %q, want %q", chirp.Body, tt.want)
+			}
+			if got := len(outbox(t, s)); got != tt.wantEvts {
+				t.Errorf("outbox has %d events, want %d", got, tt.wantEvts)
+			}
+		})
+	}
+}
+
+func TestChirpServiceDelete(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	owner := mustCreateUser(t, s, "owner@example.com")
+	other := mustCreateUser(t, s, "other@example.com")
+	chirp, err := s.chirps.Create(ctx, owner.ID, "mine")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	stale := func(database.Chirp) bool { return false }
+	tests := []struct {
+		name    string
+		userID  uuid.UUID
+		chirpID uuid.UUID
+		pre     Precondition[database.Chirp]
+		wantErr error
+	}{
+		{name: "Not the owner", userID: other.ID, chirpID: chirp.ID, wantErr: ErrNotChirpOwner},
+		{name: "Unknown chirp", userID: owner.ID, chirpID: uuid.New(), wantErr: ErrChirpNotFound},
+		{name: "Precondition fails", userID: owner.ID, chirpID: chirp.ID, pre: stale, wantErr: ErrPreconditionFailed},
+		{name: "Owner deletes", userID: owner.ID, chirpID: chirp.ID, pre: func(c database.Chirp) bool { return c.ID == chirp.ID }},
+		{name: "Already deleted", userID: owner.ID, chirpID: chirp.ID, wantErr: ErrChirpNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.chirps.Delete(ctx, tt.userID, tt.chirpID, tt.pre)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Delete() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	// one chirp.created, one chirp.deleted, failed deletes record nothing
+	got := outbox(t, s)
+	if len(got) != 2 || got[1] != events.ChirpDeleted {
+		t.Errorf("outbox = %v, want chirp.created then chirp.deleted", got)
+	}
+}
+
+func TestChirpServiceList(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	alice := mustCreateUser(t, s, "alice@example.com")
+	bob := mustCreateUser(t, s, "bob@example.com")
+	var created []time.Time
+	for _, c := range []struct {
+		user uuid.UUID
+		body string
+	}{{alice.ID, "a1 #Go"}, {bob.ID, "b1 #golang"}, {alice.ID, "a2 hello"}} {
+		chirp, err := s.chirps.Create(ctx, c.user, c.body)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		created = append(created, chirp.CreatedAt)
+	}
+	tests := []struct {
+		name  string
+		query ChirpQuery
+		want  []string
+	}{
+		{name: "All ascending", query: NewChirpQuery(), want: []string{"a1 #Go", "b1 #golang", "a2 hello"}},
+		{name: "All descending", query: NewChirpQuery().NewestFirst(), want: []string{"a2 hello", "b1 #golang", "a1 #Go"}},
+		{name: "By author", query: NewChirpQuery().ByAuthor(alice.ID), want: []string{"a1 #Go", "a2 hello"}},
+		{name: "Unknown author", query: NewChirpQuery().ByAuthor(uuid.New()), want: []string{}},
+		{name: "Time range", query: NewChirpQuery().Since(created[1]).Until(created[2]), want: []string{"b1 #golang"}},
+		{name: "Hashtag is a whole word", query: NewChirpQuery().WithHashtag("#go"), want: []string{"a1 #Go"}},
+		{name: "Search ignores case", query: NewChirpQuery().Matching("HELLO"), want: []string{"a2 hello"}},
+		{name: "Combined", query: NewChirpQuery().ByAuthor(alice.ID).Since(created[0]).Matching("a").NewestFirst(), want: []string{"a2 hello", "a1 #Go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chirps, err := s.chirps.List(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			got := []string{}
+			for _, c := range chirps {
+				got = append(got, c.Body)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChirpQueryValidate(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		query      ChirpQuery
+		wantFields []string
+	}{
+		{name: "Valid", query: NewChirpQuery().Since(now).Until(now.Add(time.Hour)).WithHashtag("#go_lang").Matching("hi")},
+		{name: "Empty range", query: NewChirpQuery().Since(now).Until(now), wantFields: []string{"until"}},
+		{name: "Every bad filter is reported", query: NewChirpQuery().WithHashtag("not a tag").Matching(strings.Repeat("x", maxChirpLength+1)), wantFields: []string{"hashtag", "search"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			var verr *ValidationError
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			var got []string
+			for _, f := range verr.Fields {
+				got = append(got, f.Field)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("Validate() fields = %v, want %v", got, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestUserServiceCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "Valid password", password: "correct horse"},
+		{name: "Too short", password: "short", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServices()
+			user, err := s.users.Create(context.Background(), "a@example.com", tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if user.HashedPassword == tt.password || user.IsChirpyRed {
+				t.Errorf("Create() = %+v, want hashed password and no Chirpy Red", user)
+			}
+		})
+	}
+}
+
+// countingHasher counts the passwords it hashes.
+type countingHasher struct {
+	auth.PasswordHasher
+	hashes int
+}
+
+func (h *countingHasher) Hash(password string) (string, error) {
+	h.hashes++
+	return h.PasswordHasher.Hash(password)
+}
+
+func TestUserServiceUpdate(t *testing.T) {
+	s := newTestServices()
+	hasher := &countingHasher{PasswordHasher: testHasher}
+	s.users = NewUserService(s.store, hasher, auth.NewPasswordPolicy(8, 64))
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	tests := []struct {
+		name       string
+		id         uuid.UUID
+		email      string
+		pre        Precondition[User]
+		wantErr    error
+		wantEmail  string
+		wantHashed bool
+	}{
+		{name: "Unknown user", id: uuid.New(), email: "x@example.com", pre: func(User) bool { return true }, wantErr: ErrUserNotFound},
+		{name: "Unknown user without a precondition", id: uuid.New(), email: "x@example.com", wantErr: ErrUserNotFound},
+		{name: "Precondition fails", id: user.ID, email: "b@example.com", pre: func(u User) bool { return u.Email == "someone@example.com" }, wantErr: ErrPreconditionFailed, wantEmail: "a@example.com"},
+		{name: "Precondition holds", id: user.ID, email: "b@example.com", pre: func(u User) bool { return u.Email == "a@example.com" }, wantEmail: "b@example.com", wantHashed: true},
+		{name: "No precondition", id: user.ID, email: "c@example.com", wantEmail: "c@example.com", wantHashed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher.hashes = 0
+			_, err := s.users.Update(ctx, tt.id, tt.email, "correct horse", tt.pre)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+			// a refused update shouldn't pay for hashing the password
+			if hashed := hasher.hashes > 0; hashed != tt.wantHashed {
+				t.Errorf("Update() hashed the password = %v, want %v", hashed, tt.wantHashed)
+			}
+			if tt.wantEmail == "" {
+				return
+			}
+			got, err := s.users.Get(ctx, user.ID)
+			if err != nil || got.Email != tt.wantEmail {
+				t.Errorf("after Update() email = %q, %v, want %q", got.Email, err, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestUserServiceUpdateConcurrentStaleWriters(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	// both clients read the same version and send it as If-Match
+	pre := func(u User) bool { return u.Email == "a@example.com" }
+	errs := make(chan error, 2)
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.users.Update(ctx, user.ID, fmt.Sprintf("writer%d@example.com", i), "correct horse", pre)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrPreconditionFailed):
+			t.Errorf("Update() error = %v, want nil or ErrPreconditionFailed", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d stale updates succeeded, want 1", succeeded)
+	}
+}
+
+func TestAuthService(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+
+	_, err := s.auth.Login(ctx, "a@example.com", "wrong password")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	_, err = s.auth.Login(ctx, "nobody@example.com", "correct horse")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() with unknown email error = %v, want ErrInvalidCredentials", err)
+	}
+
+	session, err := s.auth.Login(ctx, "a@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	userID, err := s.auth.Authenticate(session.AccessToken)
+	if err != nil || userID != user.ID {
+		t.Errorf("Authenticate() = %v, %v, want %v", userID, err, user.ID)
+	}
+	_, err = s.auth.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	err = s.auth.Revoke(ctx, session.RefreshToken)
+	if err != nil {
+		t.Errorf("Revoke() error = %v", err)
+	}
+	_, err = s.auth.Refresh(ctx, session.RefreshToken)
+	if !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Refresh() after revoke error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+// verifyRecorder records the hashes a login verifies.
+type verifyRecorder struct {
+	auth.PasswordHasher
+	verified []string
+}
+
+func (h *verifyRecorder) Verify(hash, password string) error {
+	h.verified = append(h.verified, hash)
+	return h.PasswordHasher.Verify(hash, password)
+}
+
+func TestAuthServiceLoginUnknownEmailVerifiesAHash(t *testing.T) {
+	store := memstore.New()
+	hasher := &verifyRecorder{PasswordHasher: testHasher}
+	svc := NewAuthService(store, hasher, AuthConfig{JWTSecret: "test-secret"})
+	_, err := svc.Login(context.Background(), "nobody@example.com", "correct horse")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login() error = %v, want ErrInvalidCredentials", err)
+	}
+	// a real Argon2id hash, so it costs what checking a registered user's does
+	if len(hasher.verified) != 1 || !strings.HasPrefix(hasher.verified[0], "$argon2id$") {
+		t.Errorf("Login() verified %q, want one Argon2id hash", hasher.verified)
+	}
+}
+
+func TestApplySubscriptionChange(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	mustCreateWebhookEvent(t, s, "evt_1")
+	mustCreateWebhookEvent(t, s, "evt_2")
+	mustCreateWebhookEvent(t, s, "evt_3")
+
+	err := s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_1", Type: events.UserUpgraded, UserID: uuid.New()})
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("ApplySubscriptionChange() for unknown user error = %v, want ErrUserNotFound", err)
+	}
+	if webhookEventProcessed(t, s, "evt_1") {
+		t.Errorf("failed change marked the webhook event processed")
+	}
+
+	err = s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_2", Type: events.UserUpgraded, UserID: user.ID})
+	if err != nil {
+		t.Fatalf("ApplySubscriptionChange() upgrade error = %v", err)
+	}
+	got, _ := s.users.Get(ctx, user.ID)
+	if !got.IsChirpyRed {
+		t.Errorf("after upgrade IsChirpyRed = false, want true")
+	}
+	if !webhookEventProcessed(t, s, "evt_2") {
+		t.Errorf("upgrade didn't mark the webhook event processed")
+	}
+
+	err = s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_3", Type: events.UserDowngraded, UserID: user.ID})
+	if err != nil {
+		t.Fatalf("ApplySubscriptionChange() downgrade error = %v", err)
+	}
+	got, _ = s.users.Get(ctx, user.ID)
+	if got.IsChirpyRed {
+		t.Errorf("after downgrade IsChirpyRed = true, want false")
+	}
+
+	err = s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_3", Type: events.UserDowngraded, UserID: user.ID})
+	if !errors.Is(err, ErrWebhookEventProcessed) {
+		t.Errorf("ApplySubscriptionChange() again error = %v, want ErrWebhookEventProcessed", err)
+	}
+	err = s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_2", Type: events.UserUpgraded, UserID: user.ID, Reapply: true})
+	if err != nil {
+		t.Errorf("ApplySubscriptionChange() reapply error = %v", err)
+	}
+
+	types := outbox(t, s)
+	want := []string{events.UserUpgraded, events.UserDowngraded, events.UserUpgraded}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("outbox = %v, want %v", types, want)
+	}
+}
+
+func TestCancelledSubscriptionIsNotRenewed(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	for _, id := range []string{"evt_upgrade", "evt_renew", "evt_upgrade_again"} {
+		mustCreateWebhookEvent(t, s, id)
+	}
+	err := s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_upgrade", Type: events.UserUpgraded, UserID: user.ID})
+	if err != nil {
+		t.Fatalf("ApplySubscriptionChange() upgrade error = %v", err)
+	}
+	cancelled, err := s.users.CancelSubscription(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("CancelSubscription() error = %v", err)
+	}
+
+	for _, c := range []SubscriptionChange{
+		{WebhookEventID: "evt_renew", Type: events.SubscriptionRenewed, UserID: user.ID},
+		{WebhookEventID: "evt_upgrade_again", Type: events.UserUpgraded, UserID: user.ID},
+	} {
+		err := s.users.ApplySubscriptionChange(ctx, c)
+		if err != nil {
+			t.Fatalf("ApplySubscriptionChange(%s) error = %v", c.Type, err)
+		}
+		if !webhookEventProcessed(t, s, c.WebhookEventID) {
+			t.Errorf("%s wasn't acknowledged", c.Type)
+		}
+		sub, _ := s.users.Subscription(ctx, user.ID)
+		if !sub.CancelAtPeriodEnd || !sub.CurrentPeriodEnd.Equal(cancelled.CurrentPeriodEnd) {
+			t.Errorf("after %s subscription = %+v, want still cancelled at %s", c.Type, sub, cancelled.CurrentPeriodEnd)
+		}
+	}
+	if types := outbox(t, s); len(types) != 1 {
+		t.Errorf("outbox = %v, want only the upgrade", types)
+	}
+}
+
+func TestApplySubscriptionChangeConcurrentDuplicates(t *testing.T) {
+	s := newTestServices()
+	ctx := context.Background()
+	user := mustCreateUser(t, s, "a@example.com")
+	mustCreateWebhookEvent(t, s, "evt_upgrade")
+	mustCreateWebhookEvent(t, s, "evt_renew")
+	err := s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_upgrade", Type: events.UserUpgraded, UserID: user.ID})
+	if err != nil {
+		t.Fatalf("ApplySubscriptionChange() upgrade error = %v", err)
+	}
+	before, _ := s.users.Subscription(ctx, user.ID)
+
+	// Polka retrying a renewal it timed out on, every delivery at once
+	const deliveries = 8
+	errs := make(chan error, deliveries)
+	var wg sync.WaitGroup
+	for range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.users.ApplySubscriptionChange(ctx, SubscriptionChange{WebhookEventID: "evt_renew", Type: events.SubscriptionRenewed, UserID: user.ID})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	applied := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			applied++
+		case !errors.Is(err, ErrWebhookEventProcessed):
+			t.Errorf("ApplySubscriptionChange() error = %v, want nil or ErrWebhookEventProcessed", err)
+		}
+	}
+	if applied != 1 {
+		t.Errorf("renewal applied %d times, want once", applied)
+	}
+	after, _ := s.users.Subscription(ctx, user.ID)
+	if want := before.CurrentPeriodEnd.Add(subscription.DefaultPeriod); !after.CurrentPeriodEnd.Equal(want) {
+		t.Errorf("period end = %s, want %s, one period past %s", after.CurrentPeriodEnd, want, before.CurrentPeriodEnd)
+	}
+}
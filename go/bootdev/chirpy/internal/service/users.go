@@ -0,0 +1,283 @@
+package service
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/events"
+	"chirpy/internal/subscription"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// User is a stored user plus what is derived from their subscription.
+type User struct {
+	database.User
+	IsChirpyRed bool
+}
+
+// UserService manages accounts and their Chirpy Red subscriptions.
+type UserService interface {
+	Create(ctx context.Context, email, password string) (User, error)
+	Update(ctx context.Context, id uuid.UUID, email, password string, pre Precondition[User]) (User, error)
+	Get(ctx context.Context, id uuid.UUID) (User, error)
+	DeleteAll(ctx context.Context) error
+
+	// HasFeature is the single entitlement check for Red-only perks.
+	HasFeature(ctx context.Context, userID uuid.UUID, feature subscription.Feature) (bool, error)
+	Subscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error)
+	CancelSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error)
+	ApplySubscriptionChange(ctx context.Context, c SubscriptionChange) error
+}
+
+type userService struct {
+	store  database.Store
+	hasher auth.PasswordHasher
+	policy *auth.PasswordPolicy
+}
+
+// NewUserService returns a UserService backed by store, hashing passwords with
+// hasher once they pass policy.
+func NewUserService(store database.Store, hasher auth.PasswordHasher, policy *auth.PasswordPolicy) UserService {
+	return &userService{store: store, hasher: hasher, policy: policy}
+}
+
+func (s *userService) Create(ctx context.Context, email, password string) (User, error) {
+	hp, err := s.hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	user, err := s.store.CreateUser(ctx, database.CreateUserParams{Email: email, HashedPassword: hp})
+	if err != nil {
+		return User{}, err
+	}
+	// a brand new user has no subscription yet
+	return User{User: user}, nil
+}
+
+func (s *userService) Update(ctx context.Context, id uuid.UUID, email, password string, pre Precondition[User]) (User, error) {
+	// hashing is the slow part, don't pay for it on a request that's refused
+	err := checkUpdate(ctx, s.store, id, pre)
+	if err != nil {
+		return User{}, err
+	}
+	hp, err := s.hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	var updated User
+	err = s.store.InTx(ctx, func(store database.Store) error {
+		// again, the user may have changed while we hashed
+		err := checkUpdate(ctx, store, id, pre)
+		if err != nil {
+			return err
+		}
+		user, err := store.UpdateUser(ctx, database.UpdateUserParams{ID: id, Email: email, HashedPassword: hp})
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		updated, err = withSubscription(ctx, store, user)
+		return err
+	})
+	return updated, err
+}
+
+// checkUpdate returns ErrUserNotFound or ErrPreconditionFailed if updating the
+// user would fail. In a transaction the user stays locked until it ends, so a
+// concurrent update can't pass the same precondition; outside one the lock is
+// released straight away.
+func checkUpdate(ctx context.Context, store database.Store, id uuid.UUID, pre Precondition[User]) error {
+	current, err := store.GetUserByIDForUpdate(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if pre == nil {
+		return nil
+	}
+	withSub, err := withSubscription(ctx, store, current)
+	if err != nil {
+		return err
+	}
+	if !pre.holds(withSub) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+func (s *userService) Get(ctx context.Context, id uuid.UUID) (User, error) {
+	user, err := s.store.GetUserByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return withSubscription(ctx, s.store, user)
+}
+
+func (s *userService) DeleteAll(ctx context.Context) error {
+	return s.store.DeleteAllUsers(ctx)
+}
+
+// hashPassword enforces the password policy and hashes the password.
+func (s *userService) hashPassword(password string) (string, error) {
+	err := s.policy.Validate(password)
+	if err != nil {
+		return "", &ValidationError{Msg: err.Error()}
+	}
+	return s.hasher.Hash(password)
+}
+
+func (s *userService) HasFeature(ctx context.Context, userID uuid.UUID, feature subscription.Feature) (bool, error) {
+	return hasFeature(ctx, s.store, userID, feature)
+}
+
+func (s *userService) Subscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.store.GetSubscriptionByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Subscription{}, ErrNoSubscription
+	}
+	return sub, err
+}
+
+// CancelSubscription cancels at the end of the current period, the perks stay until then.
+func (s *userService) CancelSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	sub, err := s.store.CancelSubscriptionAtPeriodEnd(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Subscription{}, ErrNoSubscription
+	}
+	return sub, err
+}
+
+// SubscriptionChange is a billing provider event to apply to a user's subscription.
+type SubscriptionChange struct {
+	// WebhookEventID is the stored inbound event, claimed in the change's
+	// transaction so concurrent deliveries of it apply once.
+	WebhookEventID string
+	// Reapply applies an event that was already processed, for admin replays.
+	Reapply bool
+	// Type is events.UserUpgraded, events.UserDowngraded or events.SubscriptionRenewed.
+	Type   string
+	UserID uuid.UUID
+	// PeriodEnd optionally overrides the computed end of the period.
+	PeriodEnd *time.Time
+}
+
+// subscriptionEventData is the payload of subscription related domain events.
+type subscriptionEventData struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Plan             string    `json:"plan"`
+	Status           string    `json:"status"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// ApplySubscriptionChange claims the inbound webhook event, updates the
+// subscription and records the matching domain event, all or nothing. A
+// subscription cancelled at period end isn't upgraded or renewed, the event is
+// acknowledged and the subscription runs out. An event
+// that's already processed, or claimed by a concurrent delivery, is
+// ErrWebhookEventProcessed.
+func (s *userService) ApplySubscriptionChange(ctx context.Context, c SubscriptionChange) error {
+	return s.store.InTx(ctx, func(store database.Store) error {
+		err := claimWebhookEvent(ctx, store, c)
+		if err != nil {
+			return err
+		}
+		_, err = store.GetUserByID(ctx, c.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		var sub database.Subscription
+		switch c.Type {
+		case events.UserUpgraded, events.SubscriptionRenewed:
+			current, err := store.GetSubscriptionByUserID(ctx, c.UserID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if current.CancelAtPeriodEnd && subscription.IsActive(current, now) {
+				// the user cancelled, the period they paid for is all they get
+				slog.Info("💸 not extending a cancelled subscription", "user_id", c.UserID, "event", c.Type)
+				return nil
+			}
+			periodEnd := now.Add(subscription.DefaultPeriod)
+			if c.Type == events.SubscriptionRenewed {
+				periodEnd = subscription.NextPeriodEnd(current, now)
+			}
+			if c.PeriodEnd != nil {
+				periodEnd = *c.PeriodEnd
+			}
+			sub, err = store.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+				UserID:           c.UserID,
+				Plan:             subscription.PlanChirpyRed,
+				CurrentPeriodEnd: periodEnd,
+			})
+		case events.UserDowngraded:
+			sub, err = store.EndSubscription(ctx, c.UserID)
+			if errors.Is(err, sql.ErrNoRows) {
+				// nothing to end, still a valid event to acknowledge
+				return nil
+			}
+		default:
+			return fmt.Errorf("unsupported subscription change %q", c.Type)
+		}
+		if err != nil {
+			return err
+		}
+		return events.Record(ctx, store, c.Type, c.UserID, subscriptionEventData{
+			UserID:           c.UserID,
+			Plan:             sub.Plan,
+			Status:           sub.Status,
+			CurrentPeriodEnd: sub.CurrentPeriodEnd,
+		})
+	})
+}
+
+// claimWebhookEvent marks c's event processed. Postgres holds the row lock
+// until the transaction ends, so a concurrent claim waits and then finds it
+// already processed.
+func claimWebhookEvent(ctx context.Context, store database.Store, c SubscriptionChange) error {
+	if c.Reapply {
+		return store.MarkWebhookEventProcessed(ctx, c.WebhookEventID)
+	}
+	_, err := store.ClaimWebhookEvent(ctx, c.WebhookEventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWebhookEventProcessed
+	}
+	return err
+}
+
+// hasFeature looks up the user's subscription and asks subscription.Entitled.
+func hasFeature(ctx context.Context, store database.Store, userID uuid.UUID, feature subscription.Feature) (bool, error) {
+	sub, err := store.GetSubscriptionByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subscription.Entitled(sub, feature, time.Now()), nil
+}
+
+// withSubscription fills in what is derived from the user's subscription.
+func withSubscription(ctx context.Context, store database.Store, user database.User) (User, error) {
+	red, err := hasFeature(ctx, store, user.ID, subscription.FeatureChirpyRed)
+	if err != nil {
+		return User{}, err
+	}
+	return User{User: user, IsChirpyRed: red}, nil
+}
@@ -0,0 +1,299 @@
+// Package static serves a fixed set of files, usually embedded, with
+// precompressed variants, content-hashed names and SPA fallback routing.
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// immutable is the Cache-Control of a content-hashed name, it can never point
+// at other bytes so it's cached for a year without revalidating.
+const immutable = "public, max-age=31536000, immutable"
+
+// encoding is a Content-Encoding the server can answer with, in order of
+// preference.
+type encoding struct {
+	name   string
+	suffix string
+}
+
+var encodings = []encoding{{name: "br", suffix: ".br"}, {name: "gzip", suffix: ".gz"}}
+
+// asset is one file and its compressed variants, keyed by Content-Encoding,
+// "" for the file as is.
+type asset struct {
+	contentType string
+	hash        string
+	variants    map[string][]byte
+}
+
+// Server serves the files of an fs.FS. Each file answers on its own name with
+// Cache-Control: no-cache, revalidated by ETag, and on its content-hashed name,
+// logo.3f2a9c1d0b.png, with Cache-Control: immutable. A path without an
+// extension that isn't a file gets index.html, so client side routes load the
+// app; anything else that isn't a file is a 404. Nothing outside the fs.FS is
+// reachable.
+//
+// HTML pages are templates with an asset function that links a file by its
+// content-hashed name, {{asset "assets/logo.png"}} is served as
+// assets/logo.3f2a9c1d0b.png, so a page picks up a changed file without any
+// cache having to expire.
+type Server struct {
+	assets map[string]*asset
+	// hashed maps content-hashed names to the name they were made from
+	hashed map[string]string
+	// paths maps names to their content-hashed names
+	paths map[string]string
+}
+
+// New reads every file in fsys. Text files are gzipped up front, a file.br or
+// file.gz next to a file is served as its brotli or gzip variant instead, except
+// for HTML pages, which are rendered. A page linking a file that doesn't exist
+// is an error.
+func New(fsys fs.FS) (*Server, error) {
+	s := &Server{assets: map[string]*asset{}, hashed: map[string]string{}, paths: map[string]string{}}
+	var pages []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isVariant(name) {
+			return err
+		}
+		// pages link other files by hash, so they wait until those are known
+		if isPage(name) {
+			pages = append(pages, name)
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return s.add(name, content, precompressed(fsys, name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range pages {
+		content, err := s.render(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		err = s.add(name, content, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := s.assets["index.html"]; !ok {
+		return nil, fmt.Errorf("static files have no index.html")
+	}
+	return s, nil
+}
+
+// add serves content as name, gzipped if that helps, alongside its
+// precompressed variants keyed by Content-Encoding.
+func (s *Server) add(name string, content []byte, variants map[string][]byte) error {
+	sum := sha256.Sum256(content)
+	a := &asset{
+		contentType: contentType(name, content),
+		hash:        hex.EncodeToString(sum[:5]),
+		variants:    map[string][]byte{"": content},
+	}
+	if compressible(a.contentType) {
+		gz, err := gzipped(content)
+		if err != nil {
+			return fmt.Errorf("gzip %s: %w", name, err)
+		}
+		if len(gz) < len(content) {
+			a.variants["gzip"] = gz
+		}
+	}
+	for enc, b := range variants {
+		a.variants[enc] = b
+	}
+	s.assets[name] = a
+	hashedName := hashName(name, a.hash)
+	s.hashed[hashedName] = name
+	s.paths[name] = hashedName
+	return nil
+}
+
+// precompressed reads the file.br and file.gz next to name, if there are any.
+func precompressed(fsys fs.FS, name string) map[string][]byte {
+	variants := map[string][]byte{}
+	for _, enc := range encodings {
+		b, err := fs.ReadFile(fsys, name+enc.suffix)
+		if err == nil {
+			variants[enc.name] = b
+		}
+	}
+	return variants
+}
+
+// render executes the page name as a template, see Server.
+func (s *Server) render(fsys fs.FS, name string) ([]byte, error) {
+	tmpl, err := template.New(path.Base(name)).Funcs(template.FuncMap{
+		"asset": func(file string) (string, error) {
+			hashedName, ok := s.Path(file)
+			if !ok {
+				return "", fmt.Errorf("no static file %s", file)
+			}
+			return hashedName, nil
+		},
+	}).ParseFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Path returns the content-hashed name of the file name, to link to it from a
+// page, and false if there's no such file.
+func (s *Server) Path(name string) (string, bool) {
+	hashedName, ok := s.paths[strings.TrimPrefix(name, "/")]
+	return hashedName, ok
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	cacheControl := "no-cache"
+	a, ok := s.assets[name]
+	if original, isHashed := s.hashed[name]; !ok && isHashed {
+		a, ok = s.assets[original], true
+		cacheControl = immutable
+	}
+	if !ok {
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		// a client side route, the app works out what to show
+		a = s.assets["index.html"]
+	}
+	encoding := negotiate(r.Header.Get("Accept-Encoding"), a.variants)
+	content := a.variants[encoding]
+	h := w.Header()
+	if len(a.variants) > 1 {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+	}
+	h.Set("Content-Type", a.contentType)
+	h.Set("Cache-Control", cacheControl)
+	// each encoding is different bytes, so it gets its own strong tag
+	etag := a.hash
+	if encoding != "" {
+		etag += "-" + encoding
+	}
+	h.Set("ETag", `"`+etag+`"`)
+	// ServeContent does HEAD, ranges and If-None-Match; embedded files have no
+	// modification time, so there's no Last-Modified
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// negotiate picks the preferred encoding the client accepts and there's a
+// variant for, "" for the file as is.
+func negotiate(acceptEncoding string, variants map[string][]byte) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+		accepted[coding] = q
+	}
+	for _, enc := range encodings {
+		if _, ok := variants[enc.name]; !ok {
+			continue
+		}
+		q, ok := accepted[enc.name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			return enc.name
+		}
+	}
+	return ""
+}
+
+// hashName puts hash before name's extension, assets/logo.png becomes
+// assets/logo.<hash>.png.
+func hashName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isPage(name string) bool {
+	return path.Ext(name) == ".html"
+}
+
+func isVariant(name string) bool {
+	for _, enc := range encodings {
+		if strings.HasSuffix(name, enc.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contentType(name string, content []byte) string {
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct == "" {
+		ct = http.DetectContentType(content)
+	}
+	return ct
+}
+
+// compressible reports whether gzip is worth it, images and fonts are already
+// compressed.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch mediaType {
+	case "application/javascript", "text/javascript", "application/json", "application/manifest+json", "image/svg+xml", "application/xml", "application/wasm":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+func gzipped(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	_, err = zw.Write(content)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
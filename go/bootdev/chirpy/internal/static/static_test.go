@@ -0,0 +1,176 @@
+package static
+
+import (
+	"chirpy/web"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServer(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("<h1>Welcome to Chirpy</h1>", 20) + "</body></html>"
+	s, err := New(fstest.MapFS{
+		"index.html":         {Data: []byte(page)},
+		"assets/app.js":      {Data: []byte(strings.Repeat("console.log('chirp');", 20))},
+		"assets/app.js.br":   {Data: []byte("pretend brotli")},
+		"assets/logo.png":    {Data: []byte("\x89PNG\r\n\x1a\n not really")},
+		"assets/tiny.css":    {Data: []byte("a{}")},
+		"assets/manual.json": {Data: []byte(`{"ok":true}`)},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	logo, ok := s.Path("/assets/logo.png")
+	if !ok || !strings.HasPrefix(logo, "assets/logo.") || !strings.HasSuffix(logo, ".png") || logo == "assets/logo.png" {
+		t.Fatalf("Path(assets/logo.png) = %q, %v, want a content-hashed name", logo, ok)
+	}
+	if _, ok := s.Path("assets/missing.png"); ok {
+		t.Errorf("Path(assets/missing.png) found a file")
+	}
+
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		wantStatus       int
+		wantBody         string
+		wantContentType  string
+		wantEncoding     string
+		wantCacheControl string
+	}{
+		{name: "Index", path: "/", wantStatus: http.StatusOK, wantBody: page, wantContentType: "text/html; charset=utf-8", wantCacheControl: "no-cache"},
+		{name: "Index gzipped", path: "/index.html", acceptEncoding: "gzip, deflate", wantStatus: http.StatusOK, wantBody: page, wantEncoding: "gzip", wantCacheControl: "no-cache"},
+		{name: "Precompressed brotli preferred", path: "/assets/app.js", acceptEncoding: "gzip, br", wantStatus: http.StatusOK, wantBody: "pretend brotli", wantEncoding: "br"},
+		{name: "Brotli refused", path: "/assets/app.js", acceptEncoding: "br;q=0, *", wantStatus: http.StatusOK, wantBody: strings.Repeat("console.log('chirp');", 20), wantEncoding: "gzip"},
+		{name: "Images aren't gzipped", path: "/assets/logo.png", acceptEncoding: "gzip", wantStatus: http.StatusOK, wantContentType: "image/png"},
+		{name: "Gzip that doesn't help isn't used", path: "/assets/tiny.css", acceptEncoding: "gzip", wantStatus: http.StatusOK, wantBody: "a{}"},
+		{name: "Content-hashed name is immutable", path: "/" + logo, wantStatus: http.StatusOK, wantContentType: "image/png", wantCacheControl: immutable},
+		{name: "Client side route", path: "/chirps/1234", wantStatus: http.StatusOK, wantBody: page, wantCacheControl: "no-cache"},
+		{name: "Missing file", path: "/assets/missing.png", wantStatus: http.StatusNotFound},
+		{name: "Traversal", path: "/../go.mod", wantStatus: http.StatusNotFound},
+		{name: "Dotfile", path: "/.env", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = tt.path
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			h := rec.Header()
+			if got := h.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if tt.wantContentType != "" && h.Get("Content-Type") != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", h.Get("Content-Type"), tt.wantContentType)
+			}
+			if tt.wantCacheControl != "" && h.Get("Cache-Control") != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", h.Get("Cache-Control"), tt.wantCacheControl)
+			}
+			body := rec.Body.String()
+			if tt.wantEncoding == "gzip" {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				b, _ := io.ReadAll(zr)
+				body = string(b)
+			}
+			if tt.wantBody != "" && body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestServerRevalidation(t *testing.T) {
+	s, err := New(fstest.MapFS{"index.html": {Data: []byte(strings.Repeat("<p>chirp</p>", 20))}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec
+	}
+	plain, gzipped := get("", "").Header().Get("ETag"), get("gzip", "").Header().Get("ETag")
+	if plain == "" || plain == gzipped {
+		t.Fatalf("ETags = %q and %q, want one per encoding", plain, gzipped)
+	}
+	if rec := get("gzip", gzipped); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match with the gzip ETag = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+	if rec := get("", gzipped); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match with another encoding's ETag = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if vary := get("", "").Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("Vary = %q, want Accept-Encoding", vary)
+	}
+}
+
+func TestPagesLinkHashedNames(t *testing.T) {
+	s, err := New(fstest.MapFS{
+		"index.html":      {Data: []byte(`<img src="{{asset "assets/logo.png"}}">`)},
+		"index.html.br":   {Data: []byte("stale brotli of the template")},
+		"assets/logo.png": {Data: []byte("\x89PNG\r\n\x1a\n not really")},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	logo, _ := s.Path("assets/logo.png")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if want := `<img src="` + logo + `">`; rec.Body.String() != want {
+		t.Errorf("index.html = %q, want %q", rec.Body.String(), want)
+	}
+
+	_, err = New(fstest.MapFS{"index.html": {Data: []byte(`<img src="{{asset "assets/missing.png"}}">`)}})
+	if err == nil || !strings.Contains(err.Error(), "assets/missing.png") {
+		t.Errorf("New() with a page linking a missing file error = %v, want it to name the file", err)
+	}
+}
+
+func TestNewRequiresIndex(t *testing.T) {
+	_, err := New(fstest.MapFS{"assets/logo.png": {Data: []byte("png")}})
+	if err == nil {
+		t.Errorf("New() without index.html error = nil, want an error")
+	}
+}
+
+func TestEmbeddedAppFiles(t *testing.T) {
+	s, err := New(web.FS)
+	if err != nil {
+		t.Fatalf("New(web.FS) error = %v", err)
+	}
+	for _, name := range []string{"index.html", "assets/logo.png"} {
+		if _, ok := s.Path(name); !ok {
+			t.Errorf("embedded app files have no %s", name)
+		}
+	}
+	if _, ok := s.Path("web.go"); ok {
+		t.Errorf("embedded app files include web.go")
+	}
+	logo, _ := s.Path("assets/logo.png")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), `src="`+logo+`"`) {
+		t.Errorf("index.html doesn't link %s:\n%s", logo, rec.Body.String())
+	}
+}
@@ -0,0 +1,94 @@
+// Package subscription holds the Chirpy Red subscription rules: which plans
+// grant which perks, when a subscription counts as active, and the background
+// job that expires lapsed subscriptions.
+package subscription
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"context"
+	"log/slog"
+	"time"
+)
+
+const PlanChirpyRed = "chirpy_red"
+
+const (
+	StatusActive   = "active"
+	StatusCanceled = "canceled"
+	StatusExpired  = "expired"
+)
+
+// DefaultPeriod is how long a period lasts when the provider doesn't tell us.
+const DefaultPeriod = 30 * 24 * time.Hour
+
+// LegacyPeriodEnd is the period end of the Red memberships granted before
+// subscriptions existed, see migration 006. They were never billed, so they
+// don't lapse until a downgrade or a renewal puts them on a billed period.
+var LegacyPeriodEnd = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Feature is a perk that a plan can grant.
+type Feature string
+
+const (
+	// FeatureChirpyRed is the Red membership itself, surfaced as is_chirpy_red.
+	FeatureChirpyRed Feature = "chirpy_red"
+)
+
+// planFeatures lists the perks each plan grants.
+var planFeatures = map[string][]Feature{
+	PlanChirpyRed: {FeatureChirpyRed},
+}
+
+// IsActive reports whether the subscription is in good standing at now. A
+// subscription cancelled at period end stays active until the period is over.
+func IsActive(sub database.Subscription, now time.Time) bool {
+	return sub.Status == StatusActive && sub.CurrentPeriodEnd.After(now)
+}
+
+// Entitled reports whether the subscription grants feature at now. This is the
+// one place perks are checked, handlers should not look at plan or status directly.
+func Entitled(sub database.Subscription, feature Feature, now time.Time) bool {
+	if !IsActive(sub, now) {
+		return false
+	}
+	for _, f := range planFeatures[sub.Plan] {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// NextPeriodEnd returns the end of the period following a renewal at now. Renewing
+// early extends from the current period end, so no paid time is lost. A legacy
+// membership's first renewal starts its first billed period.
+func NextPeriodEnd(sub database.Subscription, now time.Time) time.Time {
+	if IsActive(sub, now) && !sub.CurrentPeriodEnd.Equal(LegacyPeriodEnd) {
+		return sub.CurrentPeriodEnd.Add(DefaultPeriod)
+	}
+	return now.Add(DefaultPeriod)
+}
+
+// RunExpirer marks lapsed subscriptions as expired every interval until ctx is
+// done, beating hb after every pass that succeeds. hb may be nil.
+func RunExpirer(ctx context.Context, q database.Store, interval time.Duration, hb *health.Heartbeat) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := q.ExpireLapsedSubscriptions(ctx)
+		if err != nil {
+			slog.Error("ExpireLapsedSubscriptions failed", "error", err)
+		} else {
+			if n > 0 {
+				slog.Info("💸 expired lapsed subscriptions", "count", n)
+			}
+			hb.Beat()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
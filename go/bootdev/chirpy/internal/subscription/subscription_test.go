@@ -0,0 +1,75 @@
+package subscription
+
+import (
+	"chirpy/internal/database"
+	"testing"
+	"time"
+)
+
+func TestEntitled(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		sub  database.Subscription
+		want bool
+	}{
+		{
+			name: "Active Red subscription",
+			sub:  database.Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(time.Hour)},
+			want: true,
+		},
+		{
+			name: "Cancelled at period end but period not over",
+			sub:  database.Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(time.Hour), CancelAtPeriodEnd: true},
+			want: true,
+		},
+		{
+			name: "Active status but period already lapsed",
+			sub:  database.Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(-time.Hour)},
+			want: false,
+		},
+		{
+			name: "Expired subscription",
+			sub:  database.Subscription{Plan: PlanChirpyRed, Status: StatusExpired, CurrentPeriodEnd: now.Add(time.Hour)},
+			want: false,
+		},
+		{
+			name: "Canceled subscription",
+			sub:  database.Subscription{Plan: PlanChirpyRed, Status: StatusCanceled, CurrentPeriodEnd: now.Add(time.Hour)},
+			want: false,
+		},
+		{
+			name: "Unknown plan grants nothing",
+			sub:  database.Subscription{Plan: "chirpy_blue", Status: StatusActive, CurrentPeriodEnd: now.Add(time.Hour)},
+			want: false,
+		},
+		{
+			name: "No subscription",
+			sub:  database.Subscription{},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Entitled(tt.sub, FeatureChirpyRed, now); got != tt.want {
+				t.Errorf("Entitled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextPeriodEnd(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	active := database.Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: now.Add(24 * time.Hour)}
+	if got, want := NextPeriodEnd(active, now), now.Add(24*time.Hour+DefaultPeriod); !got.Equal(want) {
+		t.Errorf("NextPeriodEnd(active) = %v, want %v", got, want)
+	}
+	expired := database.Subscription{Plan: PlanChirpyRed, Status: StatusExpired, CurrentPeriodEnd: now.Add(-24 * time.Hour)}
+	if got, want := NextPeriodEnd(expired, now), now.Add(DefaultPeriod); !got.Equal(want) {
+		t.Errorf("NextPeriodEnd(expired) = %v, want %v", got, want)
+	}
+	legacy := database.Subscription{Plan: PlanChirpyRed, Status: StatusActive, CurrentPeriodEnd: LegacyPeriodEnd}
+	if got, want := NextPeriodEnd(legacy, now), now.Add(DefaultPeriod); !got.Equal(want) {
+		t.Errorf("NextPeriodEnd(legacy) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+// Package tracing sets up OpenTelemetry. Spans go to a local file, an OTLP
+// collector or nowhere, and W3C traceparent headers are read on the way in and
+// sent on the way out, so chirpy's spans join the caller's trace.
+package tracing
+
+import (
+	"chirpy/internal/httpx"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Where spans are exported to.
+const (
+	ExporterNone = "none"
+	ExporterFile = "file"
+	ExporterOTLP = "otlp"
+)
+
+// TracerName is the instrumentation scope of chirpy's spans.
+const TracerName = "chirpy"
+
+// Tracer is chirpy's tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Options says where Setup sends spans.
+type Options struct {
+	// Exporter is ExporterNone, ExporterFile or ExporterOTLP.
+	Exporter string
+	// File is where ExporterFile appends spans, one JSON object per line.
+	File string
+	// OTLPEndpoint is the collector's base URL, e.g. http://localhost:4318.
+	// Empty leaves it to the standard OTEL_EXPORTER_OTLP_* variables.
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+// Setup installs the global tracer provider and the W3C propagator. The
+// propagator is installed even with ExporterNone so traceparent still passes
+// through to webhooks. Call shutdown before exiting to flush buffered spans.
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+	switch opts.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterFile:
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening trace file: %w", err)
+		}
+		closeFile = f.Close
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.OTLPEndpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, want %s, %s or %s", opts.Exporter, ExporterNone, ExporterFile, ExporterOTLP)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), closeFile())
+	}, nil
+}
+
+// Middleware starts a server span for every request, continuing the trace in
+// its traceparent header if there is one. The span is named after the route
+// once the mux has matched it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		r = httpx.Track(r.WithContext(ctx))
+		rec := httpx.NewRecorder(w)
+		next.ServeHTTP(rec, r)
+		route := httpx.Route(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", rec.Status),
+		)
+		if rec.Status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status))
+		}
+	})
+}
+
+// Transport wraps base so every outbound request gets a client span and a
+// traceparent header. A nil base is http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Tracer().Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			// webhook URLs can carry credentials in the query, leave it out
+			attribute.String("url.full", (&url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}).String()),
+		),
+	)
+	defer span.End()
+	// RoundTrippers mustn't modify the caller's request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	parentTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID      = "00f067aa0ba902b7"
+	parentTraceparent = "00-" + parentTraceID + "-" + parentSpanID + "-01"
+)
+
+// recordSpans points the global provider at a recorder for the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	prev, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return sr
+}
+
+func attr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		path        string
+		wantName    string
+		wantStatus  int64
+	}{
+		{name: "Continues the caller's trace", traceparent: parentTraceparent, path: "/api/chirps/42", wantName: "GET /api/chirps/{chirpID}", wantStatus: 200},
+		{name: "Starts a trace", path: "/api/chirps/42", wantName: "GET /api/chirps/{chirpID}", wantStatus: 200},
+		{name: "Unmatched route", path: "/nope", wantName: "GET unmatched", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := recordSpans(t)
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+				if !trace.SpanContextFromContext(r.Context()).IsValid() {
+					t.Errorf("handler context has no span")
+				}
+			})
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			Middleware(mux).ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := sr.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName || span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("span = %q %v, want %q server", span.Name(), span.SpanKind(), tt.wantName)
+			}
+			if got := attr(span, "http.response.status_code").AsInt64(); got != tt.wantStatus {
+				t.Errorf("status code attribute = %d, want %d", got, tt.wantStatus)
+			}
+			continued := span.SpanContext().TraceID().String() == parentTraceID && span.Parent().SpanID().String() == parentSpanID
+			if continued != (tt.traceparent != "") {
+				t.Errorf("span trace %s parent %s, continued = %v, want %v", span.SpanContext().TraceID(), span.Parent().SpanID(), continued, tt.traceparent != "")
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	sr := recordSpans(t)
+	var gotTraceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	ctx, parent := Tracer().Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/hook?token=secret", nil)
+	client := &http.Client{Transport: Transport(nil)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Errorf("Transport modified the caller's request")
+	}
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the client span and its parent", len(spans))
+	}
+	clientSpan := spans[0]
+	if clientSpan.SpanKind() != trace.SpanKindClient || clientSpan.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("client span = %+v, want a client span under the parent", clientSpan)
+	}
+	want := "00-" + clientSpan.SpanContext().TraceID().String() + "-" + clientSpan.SpanContext().SpanID().String() + "-01"
+	if gotTraceparent != want {
+		t.Errorf("server got traceparent %q, want %q", gotTraceparent, want)
+	}
+	if got := attr(clientSpan, "url.full").AsString(); strings.Contains(got, "secret") {
+		t.Errorf("url.full = %q, want the query left out", got)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	prev, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), Options{Exporter: ExporterFile, File: file, ServiceName: "chirpy-test"})
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "test-span")
+	span.End()
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	for _, want := range []string{`"Name":"test-span"`, `"Value":"chirpy-test"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("trace file is missing %s:\n%s", want, b)
+		}
+	}
+
+	_, err = Setup(context.Background(), Options{Exporter: "jaeger"})
+	if err == nil {
+		t.Errorf("Setup() with an unknown exporter error = nil, want an error")
+	}
+}
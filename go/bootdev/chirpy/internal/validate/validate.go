@@ -0,0 +1,149 @@
+// Package validate checks request structs against rules declared in their
+// `validate` struct tags, e.g.
+//
+//	Email string `json:"email" validate:"required,email,max=254"`
+//
+// Rules are comma separated: required, email, url (absolute http or https),
+// min=N and max=N (characters for strings, items for slices). Fields are
+// reported by their JSON name.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is one rule a field broke. Rule is the rule's name, stable for
+// clients to switch on.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Struct checks every tagged field of v, a struct or a pointer to one, and
+// returns one FieldError per failing field, nil if it's valid. Only the first
+// rule a field breaks is reported. A malformed tag is a programming error and
+// panics.
+func Struct(v any) []FieldError {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: Struct wants a struct, got %T", v))
+	}
+	var errs []FieldError
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		f := rt.Field(i)
+		tag, ok := f.Tag.Lookup("validate")
+		if !ok || !f.IsExported() {
+			continue
+		}
+		name := fieldName(f)
+		for _, rule := range strings.Split(tag, ",") {
+			msg := check(rt.Name()+"."+f.Name, rv.Field(i), rule)
+			if msg != "" {
+				ruleName, _, _ := strings.Cut(rule, "=")
+				errs = append(errs, FieldError{Field: name, Rule: ruleName, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// check applies one rule to a field and returns why it failed, "" if it passed.
+// Rules other than required pass on an empty value, so optional fields only
+// get checked when they're set.
+func check(field string, v reflect.Value, rule string) string {
+	name, arg, hasArg := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if isEmpty(v) {
+			return "is required"
+		}
+		return ""
+	case "min", "max":
+		if !hasArg {
+			panic(fmt.Sprintf("validate: %s: %s needs a value", field, name))
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s: bad %s value %q", field, name, arg))
+		}
+		size, unit := length(field, v)
+		if name == "min" && size > 0 && size < n {
+			return fmt.Sprintf("must be at least %d %s", n, unit)
+		}
+		if name == "max" && size > n {
+			return fmt.Sprintf("must be at most %d %s", n, unit)
+		}
+		return ""
+	case "email":
+		s := str(field, v)
+		if s == "" {
+			return ""
+		}
+		// ParseAddress also takes "Name <a@b.c>", we want the bare address
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+		return ""
+	case "url":
+		s := str(field, v)
+		if s == "" {
+			return ""
+		}
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be an absolute http(s) URL"
+		}
+		return ""
+	}
+	panic(fmt.Sprintf("validate: %s: unknown rule %q", field, rule))
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func length(field string, v reflect.Value) (int, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), "characters"
+	case reflect.Slice, reflect.Map:
+		return v.Len(), "items"
+	}
+	panic(fmt.Sprintf("validate: %s: min and max need a string, slice or map, got %s", field, v.Kind()))
+}
+
+func str(field string, v reflect.Value) string {
+	if v.Kind() != reflect.String {
+		panic(fmt.Sprintf("validate: %s: rule needs a string, got %s", field, v.Kind()))
+	}
+	return v.String()
+}
+
+// fieldName is the name the client knows the field by, its JSON key.
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
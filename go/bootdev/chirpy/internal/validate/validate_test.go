@@ -0,0 +1,94 @@
+package validate
+
+import (
+	"reflect"
+	"testing"
+)
+
+type signup struct {
+	Email    string   `json:"email" validate:"required,email,max=20"`
+	Password string   `json:"password" validate:"required,min=8"`
+	Website  string   `json:"website,omitempty" validate:"url"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Note     string   `json:"note"`
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name string
+		v    signup
+		want []FieldError
+	}{
+		{
+			name: "Valid",
+			v:    signup{Email: "a@example.com", Password: "correct horse", Website: "https://example.com", Tags: []string{"a"}},
+		},
+		{
+			name: "Missing required fields",
+			v:    signup{Email: "  "},
+			want: []FieldError{
+				{Field: "email", Rule: "required", Message: "is required"},
+				{Field: "password", Rule: "required", Message: "is required"},
+			},
+		},
+		{
+			name: "Only the first broken rule is reported",
+			v:    signup{Email: "not an email at all, and too long", Password: "correct horse"},
+			want: []FieldError{{Field: "email", Rule: "email", Message: "must be a valid email address"}},
+		},
+		{
+			name: "Display names aren't addresses",
+			v:    signup{Email: "A <a@example.com>", Password: "correct horse"},
+			want: []FieldError{{Field: "email", Rule: "email", Message: "must be a valid email address"}},
+		},
+		{
+			name: "Lengths",
+			v:    signup{Email: "a@example.com", Password: "short", Tags: []string{"a", "b", "c"}},
+			want: []FieldError{
+				{Field: "password", Rule: "min", Message: "must be at least 8 characters"},
+				{Field: "tags", Rule: "max", Message: "must be at most 2 items"},
+			},
+		},
+		{
+			name: "Relative URL",
+			v:    signup{Email: "a@example.com", Password: "correct horse", Website: "/home"},
+			want: []FieldError{{Field: "website", Rule: "url", Message: "must be an absolute http(s) URL"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Struct(&tt.v)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStructPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{name: "Not a struct", v: "hello"},
+		{name: "Unknown rule", v: struct {
+			A string `validate:"uppercase"`
+		}{}},
+		{name: "Bad bound", v: struct {
+			A string `validate:"max=many"`
+		}{A: "x"}},
+		{name: "Email on a slice", v: struct {
+			A []string `validate:"email"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Struct() didn't panic")
+				}
+			}()
+			Struct(tt.v)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"bytes"
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"chirpy/internal/tracing"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Delivery statuses stored in webhook_deliveries.status.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Headers set on every outbound delivery.
+const (
+	HeaderEvent     = "X-Chirpy-Event"
+	HeaderDelivery  = "X-Chirpy-Delivery"
+	HeaderSignature = "X-Chirpy-Signature"
+)
+
+// Dispatcher sends pending deliveries from the outbox, retrying failures with
+// exponential backoff until MaxAttempts is reached.
+type Dispatcher struct {
+	queries     database.Store
+	client      *http.Client
+	Interval    time.Duration
+	BatchSize   int32
+	MaxAttempts int32
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed batch is held before another instance may
+	// claim it, it must outlast sending a whole batch. Deliveries held by an
+	// instance that died are retried once it runs out.
+	Lease time.Duration
+	// Heartbeat, if set, beats after every pass that succeeds, so a worker
+	// that keeps failing turns readiness stale.
+	Heartbeat *health.Heartbeat
+}
+
+// NewDispatcher returns a Dispatcher with sensible defaults: ~8 attempts spread
+// over roughly a day. It only connects to public addresses, see
+// ErrForbiddenTarget, and doesn't follow redirects.
+func NewDispatcher(q database.Store) *Dispatcher {
+	return &Dispatcher{
+		queries: q,
+		client: newClient(func(addr netip.AddrPort) error {
+			return checkAddr(addr.Addr())
+		}),
+		Interval:    5 * time.Second,
+		BatchSize:   50,
+		MaxAttempts: 8,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  6 * time.Hour,
+		// 50 sends at the client's 10s timeout, with room to spare
+		Lease: 15 * time.Minute,
+	}
+}
+
+// Run delivers due deliveries every Interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		err := d.DeliverDue(ctx)
+		if err != nil {
+			slog.Error("webhook dispatch failed", "error", err)
+		} else {
+			d.Heartbeat.Beat()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes one pass over the deliveries that are due. They're claimed
+// first, so instances running side by side never send the same delivery.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	due, err := d.queries.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		LeaseUntil: time.Now().Add(d.Lease),
+		BatchSize:  d.BatchSize,
+	})
+	if err != nil {
+		return err
+	}
+	for _, delivery := range due {
+		d.deliver(ctx, delivery)
+	}
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) {
+	// each delivery is its own trace, the send and bookkeeping queries in it
+	ctx, span := tracing.Tracer().Start(ctx, "webhook.deliver", trace.WithAttributes(
+		attribute.String("webhook.delivery_id", delivery.ID.String()),
+		attribute.String("webhook.event_type", delivery.EventType),
+		attribute.Int("webhook.attempt", int(delivery.Attempts)+1),
+	))
+	defer span.End()
+	statusCode, err := d.send(ctx, delivery)
+	code := sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0}
+	if err == nil {
+		err = d.queries.MarkWebhookDeliverySucceeded(ctx, database.MarkWebhookDeliverySucceededParams{
+			ID:             delivery.ID,
+			LastStatusCode: code,
+		})
+		if err != nil {
+			slog.Error("MarkWebhookDeliverySucceeded failed", "delivery_id", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	attempt := delivery.Attempts + 1
+	status := DeliveryPending
+	if attempt >= d.MaxAttempts {
+		status = DeliveryFailed
+	}
+	span.SetStatus(codes.Error, err.Error())
+	slog.Warn("webhook delivery failed", "delivery_id", delivery.ID, "attempt", attempt, "status", status, "error", err)
+	// the owner sees the category, not err, see failureCategory
+	err = d.queries.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		ID:             delivery.ID,
+		Status:         status,
+		NextAttemptAt:  time.Now().Add(Backoff(attempt, d.BaseBackoff, d.MaxBackoff)),
+		LastStatusCode: code,
+		LastError:      sql.NullString{String: failureCategory(err), Valid: true},
+	})
+	if err != nil {
+		slog.Error("MarkWebhookDeliveryFailed failed", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+// send POSTs the payload, any 2xx counts as delivered.
+func (d *Dispatcher) send(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "chirpy-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderSignature, SignatureHeader(delivery.Secret, time.Now(), body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w %d", errUnexpectedStatus, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff returns the delay before the attempt after the given one: base,
+// 2*base, 4*base, ... capped at max.
+func Backoff(attempt int32, base, max time.Duration) time.Duration {
+	delay := base
+	for i := int32(1); i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/database/memstore"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int32
+		want    time.Duration
+	}{
+		{name: "First retry waits the base delay", attempt: 1, want: 30 * time.Second},
+		{name: "Second retry doubles", attempt: 2, want: time.Minute},
+		{name: "Fourth retry", attempt: 4, want: 4 * time.Minute},
+		{name: "Capped at max", attempt: 20, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Backoff(tt.attempt, 30*time.Second, time.Hour); got != tt.want {
+				t.Errorf("Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// queueDelivery registers a webhook at target with one due delivery.
+func queueDelivery(t *testing.T, store database.Store, target string) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	sub, err := store.CreateWebhookSubscription(ctx, database.CreateWebhookSubscriptionParams{Url: target, EventTypes: EventChirpCreated, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("CreateWebhookSubscription() error = %v", err)
+	}
+	err = store.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{SubscriptionID: sub.ID, EventID: uuid.New(), EventType: EventChirpCreated, Payload: "{}"})
+	if err != nil {
+		t.Fatalf("CreateWebhookDelivery() error = %v", err)
+	}
+	return sub.ID
+}
+
+func lastDelivery(t *testing.T, store database.Store, subID uuid.UUID) database.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), database.ListWebhookDeliveriesParams{SubscriptionID: subID, Limit: 1})
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("ListWebhookDeliveries() = %+v, %v, want one delivery", deliveries, err)
+	}
+	return deliveries[0]
+}
+
+// countingServer counts the requests it gets, answering them with h.
+func countingServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestDispatcherRefusesInternalTargets(t *testing.T) {
+	srv, hits := countingServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	targets := []string{
+		srv.URL,
+		"http://127.0.0.1:1/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:1/hook",
+	}
+	for _, target := range targets {
+		t.Run(target, func(t *testing.T) {
+			store := memstore.New()
+			subID := queueDelivery(t, store, target)
+			err := NewDispatcher(store).DeliverDue(context.Background())
+			if err != nil {
+				t.Fatalf("DeliverDue() error = %v", err)
+			}
+			got := lastDelivery(t, store, subID)
+			if got.Status != DeliveryPending || got.LastError.String != FailureForbiddenTarget || got.LastStatusCode.Valid {
+				t.Errorf("delivery = %s, %q, %v, want pending after a forbidden_target failure and no status", got.Status, got.LastError.String, got.LastStatusCode)
+			}
+		})
+	}
+	if hits.Load() != 0 {
+		t.Errorf("loopback server got %d requests, want none", hits.Load())
+	}
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	internal, internalHits := countingServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	origin, _ := countingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	})
+	// origin stands in for a public host, it's the only address allowed
+	originAddr := netip.MustParseAddrPort(origin.Listener.Addr().String())
+	store := memstore.New()
+	subID := queueDelivery(t, store, origin.URL)
+	d := NewDispatcher(store)
+	d.client = newClient(func(addr netip.AddrPort) error {
+		if addr != originAddr {
+			return ErrForbiddenTarget
+		}
+		return nil
+	})
+	err := d.DeliverDue(context.Background())
+	if err != nil {
+		t.Fatalf("DeliverDue() error = %v", err)
+	}
+	got := lastDelivery(t, store, subID)
+	if got.LastStatusCode.Int32 != http.StatusFound || got.LastError.String != FailureUnexpectedStatus {
+		t.Errorf("delivery = %v, %q, want the 302 as an unexpected_status failure", got.LastStatusCode, got.LastError.String)
+	}
+	if internalHits.Load() != 0 {
+		t.Errorf("redirect target got %d requests, want none", internalHits.Load())
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	resolver := StaticResolver{
+		"example.com":          {netip.MustParseAddr("93.184.215.14")},
+		"internal.example.com": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.5")},
+	}
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "https://example.com/hook"},
+		{url: "http://93.184.215.14/hook"},
+		{url: "http://127.0.0.1/hook", wantErr: ErrForbiddenTarget},
+		{url: "http://169.254.169.254/latest/meta-data/", wantErr: ErrForbiddenTarget},
+		{url: "http://192.168.1.1/hook", wantErr: ErrForbiddenTarget},
+		{url: "http://[::1]/hook", wantErr: ErrForbiddenTarget},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: ErrForbiddenTarget},
+		{url: "http://0.0.0.0/hook", wantErr: ErrForbiddenTarget},
+		{url: "http://224.0.0.1/hook", wantErr: ErrForbiddenTarget},
+		{url: "https://internal.example.com/hook", wantErr: ErrForbiddenTarget},
+	}
+	for _, tt := range tests {
+		err := CheckTarget(context.Background(), tt.url, resolver)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("CheckTarget(%q) error = %v, want %v", tt.url, err, tt.wantErr)
+		}
+	}
+	var dnsErr *net.DNSError
+	if err := CheckTarget(context.Background(), "https://nowhere.example.com", resolver); !errors.As(err, &dnsErr) {
+		t.Errorf("CheckTarget() of an unknown host error = %v, want a *net.DNSError", err)
+	}
+}
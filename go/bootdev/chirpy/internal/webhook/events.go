@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/events"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outbound event types integrators can subscribe to, a subset of the domain events.
+const (
+	EventChirpCreated = events.ChirpCreated
+	EventChirpDeleted = events.ChirpDeleted
+	EventUserUpgraded = events.UserUpgraded
+)
+
+// EventTypes lists every outbound event type.
+var EventTypes = []string{EventChirpCreated, EventChirpDeleted, EventUserUpgraded}
+
+// IsEventType reports whether t is a known outbound event type.
+func IsEventType(t string) bool {
+	return slices.Contains(EventTypes, t)
+}
+
+// Event is the envelope every outbound delivery carries as its body.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// JoinEventTypes and SplitEventTypes convert to and from the comma separated
+// event_types column.
+func JoinEventTypes(types []string) string {
+	return strings.Join(types, ",")
+}
+
+func SplitEventTypes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// Subscriber returns an events.Handler that fans domain events out to matching
+// webhook subscriptions. Deliveries are unique per subscription and event, so
+// the relay publishing an event twice doesn't send it twice.
+func Subscriber(q database.Store) events.Handler {
+	return func(ctx context.Context, e events.Event) error {
+		if !IsEventType(e.Type) {
+			return nil
+		}
+		return Enqueue(ctx, q, e.ActorID, Event{
+			ID:        e.ID,
+			Type:      e.Type,
+			CreatedAt: e.OccurredAt,
+			Data:      e.Payload,
+		})
+	}
+}
+
+// Enqueue writes one pending delivery per matching subscription to the
+// webhook_deliveries outbox, the Dispatcher sends them later. Admin
+// subscriptions match every actor, user subscriptions only their own events.
+func Enqueue(ctx context.Context, q database.Store, actorID uuid.UUID, event Event) error {
+	subs, err := q.ListWebhookSubscriptionsForEvent(ctx, database.ListWebhookSubscriptionsForEventParams{
+		ActorID:   uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		EventType: event.Type,
+	})
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		err := q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
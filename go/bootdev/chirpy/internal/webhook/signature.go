@@ -0,0 +1,77 @@
+// Package webhook signs and verifies webhook payloads.
+//
+// Signatures use the header format "t=<unix seconds>,v1=<hex HMAC-SHA256>",
+// where the HMAC is computed over "<unix seconds>.<raw body>". Binding the
+// timestamp into the MAC lets receivers reject replayed requests.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingSignature = errors.New("missing webhook signature")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleSignature   = errors.New("webhook timestamp outside tolerance")
+)
+
+// Sign returns the hex HMAC-SHA256 of the timestamp and body.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignatureHeader returns the full signature header value for body signed at timestamp.
+func SignatureHeader(secret string, timestamp time.Time, body []byte) string {
+	return "t=" + strconv.FormatInt(timestamp.Unix(), 10) + ",v1=" + Sign(secret, timestamp, body)
+}
+
+// VerifySignature checks a signature header against body. The timestamp must be
+// within tolerance of now, in either direction. Several v1 values may be present
+// while a secret is being rotated; any one of them matching is enough.
+func VerifySignature(header string, body []byte, secret string, tolerance time.Duration, now time.Time) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidSignature
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = ts
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if now.Sub(signedAt).Abs() > tolerance {
+		return ErrStaleSignature
+	}
+	expected := []byte(Sign(secret, signedAt, body))
+	for _, sig := range signatures {
+		if hmac.Equal(expected, []byte(sig)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
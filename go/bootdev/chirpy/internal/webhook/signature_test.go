@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := "polka-secret"
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	now := time.Unix(1_700_000_000, 0)
+	valid := SignatureHeader(secret, now, body)
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		secret  string
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:    "Valid signature",
+			header:  valid,
+			body:    body,
+			secret:  secret,
+			now:     now.Add(time.Minute),
+			wantErr: nil,
+		},
+		{
+			name:    "Rotated secret, one of several signatures matches",
+			header:  "t=1700000000,v1=deadbeef,v1=" + Sign(secret, now, body),
+			body:    body,
+			secret:  secret,
+			now:     now,
+			wantErr: nil,
+		},
+		{
+			name:    "Missing header",
+			header:  "",
+			body:    body,
+			secret:  secret,
+			now:     now,
+			wantErr: ErrMissingSignature,
+		},
+		{
+			name:    "Wrong secret",
+			header:  valid,
+			body:    body,
+			secret:  "other-secret",
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			header:  valid,
+			body:    []byte(`{"id":"evt_1","event":"user.downgraded"}`),
+			secret:  secret,
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Timestamp too old",
+			header:  valid,
+			body:    body,
+			secret:  secret,
+			now:     now.Add(10 * time.Minute),
+			wantErr: ErrStaleSignature,
+		},
+		{
+			name:    "Malformed header",
+			header:  "v1",
+			body:    body,
+			secret:  secret,
+			now:     now,
+			wantErr: ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotErr := VerifySignature(tt.header, tt.body, tt.secret, 5*time.Minute, tt.now)
+			if !errors.Is(gotErr, tt.wantErr) {
+				t.Errorf("VerifySignature() error = %v, want %v", gotErr, tt.wantErr)
+			}
+		})
+	}
+}
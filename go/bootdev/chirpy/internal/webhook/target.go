@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"chirpy/internal/tracing"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is a webhook URL that resolves to an address inside the
+// network: loopback, private, link-local (cloud metadata lives at
+// 169.254.169.254), multicast or unspecified. Users pick webhook URLs, so
+// without this they could make chirpy probe its own network for them.
+var ErrForbiddenTarget = errors.New("webhook URL must resolve to a public address")
+
+// Resolver looks up a host's addresses, *net.Resolver is one.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// StaticResolver resolves the hosts it has and nothing else, for tests and
+// pinned hosts.
+type StaticResolver map[string][]netip.Addr
+
+func (r StaticResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+// CheckTarget resolves rawURL's host with resolver, net.DefaultResolver if
+// nil, and returns ErrForbiddenTarget unless every address it resolves to is
+// public. It's checked at registration for a useful error; the dispatcher
+// checks again at dial time, as the host can resolve elsewhere by then.
+func CheckTarget(ctx context.Context, rawURL string, resolver Resolver) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return checkAddr(addr)
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		err := checkAddr(addr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
+
+// newClient is the http.Client deliveries go out on. Every connection it dials
+// has its address checked by allow after DNS resolution, so a host that
+// resolved to a public address at registration can't be rebound to an internal
+// one. Redirects aren't followed, a 3xx is a failed delivery like any non-2xx.
+// There's no proxy, it would be the proxy's address that got checked.
+func newClient(allow func(netip.AddrPort) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return allow(addrPort)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: tracing.Transport(transport),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Coarse delivery failure categories, what the delivery log shows. The
+// underlying error is only logged, it would tell the webhook's owner about
+// chirpy's network.
+const (
+	FailureForbiddenTarget  = "forbidden_target"
+	FailureDNS              = "dns_error"
+	FailureTimeout          = "timeout"
+	FailureConnection       = "connection_failed"
+	FailureUnexpectedStatus = "unexpected_status"
+	FailureRequest          = "request_failed"
+)
+
+// errUnexpectedStatus is a response that wasn't a 2xx.
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// failureCategory is err's category for the delivery log.
+func failureCategory(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.Is(err, ErrForbiddenTarget):
+		return FailureForbiddenTarget
+	case errors.Is(err, errUnexpectedStatus):
+		return FailureUnexpectedStatus
+	case errors.As(err, &dnsErr):
+		return FailureDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	case errors.As(err, &opErr):
+		return FailureConnection
+	}
+	return FailureRequest
+}
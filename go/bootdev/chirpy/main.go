@@ -2,67 +2,292 @@ package main
 
 import (
 	"chirpy/api"
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
 	"chirpy/internal/database"
+	"chirpy/internal/database/sqlitedb"
+	"chirpy/internal/events"
+	"chirpy/internal/health"
+	"chirpy/internal/logging"
+	"chirpy/internal/migrate"
+	"chirpy/internal/service"
+	"chirpy/internal/static"
+	"chirpy/internal/subscription"
+	"chirpy/internal/tracing"
+	"chirpy/internal/webhook"
+	"chirpy/sql/migrations"
+	sqlitemigrations "chirpy/sql/sqlite/migrations"
+	"chirpy/web"
+	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-const (
-	filepathRoot = http.Dir(".")
-	port         = "8080"
-)
-
 func main() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
-	db, err := sql.Open("postgres", dbURL)
+	// run returns instead of exiting so its defers flush traces and close the
+	// database on every path
+	err := run()
 	if err != nil {
-		panic(fmt.Sprintf("⚠️ Error connecting to database: %v", err))
+		log.Fatalf("⚠️ %v", err)
 	}
-	dbQueries := database.New(db)
-	jwt := os.Getenv("JWT_SECRET")
+}
 
-	polkaKey := os.Getenv("POLKA_KEY")
-	cfg := api.ApiConfig{DbQueries: dbQueries, Platform: platform, JWTSecret: jwt, PolkaKey: polkaKey}
-	// ServeMux in Go indeed acts as an orchestrator or router for incoming HTTP requests. It's responsible for directing each request to the appropriate handler
-	mux := http.NewServeMux()
+func run() error {
+	configFile := flag.String("config", os.Getenv("CHIRPY_CONFIG"), "optional YAML or TOML config file")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration, secrets redacted, and exit")
+	autoMigrate := flag.Bool("auto-migrate", false, "apply pending migrations before serving, same as AUTO_MIGRATE=true")
+	flag.Parse()
+	conf, err := config.Load(config.Options{File: *configFile})
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	// fail fast with every problem at once, an empty JWT_SECRET would happily
+	// sign tokens; chirpy migrate only needs the database
+	validate := conf.Validate
+	if flag.Arg(0) == "migrate" {
+		validate = conf.ValidateForMigrate
+	}
+	if *printConfig {
+		conf.Print(os.Stdout)
+	}
+	err = validate()
+	if err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	if *printConfig {
+		return nil
+	}
+	// structured logs, PII redacted unless LOG_PII=true
+	logger, err := logging.New(os.Stderr, conf.LogFormat, !conf.LogPII)
+	if err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	slog.SetDefault(logger)
+	// spans to a file, an OTLP collector or nowhere, traceparent is honoured regardless
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:     conf.TraceExporter,
+		File:         conf.TraceFile,
+		OTLPEndpoint: conf.OTLPEndpoint,
+		ServiceName:  "chirpy",
+	})
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := shutdownTracing(ctx)
+		if err != nil {
+			log.Printf("⚠️ Error flushing traces: %v\n", err)
+		}
+	}()
+	// SIGINT or SIGTERM starts a graceful shutdown, every worker shares ctx
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// prometheus metrics, the store reports every query's duration to them
+	appMetrics := api.NewMetrics()
+	be, err := openBackend(conf, appMetrics.ObserveQuery)
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	defer be.db.Close()
+	store, migrator := be.store, be.migrator
+	// the database may still be booting alongside us
+	err = database.Ping(ctx, be.db, conf.DBPingAttempts, 500*time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("connecting to database: %w", err)
+	}
+	// chirpy migrate up|down|status
+	if flag.Arg(0) == "migrate" {
+		return runMigrate(ctx, migrator, flag.Args()[1:])
+	}
+	if *autoMigrate || conf.AutoMigrate {
+		err := migrateUp(ctx, migrator)
+		if err != nil {
+			return fmt.Errorf("migrating database: %w", err)
+		}
+	}
+	// refuse to serve a schema the queries weren't written for
+	err = migrator.Check(ctx)
+	if err != nil {
+		return err
+	}
+	passwordPolicy := auth.NewPasswordPolicy(conf.PasswordMinLength, conf.PasswordMaxLength)
+	if conf.BreachedPasswordsFile != "" {
+		err := passwordPolicy.LoadBreachedPasswords(conf.BreachedPasswordsFile)
+		if err != nil {
+			return fmt.Errorf("loading breached passwords: %w", err)
+		}
+	}
+	// domain events: services write them to the outbox, the relay publishes them
+	eventCounts := events.NewCounter()
+	bus := events.NewBus()
+	bus.Subscribe(events.AllEvents, "metrics", eventCounts.Handle)
+	bus.Subscribe(events.AllEvents, "webhooks", webhook.Subscriber(store))
+	// business logic lives in the services, handlers only adapt HTTP to them
+	hasher := auth.NewArgon2idHasher(auth.DefaultArgon2idParams)
+	appMetrics.TrackActiveSessions(store)
+	cfg := api.ApiConfig{
+		Metrics:  appMetrics,
+		Store:    store,
+		Platform: conf.Platform,
+		PolkaKey: conf.PolkaKey,
+		// the legacy ApiKey scheme goes once Polka signs every webhook
+		PolkaAcceptAPIKey: conf.PolkaAcceptAPIKey,
+		AdminAPIKey:       conf.AdminAPIKey,
+		Chirps:            service.NewChirpService(store),
+		Users:             service.NewUserService(store, hasher, passwordPolicy),
+		Auth:              service.NewAuthService(store, hasher, service.AuthConfig{JWTSecret: conf.JWTSecret}),
+		EventCounts:       eventCounts,
+	}
+	// readiness: the database, its schema and every background worker
+	checker := health.NewChecker()
+	checker.Timeout = conf.HealthCheckTimeout
+	checker.Register("database", be.db.PingContext)
+	checker.Register("migrations", migrator.Check)
+	expirerBeat, relayBeat, dispatcherBeat := &health.Heartbeat{}, &health.Heartbeat{}, &health.Heartbeat{}
+	relay := events.NewRelay(store, bus)
+	relay.Heartbeat = relayBeat
+	dispatcher := webhook.NewDispatcher(store)
+	dispatcher.Heartbeat = dispatcherBeat
+	checker.Register("subscription_expirer", expirerBeat.Check(staleAfter(time.Minute)))
+	checker.Register("outbox_relay", relayBeat.Check(staleAfter(relay.Interval)))
+	checker.Register("webhook_dispatcher", dispatcherBeat.Check(staleAfter(dispatcher.Interval)))
+	// background workers run until ctx is done, shutdown waits for them
+	var workers sync.WaitGroup
+	runWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
+	// expire lapsed Chirpy Red subscriptions in the background
+	runWorker(func(ctx context.Context) { subscription.RunExpirer(ctx, store, time.Minute, expirerBeat) })
+	// publish committed domain events to subscribers
+	runWorker(relay.Run)
+	// deliver outbound webhooks from the outbox
+	runWorker(dispatcher.Run)
+	// the Router is the route table, a ServeMux underneath that directs each request to the appropriate handler
+	router := api.NewRouter()
 	// http.Server allows us to define ther server's characteristics
 	// including hook in our server's handler, ie ServeMux or NewServeMux
 	s := &http.Server{
-		Addr:           ":" + port,
-		Handler:        mux,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		Addr:           conf.Addr(),
+		Handler:        tracing.Middleware(logging.Middleware(logger, appMetrics.Middleware(router))),
+		ReadTimeout:    conf.ReadTimeout,
+		WriteTimeout:   conf.WriteTimeout,
 		MaxHeaderBytes: 1 << 20,
 	}
 	// -- API Routes
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	// -- Api Routes
-	mux.HandleFunc("/api/login", cfg.LoginUser)
-	mux.HandleFunc("/api/refresh", cfg.RefreshToken)
-	mux.HandleFunc("/api/revoke", cfg.RevokeRefreshToken)
-	mux.HandleFunc("/api/chirps", cfg.HandleChirps)
-	mux.HandleFunc("/api/chirps/", cfg.HandleChirpWithOptions)
-	mux.HandleFunc("/api/users", cfg.HandleUsers)
-	mux.HandleFunc("/api/polka/webhooks", cfg.UpgradeUserToChirpyRed)
-	// -- Admin Routes
-	mux.Handle("GET /admin/metrics", http.HandlerFunc(cfg.FileServerHitsHandler))
-	mux.HandleFunc("/admin/reset", cfg.ResetHits)
-	// -- App Routes
-	mux.Handle("/app/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(filepathRoot))))
-	mux.Handle("/app/assets/", cfg.MiddlewareMetricsInc(http.StripPrefix("/app/assets/", http.FileServer(http.Dir("./assets")))))
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(s.ListenAndServe())
+	router.Handle(http.MethodGet, "/metrics", appMetrics.Registry)
+	router.HandleFunc(http.MethodGet, "/livez", checker.LivenessHandler)
+	router.HandleFunc(http.MethodGet, "/readyz", checker.ReadinessHandler)
+	// kept for clients that still probe the old path, it's a liveness check
+	router.HandleFunc(http.MethodGet, "/api/healthz", checker.LivenessHandler)
+	cfg.RegisterRoutes(router)
+	// -- App Routes, only the files embedded in package web, never the working directory
+	appFiles, err := static.New(web.FS)
+	if err != nil {
+		return fmt.Errorf("loading app files: %w", err)
+	}
+	router.Handle(http.MethodGet, "/app/", http.StripPrefix("/app", appFiles), cfg.MiddlewareMetricsInc)
+	log.Printf("Serving on port: %d\n", conf.Port)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.ListenAndServe()
+	}()
+	// a server that stops on its own, e.g. the port is taken, shuts down like
+	// a signal and fails once the workers have stopped
+	var failed error
+	select {
+	case err := <-serveErr:
+		failed = fmt.Errorf("serving: %w", err)
+	case <-ctx.Done():
+	}
+	// a second signal kills us straight away
+	stop()
+	// fail readiness first so load balancers stop routing to us, then drain
+	checker.ShutDown()
+	if conf.ShutdownDelay > 0 && failed == nil {
+		log.Printf("🛑 Failing readiness for %s before draining\n", conf.ShutdownDelay)
+		time.Sleep(conf.ShutdownDelay)
+	}
+	log.Printf("🛑 Shutting down, draining requests for up to %s\n", conf.ShutdownTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	err = s.Shutdown(drainCtx)
+	if err != nil {
+		log.Printf("⚠️ Requests still in flight after %s: %v\n", conf.ShutdownTimeout, err)
+	}
+	workers.Wait()
+	if failed != nil {
+		return failed
+	}
+	log.Println("👋 Shut down cleanly")
+	return nil
+}
+
+// staleAfter is how long a worker polling every interval can go without a
+// successful pass before readiness fails, generous enough for a slow pass or a
+// brief blip.
+func staleAfter(interval time.Duration) time.Duration {
+	return max(3*interval, time.Minute)
+}
+
+// backend is the database chirpy runs on, the pool, the Store over it and the
+// migrations for its dialect.
+type backend struct {
+	db       *sql.DB
+	store    database.Store
+	migrator *migrate.Migrator
+}
+
+// openBackend picks the backend from DB_URL, see config.Config.Database, e.g.
+// postgres://chirpy@localhost/chirpy, sqlite://chirpy.db or sqlite://:memory:.
+// The pool limits only apply to Postgres, SQLite is always a single
+// connection. observe sees every query.
+func openBackend(conf config.Config, observe database.QueryObserver) (backend, error) {
+	switch conf.Database() {
+	case config.DatabasePostgres:
+		db, err := sql.Open("postgres", conf.DatabaseURL)
+		if err != nil {
+			return backend{}, err
+		}
+		database.PoolConfig{
+			MaxOpenConns:    conf.DBMaxOpenConns,
+			MaxIdleConns:    conf.DBMaxIdleConns,
+			ConnMaxLifetime: conf.DBConnMaxLifetime,
+			ConnMaxIdleTime: conf.DBConnMaxIdleTime,
+		}.Configure(db)
+		migrator, err := migrate.New(db, migrate.Postgres, migrations.FS)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{db: db, store: database.NewSQLStore(db, observe), migrator: migrator}, nil
+	case config.DatabaseSQLite:
+		db, err := sqlitedb.Open(strings.TrimPrefix(conf.DatabaseURL, "sqlite://"))
+		if err != nil {
+			return backend{}, err
+		}
+		migrator, err := migrate.New(db, migrate.SQLite, sqlitemigrations.FS)
+		if err != nil {
+			return backend{}, err
+		}
+		return backend{db: db, store: sqlitedb.NewStore(db, observe), migrator: migrator}, nil
+	default:
+		return backend{}, config.ErrUnknownDatabase
+	}
 }
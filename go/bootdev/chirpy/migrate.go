@@ -0,0 +1,60 @@
+package main
+
+import (
+	"chirpy/internal/migrate"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate is the `chirpy migrate up|down|status` subcommand.
+func runMigrate(ctx context.Context, m *migrate.Migrator, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chirpy migrate up|down|status")
+	}
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, m)
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("⬇️ Rolled back %03d_%s\n", mig.Version, mig.Name)
+		return nil
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down or status", args[0])
+	}
+}
+
+// migrateUp applies the pending migrations, logging each one.
+func migrateUp(ctx context.Context, m *migrate.Migrator) error {
+	applied, err := m.Up(ctx)
+	for _, mig := range applied {
+		log.Printf("⬆️ Applied %03d_%s\n", mig.Version, mig.Name)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("✅ Database is at version %d\n", m.Latest())
+	return nil
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    event_type TEXT NOT NULL,
+    actor_id UUID DEFAULT NULL,
+    payload TEXT NOT NULL,
+    dispatched_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX outbox_events_undispatched_idx ON outbox_events (created_at)
+WHERE dispatched_at IS NULL;
+
+-- the relay delivers at least once, so webhook fan-out must be idempotent per event
+CREATE UNIQUE INDEX webhook_deliveries_subscription_event_idx ON webhook_deliveries (subscription_id, event_id);
+
+-- +goose Down
+DROP INDEX webhook_deliveries_subscription_event_idx;
+DROP TABLE outbox_events;
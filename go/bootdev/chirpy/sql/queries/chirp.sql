@@ -10,6 +10,13 @@ RETURNING *;
 SELECT * FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpForUpdate :one
+-- locks the chirp until the transaction ends, so a check made on it still
+-- holds when the transaction writes
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
 -- name: GetAllChirps :many
 SELECT * FROM chirps
 ORDER BY created_at ASC;
@@ -19,6 +26,18 @@ SELECT * FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC;
 
+-- name: ListChirps :many
+-- every filter is optional, a NULL one matches every chirp
+SELECT * FROM chirps
+WHERE (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+AND (sqlc.narg(hashtag)::text IS NULL OR body ~* ('(^|[^[:alnum:]_])#' || sqlc.narg(hashtag) || '([^[:alnum:]_]|$)'))
+AND (sqlc.narg(search)::text IS NULL OR strpos(lower(body), lower(sqlc.narg(search))) > 0)
+ORDER BY
+  CASE WHEN sqlc.arg(newest_first)::bool THEN created_at END DESC,
+  created_at ASC;
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
@@ -0,0 +1,36 @@
+-- name: UpsertSubscription :one
+-- a cancellation sticks until the subscription ends, only a new one after
+-- that starts uncancelled
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_end)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), $1, $2, 'active', $3
+)
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = 'active',
+    current_period_end = EXCLUDED.current_period_end,
+    cancel_at_period_end = CASE WHEN subscriptions.status = 'active' THEN subscriptions.cancel_at_period_end ELSE FALSE END,
+    canceled_at = CASE WHEN subscriptions.status = 'active' THEN subscriptions.canceled_at ELSE NULL END,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetSubscriptionByUserID :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: CancelSubscriptionAtPeriodEnd :one
+UPDATE subscriptions
+SET cancel_at_period_end = TRUE, canceled_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND status = 'active'
+RETURNING *;
+
+-- name: EndSubscription :one
+UPDATE subscriptions
+SET status = 'canceled', current_period_end = NOW(), canceled_at = COALESCE(canceled_at, NOW()), updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :execrows
+UPDATE subscriptions
+SET status = 'expired', updated_at = NOW()
+WHERE status = 'active' AND current_period_end <= NOW();
@@ -16,3 +16,8 @@ WHERE token = $1;
 UPDATE refresh_tokens
 SET revoked_at = NOW()
 WHERE token = $1;
+
+
+-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW();
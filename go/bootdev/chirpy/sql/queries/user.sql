@@ -20,13 +20,18 @@ WHERE email = $1;
 SELECT * FROM users
 WHERE id = $1;
 
--- name: UpdateUser :one
-UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW()
+-- name: GetUserByIDForUpdate :one
+-- locks the user until the transaction ends, so a check made on it still
+-- holds when the transaction writes
+SELECT * FROM users
 WHERE id = $1
-RETURNING *;
+FOR UPDATE;
 
--- name: UpgradeUserToChirpyRed :one
-UPDATE users SET is_chirpy_red = TRUE, updated_at = NOW()
+-- name: UpdateUser :one
+UPDATE users SET email = $2, hashed_password = $3, updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2
+WHERE id = $1;
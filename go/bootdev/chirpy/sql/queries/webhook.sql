@@ -0,0 +1,64 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, created_at, updated_at, user_id, url, event_types, secret)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: ListWebhookSubscriptionsByUser :many
+SELECT * FROM webhook_subscriptions
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: ListWebhookSubscriptionsForEvent :many
+SELECT * FROM webhook_subscriptions
+WHERE (user_id IS NULL OR user_id = sqlc.arg(actor_id))
+AND (',' || event_types || ',') LIKE ('%,' || sqlc.arg(event_type)::text || ',%');
+
+-- name: DeleteWebhookSubscription :exec
+DELETE FROM webhook_subscriptions
+WHERE id = $1;
+
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, subscription_id, event_id, event_type, payload)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+ON CONFLICT (subscription_id, event_id) DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- claims up to batch_size due deliveries by pushing their next attempt out to
+-- lease_until, so no other instance sends them meanwhile; the dispatcher
+-- reschedules each one once it's sent
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until), updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= NOW()
+    ORDER BY next_attempt_at ASC
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, subscription_id, event_id, event_type, payload, attempts,
+    (SELECT url FROM webhook_subscriptions s WHERE s.id = webhook_deliveries.subscription_id) AS url,
+    (SELECT secret FROM webhook_subscriptions s WHERE s.id = webhook_deliveries.subscription_id) AS secret;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: MarkWebhookDeliverySucceeded :exec
+UPDATE webhook_deliveries
+SET status = 'succeeded', attempts = attempts + 1, last_attempt_at = NOW(), last_status_code = $2, last_error = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkWebhookDeliveryFailed :exec
+UPDATE webhook_deliveries
+SET status = $2, attempts = attempts + 1, next_attempt_at = $3, last_attempt_at = NOW(), last_status_code = $4, last_error = $5, updated_at = NOW()
+WHERE id = $1;
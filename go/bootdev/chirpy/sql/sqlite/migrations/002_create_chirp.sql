@@ -0,0 +1,12 @@
+
+-- +goose Up
+CREATE TABLE chirps (
+    id UUID PRIMARY KEY DEFAULT (gen_random_uuid()),
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    body TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirps;
@@ -0,0 +1,12 @@
+
+-- +goose Up
+CREATE TABLE webhook_events (
+    id TEXT PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    processed_at TIMESTAMP DEFAULT NULL
+);
+
+-- +goose Down
+DROP TABLE webhook_events;
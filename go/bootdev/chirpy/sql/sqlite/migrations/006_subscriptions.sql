@@ -0,0 +1,36 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT (gen_random_uuid()),
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    canceled_at TIMESTAMP DEFAULT NULL
+);
+
+-- existing Red users were never billed through Polka, there's no period to
+-- carry over, so they keep Red indefinitely: 9999-12-31 is
+-- subscription.LegacyPeriodEnd, the expirer never reaches it, a downgrade ends
+-- it and a Polka renewal starts a billed period from then
+INSERT INTO subscriptions (user_id, plan, status, current_period_end)
+SELECT id, 'chirpy_red', 'active', '9999-12-31 00:00:00+00:00'
+FROM users
+WHERE is_chirpy_red;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_chirpy_red = TRUE
+WHERE id IN (
+    SELECT user_id FROM subscriptions
+    WHERE status = 'active' AND current_period_end > NOW()
+);
+
+DROP TABLE subscriptions;
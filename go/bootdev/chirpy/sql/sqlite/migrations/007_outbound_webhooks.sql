@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT (gen_random_uuid()),
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    -- NULL for subscriptions registered by an admin, those receive every user's events
+    user_id UUID DEFAULT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- comma separated, e.g. 'chirp.created,chirp.deleted'
+    event_types TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT (gen_random_uuid()),
+    created_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    updated_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    last_attempt_at TIMESTAMP DEFAULT NULL,
+    last_status_code INTEGER DEFAULT NULL,
+    last_error TEXT DEFAULT NULL
+);
+
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at)
+WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_subscriptions;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- failed events back off instead of being retried every pass, and are parked
+-- once they run out of attempts so they can't block newer ones
+ALTER TABLE outbox_events ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+-- SQLite can't add a column with a non-constant default, new events set it
+ALTER TABLE outbox_events ADD COLUMN next_attempt_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+ALTER TABLE outbox_events ADD COLUMN last_error TEXT DEFAULT NULL;
+ALTER TABLE outbox_events ADD COLUMN parked_at TIMESTAMP DEFAULT NULL;
+UPDATE outbox_events SET next_attempt_at = created_at;
+
+DROP INDEX outbox_events_undispatched_idx;
+CREATE INDEX outbox_events_due_idx ON outbox_events (next_attempt_at)
+WHERE dispatched_at IS NULL AND parked_at IS NULL;
+
+-- +goose Down
+DROP INDEX outbox_events_due_idx;
+CREATE INDEX outbox_events_undispatched_idx ON outbox_events (created_at)
+WHERE dispatched_at IS NULL;
+ALTER TABLE outbox_events DROP COLUMN parked_at;
+ALTER TABLE outbox_events DROP COLUMN last_error;
+ALTER TABLE outbox_events DROP COLUMN next_attempt_at;
+ALTER TABLE outbox_events DROP COLUMN attempts;
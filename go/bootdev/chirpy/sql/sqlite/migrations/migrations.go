@@ -0,0 +1,7 @@
+// Package migrations embeds the SQLite goose migrations into the binary.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,48 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), ?, ?
+)
+
+RETURNING *;
+
+-- name: GetChirp :one
+SELECT * FROM chirps
+WHERE id = ?;
+
+-- name: GetChirpForUpdate :one
+-- locks the chirp until the transaction ends, so a check made on it still
+-- holds when the transaction writes
+-- SQLite has a single writer and chirpy one connection, a transaction
+-- already holds everything it reads
+SELECT * FROM chirps
+WHERE id = ?;
+
+-- name: GetAllChirps :many
+SELECT * FROM chirps
+ORDER BY created_at ASC;
+
+-- name: GetAllChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = ?
+ORDER BY created_at ASC;
+
+-- name: ListChirps :many
+-- every filter is optional, a NULL one matches every chirp
+SELECT * FROM chirps
+WHERE (sqlc.narg(author_id) IS NULL OR user_id = sqlc.narg(author_id))
+AND (sqlc.narg(since) IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until) IS NULL OR created_at < sqlc.narg(until))
+AND (sqlc.narg(hashtag) IS NULL OR has_hashtag(body, sqlc.narg(hashtag)))
+AND (sqlc.narg(search) IS NULL OR instr(lower(body), lower(sqlc.narg(search))) > 0)
+ORDER BY
+  CASE WHEN sqlc.arg(newest_first) THEN created_at END DESC,
+  created_at ASC;
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps
+WHERE id = ?;
+
+-- name: DeleteAllChirps :exec
+DELETE FROM chirps;
+
@@ -0,0 +1,27 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox_events (id, created_at, event_type, actor_id, payload, next_attempt_at)
+VALUES (
+  ?, NOW(), ?, ?, ?, NOW()
+);
+
+-- name: ListDueOutboxEvents :many
+-- undispatched events whose next attempt is due, parked ones are left alone
+SELECT * FROM outbox_events
+WHERE dispatched_at IS NULL AND parked_at IS NULL AND next_attempt_at <= NOW()
+ORDER BY next_attempt_at ASC, created_at ASC
+LIMIT ?;
+
+-- name: MarkOutboxEventDispatched :exec
+UPDATE outbox_events
+SET dispatched_at = NOW()
+WHERE id = ?;
+
+-- name: MarkOutboxEventFailed :exec
+-- records a failed attempt, parking the event instead of rescheduling it when
+-- park is set
+UPDATE outbox_events
+SET attempts = attempts + 1,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    last_error = sqlc.arg(last_error),
+    parked_at = CASE WHEN sqlc.arg(park) THEN NOW() ELSE NULL END
+WHERE id = sqlc.arg(id);
@@ -0,0 +1,23 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (
+    token, user_id, expires_at
+)
+VALUES (
+    ?, ?, ?
+)
+RETURNING token;
+
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token = ?;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE token = ?;
+
+
+-- name: CountActiveRefreshTokens :one
+SELECT COUNT(*) FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > NOW();
@@ -0,0 +1,38 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (
+  gen_random_uuid(), NOW(), NOW(), ?, ?
+)
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = ?;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = ?;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = ?;
+
+-- name: GetUserByIDForUpdate :one
+-- locks the user until the transaction ends, so a check made on it still
+-- holds when the transaction writes
+-- SQLite has a single writer and chirpy one connection, a transaction
+-- already holds everything it reads
+SELECT * FROM users
+WHERE id = ?;
+
+-- name: UpdateUser :one
+UPDATE users SET email = ?, hashed_password = ?, updated_at = NOW()
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = ?
+WHERE id = ?;
@@ -0,0 +1,24 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, event_type, payload)
+VALUES (
+    ?, ?, ?
+)
+ON CONFLICT (id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = ?;
+
+-- name: ClaimWebhookEvent :one
+-- claims an unprocessed event by marking it processed, a concurrent claim of
+-- the same event waits on the row lock and then finds nothing to claim
+UPDATE webhook_events
+SET processed_at = NOW()
+WHERE id = ? AND processed_at IS NULL
+RETURNING id;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events
+SET processed_at = NOW()
+WHERE id = ?;
@@ -0,0 +1,11 @@
+// Package web embeds the app's static files into the binary. Only what the
+// go:embed line names is served, add new files or directories to it. A
+// precompressed sibling, logo.svg.br next to logo.svg, is served to clients
+// that accept it. HTML pages link files with {{asset "assets/logo.png"}}, which
+// renders the file's content-hashed name, see static.Server.
+package web
+
+import "embed"
+
+//go:embed index.html assets
+var FS embed.FS